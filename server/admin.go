@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FormatAge returns a short human readable description of the given duration, e.g. `3d 4h`
+func FormatAge(age time.Duration) string {
+	days := int(age.Hours()) / 24
+	hours := int(age.Hours()) % 24
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, int(age.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(age.Minutes()))
+}
+
+// GetActivePairingsMsg returns a human readable list of the active pairings of the given channel, or of every channel if no channel is given
+func (p *Plugin) GetActivePairingsMsg(channelID string, now time.Time) (string, error) {
+	data, err := p.store.ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	pairings := []*Pairing{}
+	for _, pairing := range data.Pairings {
+		if len(channelID) <= 0 || pairing.ChannelID == channelID {
+			pairings = append(pairings, pairing)
+		}
+	}
+	if len(pairings) <= 0 {
+		return "There are no active pairings.", nil
+	}
+	//show the oldest pairing first
+	sort.Slice(pairings, func(i, j int) bool {
+		return pairings[i].CreatedAt < pairings[j].CreatedAt
+	})
+
+	cache := NewUserCache(p.API)
+	message := fmt.Sprintf("Active pairings (%d):\n", len(pairings))
+	for _, pairing := range pairings {
+		names := []string{}
+		for _, userID := range pairing.UserIDs {
+			if user, appErr := cache.GetUser(userID); appErr == nil {
+				names = append(names, "@"+user.Username)
+			} else {
+				names = append(names, userID)
+			}
+		}
+		channel := "unknown channel"
+		if ch, appErr := p.API.GetChannel(pairing.ChannelID); appErr == nil {
+			channel = "~" + ch.Name
+		}
+		age := now.Sub(time.Unix(0, pairing.CreatedAt*int64(time.Millisecond)))
+		message += fmt.Sprintf("  - %s in %s, paired %s ago\n", strings.Join(names, ", "), channel, FormatAge(age))
+	}
+	return message, nil
+}
+
+// CancelPairing stops the given pairing, records it as cancelled and lets its members know.
+// Returns nil if the pairing has already been finished by someone else.
+func (p *Plugin) CancelPairing(pairing *Pairing) *Pairing {
+	pairing = p.releasePairing(pairing.ID, pairing.UserIDs)
+	if pairing == nil {
+		return nil
+	}
+	p.recordHistory(NewPairingHistoryEntry(pairing, OutcomeCancelled))
+	p.notifyPairingMembers(pairing, "Your lunch pairing has been stopped by an admin.")
+	return pairing
+}
+
+// ResetHistory removes the pairing history of the given user, so he can get paired with everyone again
+func (p *Plugin) ResetHistory(userID string) error {
+	_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+		userData.History = nil
+		return nil
+	})
+	return errors.Wrap(err, "failed to reset the history")
+}
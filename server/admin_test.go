@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFormatAge(t *testing.T) {
+	assert.Equal(t, "5m", FormatAge(5*time.Minute))
+	assert.Equal(t, "2h 30m", FormatAge(150*time.Minute))
+	assert.Equal(t, "3d 4h", FormatAge(76*time.Hour))
+}
+
+func TestGetActivePairingsMsg(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+	millis := func(d time.Duration) int64 {
+		return now.Add(d).UnixNano() / int64(time.Millisecond)
+	}
+
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetUser", "1").Return(&model.User{Id: "1", Username: "john"}, nil)
+	api.On("GetUser", "2").Return(&model.User{Id: "2", Username: "mike"}, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", Name: "town-square"}, nil)
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{})
+
+	message, err := plugin.GetActivePairingsMsg("", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "There are no active pairings.", message)
+
+	plugin.store = newMemoryStore(&LunchbotData{
+		Pairings: map[string]*Pairing{
+			"A": &Pairing{ID: "A", ChannelID: "channel", UserIDs: []string{"1", "2"}, CreatedAt: millis(-2 * time.Hour)},
+			"B": &Pairing{ID: "B", ChannelID: "other", UserIDs: []string{"3", "4"}, CreatedAt: millis(-50 * time.Hour)},
+		},
+	})
+
+	message, err = plugin.GetActivePairingsMsg("", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "Active pairings (2):\n"+
+		"  - 3, 4 in unknown channel, paired 2d 2h ago\n"+
+		"  - @john, @mike in ~town-square, paired 2h 0m ago\n", message)
+
+	message, err = plugin.GetActivePairingsMsg("channel", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "Active pairings (1):\n  - @john, @mike in ~town-square, paired 2h 0m ago\n", message)
+}
+
+func TestCancelPairing(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil)
+	plugin.SetAPI(api)
+	pairing := &Pairing{ID: "A", ChannelID: "channel", UserIDs: []string{"1", "2"}}
+	plugin.store = newMemoryStore(&LunchbotData{
+		Pairings:       map[string]*Pairing{"A": pairing},
+		ActivePairings: map[string]string{"1": "A", "2": "A"},
+	})
+
+	assert.NotNil(t, plugin.CancelPairing(pairing))
+	userData, _ := plugin.store.GetUserData("2")
+	assert.Empty(t, userData.ActivePairingID)
+	assert.Equal(t, OutcomeCancelled, userData.History[0].Outcome)
+	api.AssertNumberOfCalls(t, "CreatePost", 2)
+
+	//the pairing has already been cancelled
+	assert.Nil(t, plugin.CancelPairing(pairing))
+
+	assert.Nil(t, plugin.ResetHistory("2"))
+	userData, _ = plugin.store.GetUserData("2")
+	assert.Empty(t, userData.History)
+}
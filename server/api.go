@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+// autocompleteTopicsPath is the path of the topic suggestions, it is relative so the server can prefix it with the URL of the plugin
+const autocompleteTopicsPath = "api/v1/autocomplete/topics"
+
+// ServeHTTP handles the HTTP requests that are sent to the plugin, e.g. by the interactive buttons of the bot posts
+func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v1/invitations/accept":
+		p.handleInvitationAction(w, r, userID, p.AcceptInvitation)
+	case "/api/v1/invitations/decline":
+		p.handleInvitationAction(w, r, userID, p.DeclineInvitation)
+	case "/" + autocompleteTopicsPath:
+		p.handleAutocompleteTopics(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleInvitationAction handles a click on one of the buttons of an invitation post
+func (p *Plugin) handleInvitationAction(w http.ResponseWriter, r *http.Request, userID string, action func(invitationID string, userID string) (string, error)) {
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	invitationID, ok := request.Context["invitation_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	response := &model.PostActionIntegrationResponse{}
+	message, err := action(invitationID, userID)
+	if err != nil {
+		response.EphemeralText = "Error: " + err.Error()
+	} else {
+		post := &model.Post{
+			Id:        request.PostId,
+			ChannelId: request.ChannelId,
+			UserId:    p.botID,
+			Message:   message,
+		}
+		response.Update = post
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("Failed to write response", "err", err.Error())
+	}
+}
+
+// handleAutocompleteTopics suggests the topics of the catalogue that match what the user has entered so far
+func (p *Plugin) handleAutocompleteTopics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	input := strings.TrimPrefix(query.Get("user_input"), query.Get("parsed"))
+
+	catalogue, err := p.store.GetTopicCatalogue()
+	if err != nil {
+		p.API.LogError("Failed to read the topic catalogue", "err", err.Error())
+		http.Error(w, "Cannot read the topic catalogue", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(model.AutocompleteStaticListItemsToJSON(GetTopicSuggestions(catalogue, input))); err != nil {
+		p.API.LogError("Failed to write response", "err", err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	//UnavailableUserPolicySkip skips users that are not available when a pairing round runs
+	UnavailableUserPolicySkip = "skip"
+	//UnavailableUserPolicyQueue lets users that are not available when a pairing round runs go first in the next round of the channel
+	UnavailableUserPolicyQueue = "queue"
+)
+
+// userStatuses are all statuses a user can have
+var userStatuses = []string{model.STATUS_ONLINE, model.STATUS_AWAY, model.STATUS_DND, model.STATUS_OFFLINE}
+
+// Availability describes when a user wants to get paired. The times are given in the timezone of the user.
+type Availability struct {
+	Weekdays    []time.Weekday `json:"Weekdays"`    //Days the user can get paired on
+	StartMinute int            `json:"StartMinute"` //Minute of the day from which on the user can get paired
+	EndMinute   int            `json:"EndMinute"`   //Minute of the day until which the user can get paired
+}
+
+// ParseAvailability creates an availability from the given weekdays (e.g. `mon-fri` or `mon,wed,fri`) and hours (e.g. `09:00-17:00`)
+func ParseAvailability(weekdaysStr string, hoursStr string) (*Availability, error) {
+	availability := &Availability{}
+	for _, part := range strings.Split(weekdaysStr, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, errors.Errorf("'%s' is not a valid range of weekdays, e.g. mon-fri", part)
+		}
+		first, err := ParseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = ParseWeekday(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			if !containsWeekday(availability.Weekdays, day) {
+				availability.Weekdays = append(availability.Weekdays, day)
+			}
+			if day == last {
+				break
+			}
+		}
+	}
+	sort.Slice(availability.Weekdays, func(i, j int) bool {
+		return availability.Weekdays[i] < availability.Weekdays[j]
+	})
+
+	hours := strings.Split(hoursStr, "-")
+	if len(hours) != 2 {
+		return nil, errors.Errorf("'%s' is not a valid range of hours, please use the format HH:MM-HH:MM", hoursStr)
+	}
+	startHour, startMinute, err := ParseTimeOfDay(hours[0])
+	if err != nil {
+		return nil, err
+	}
+	endHour, endMinute, err := ParseTimeOfDay(hours[1])
+	if err != nil {
+		return nil, err
+	}
+	availability.StartMinute = startHour*60 + startMinute
+	availability.EndMinute = endHour*60 + endMinute
+	if availability.StartMinute >= availability.EndMinute {
+		return nil, errors.Errorf("the start of '%s' must be before its end", hoursStr)
+	}
+	return availability, nil
+}
+
+// containsWeekday returns true if the given list contains the given weekday
+func containsWeekday(weekdays []time.Weekday, weekday time.Weekday) bool {
+	for _, day := range weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAvailable returns true if the given time lies within the availability, in the given timezone of the user
+func (a *Availability) IsAvailable(now time.Time, location *time.Location) bool {
+	now = now.In(location)
+	if !containsWeekday(a.Weekdays, now.Weekday()) {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	return minute >= a.StartMinute && minute < a.EndMinute
+}
+
+// String returns a human readable description of the availability
+func (a *Availability) String() string {
+	days := []string{}
+	for _, day := range a.Weekdays {
+		days = append(days, day.String()[:3])
+	}
+	return fmt.Sprintf("%s from %02d:%02d to %02d:%02d", strings.Join(days, ", "), a.StartMinute/60, a.StartMinute%60, a.EndMinute/60, a.EndMinute%60)
+}
+
+// GetUserLocation returns the timezone of the given user, UTC if the user has no valid timezone
+func GetUserLocation(user *model.User) *time.Location {
+	location, err := time.LoadLocation(user.GetPreferredTimezone())
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// IsUserAvailable returns true if the status and the availability of the given user allow the user to get paired at the given time
+func (p *Plugin) IsUserAvailable(cache *UserCache, user *model.User, data *LunchbotData, now time.Time) bool {
+	if participation, ok := data.Participations[user.Id]; ok && participation.Availability != nil {
+		if !participation.Availability.IsAvailable(now, GetUserLocation(user)) {
+			return false
+		}
+	}
+
+	eligibleStatuses := p.getConfiguration().GetEligibleStatuses()
+	if len(eligibleStatuses) >= len(userStatuses) {
+		return true
+	}
+	status, ok := cache.GetStatus(user.Id)
+	return ok && ContainsString(eligibleStatuses, status)
+}
+
+// IsQueued returns true if the user has been queued for the next round of the given channel
+func (pa *Participation) IsQueued(channelID string) bool {
+	_, ok := pa.QueuedChannels[channelID]
+	return ok
+}
+
+// GetQueuedUserIDs returns the users that go first in the next round of the given channel
+func GetQueuedUserIDs(data *LunchbotData, channelID string) map[string]struct{} {
+	queued := map[string]struct{}{}
+	for userID, participation := range data.Participations {
+		if participation.IsQueued(channelID) {
+			queued[userID] = struct{}{}
+		}
+	}
+	return queued
+}
+
+// QueueUsers queues the given users for the next round of the given channel, if the configured policy queues unavailable users.
+// Users that have not been queued for the channel yet get notified.
+func (p *Plugin) QueueUsers(channelID string, users []*model.User, now time.Time) {
+	if p.getConfiguration().UnavailableUserPolicy != UnavailableUserPolicyQueue {
+		return
+	}
+	channelName := channelID
+	if channel, appErr := p.API.GetChannel(channelID); appErr == nil {
+		channelName = channel.Name
+	}
+	for _, user := range users {
+		queued := false
+		_, err := p.store.UpdateUserData(user.Id, func(userData *UserData) error {
+			participation := userData.GetParticipation()
+			queued = !participation.IsQueued(channelID)
+			if queued {
+				if participation.QueuedChannels == nil {
+					participation.QueuedChannels = map[string]int64{}
+				}
+				participation.QueuedChannels[channelID] = now.UnixNano() / int64(time.Millisecond)
+			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to queue user", "user_id", user.Id, "err", err.Error())
+			continue
+		}
+		if queued {
+			message := fmt.Sprintf("You were not available for the lunchbot round in ~%s, so you will go first in its next round.", channelName)
+			if err := p.SendDirectMessage(message, user.Id); err != nil {
+				p.API.LogError("Failed to notify queued user", "user_id", user.Id, "err", err.Error())
+			}
+		}
+	}
+}
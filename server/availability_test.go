@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseAvailability(t *testing.T) {
+	t.Run("Range of weekdays", func(t *testing.T) {
+		availability, err := ParseAvailability("mon-fri", "09:00-17:30")
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, availability.Weekdays)
+		assert.Equal(t, 9*60, availability.StartMinute)
+		assert.Equal(t, 17*60+30, availability.EndMinute)
+		assert.Equal(t, "Mon, Tue, Wed, Thu, Fri from 09:00 to 17:30", availability.String())
+	})
+
+	t.Run("List of weekdays", func(t *testing.T) {
+		availability, err := ParseAvailability("wed,Monday,fri-sun", "11:30-14:00")
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Weekday{time.Sunday, time.Monday, time.Wednesday, time.Friday, time.Saturday}, availability.Weekdays)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		_, err := ParseAvailability("mon-someday", "09:00-17:00")
+		assert.NotNil(t, err)
+		_, err = ParseAvailability("mon-tue-wed", "09:00-17:00")
+		assert.NotNil(t, err)
+		_, err = ParseAvailability("mon-fri", "09:00")
+		assert.NotNil(t, err)
+		_, err = ParseAvailability("mon-fri", "09:00-25:00")
+		assert.NotNil(t, err)
+		_, err = ParseAvailability("mon-fri", "17:00-09:00")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestAvailabilityIsAvailable(t *testing.T) {
+	availability, _ := ParseAvailability("mon-fri", "09:00-17:00")
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	assert.True(t, availability.IsAvailable(time.Date(2020, time.June, 1, 9, 0, 0, 0, time.UTC), time.UTC)) //a monday
+	assert.False(t, availability.IsAvailable(time.Date(2020, time.June, 1, 17, 0, 0, 0, time.UTC), time.UTC))
+	assert.False(t, availability.IsAvailable(time.Date(2020, time.June, 6, 12, 0, 0, 0, time.UTC), time.UTC)) //a saturday
+	//16:00 UTC is 18:00 in Berlin
+	assert.True(t, availability.IsAvailable(time.Date(2020, time.June, 1, 16, 0, 0, 0, time.UTC), time.UTC))
+	assert.False(t, availability.IsAvailable(time.Date(2020, time.June, 1, 16, 0, 0, 0, time.UTC), berlin))
+}
+
+func TestIsUserAvailable(t *testing.T) {
+	user := &model.User{Id: "1", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "Europe/Berlin"}}
+	monday := time.Date(2020, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetUserStatus", "1").Return(&model.Status{Status: model.STATUS_DND}, nil)
+	plugin.SetAPI(api)
+	cache := NewUserCache(api)
+
+	config := newConfiguration()
+	plugin.setConfiguration(config)
+	data := &LunchbotData{Participations: getJoinedParticipations("1")}
+	assert.True(t, plugin.IsUserAvailable(cache, user, data, monday))
+
+	config = newConfiguration()
+	config.EligibleStatuses = "online"
+	plugin.setConfiguration(config)
+	assert.False(t, plugin.IsUserAvailable(cache, user, data, monday))
+
+	plugin.setConfiguration(newConfiguration())
+	data.Participations["1"].Availability, _ = ParseAvailability("mon", "12:30-14:00")
+	assert.True(t, plugin.IsUserAvailable(cache, user, data, monday.Add(time.Hour)))
+	assert.False(t, plugin.IsUserAvailable(cache, user, data, monday))
+}
+
+func TestQueueUsers(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(&LunchbotData{Participations: getJoinedParticipations("1")})
+	api := &plugintest.API{}
+	api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", Name: "lunch"}, nil)
+	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{Id: "direct"}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil).Once()
+	plugin.SetAPI(api)
+	users := []*model.User{&model.User{Id: "1"}}
+	now := time.Date(2020, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	plugin.setConfiguration(newConfiguration())
+	plugin.QueueUsers("channel", users, now)
+	userData, _ := plugin.store.GetUserData("1")
+	assert.False(t, userData.Participation.IsQueued("channel"))
+
+	config := newConfiguration()
+	config.UnavailableUserPolicy = UnavailableUserPolicyQueue
+	plugin.setConfiguration(config)
+	plugin.QueueUsers("channel", users, now)
+	//users that are already queued do not get notified again
+	plugin.QueueUsers("channel", users, now.Add(time.Hour))
+	userData, _ = plugin.store.GetUserData("1")
+	assert.True(t, userData.Participation.IsQueued("channel"))
+	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), userData.Participation.QueuedChannels["channel"])
+	api.AssertNumberOfCalls(t, "CreatePost", 1)
+
+	data, _ := plugin.store.ReadAll()
+	assert.Equal(t, map[string]struct{}{"1": struct{}{}}, GetQueuedUserIDs(&data, "channel"))
+	assert.Empty(t, GetQueuedUserIDs(&data, "other"))
+}
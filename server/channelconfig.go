@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	channelConfigGroupSize      = "group-size"
+	channelConfigAnnouncement   = "announcement"
+	channelConfigWelcomeMessage = "welcome-message"
+	channelConfigRoles          = "roles"
+	channelConfigSchedule       = "schedule"
+	channelConfigStrategy       = "strategy"
+	//channelConfigReset resets a channel setting to the global plugin configuration
+	channelConfigReset = "default"
+)
+
+// ChannelConfig contains the lunchbot settings of a single channel. Unset values fall back to the global plugin configuration.
+type ChannelConfig struct {
+	GroupSize        int      `json:"GroupSize"`        //Number of users per group, 0 if not set
+	PostAnnouncement *bool    `json:"PostAnnouncement"` //Whether new pairings get announced in the channel, nil if not set
+	WelcomeMessage   string   `json:"WelcomeMessage"`   //Message the paired users get greeted with, empty if not set
+	EligibleRoles    []string `json:"EligibleRoles"`    //Roles of which users need at least one to get paired, empty if everyone can get paired
+	MatchStrategy    string   `json:"MatchStrategy"`    //Name of the strategy that picks partners, empty if not set
+}
+
+// ChannelSettings are the effective settings of a channel, the channel configuration merged with the global plugin configuration
+type ChannelSettings struct {
+	GroupSize        int
+	PostAnnouncement bool
+	WelcomeMessage   string
+	EligibleRoles    []string
+	MatchStrategy    string
+}
+
+// ReadChannelConfig returns the stored configuration of the given channel. If it cannot be read, the global configuration is used.
+func (p *Plugin) ReadChannelConfig(channelID string) *ChannelConfig {
+	channelConfig, err := p.store.GetChannelConfig(channelID)
+	if err != nil {
+		p.API.LogError("Failed to read channel configuration", "channel_id", channelID, "err", err.Error())
+		return &ChannelConfig{}
+	}
+	return channelConfig
+}
+
+// GetChannelSettings returns the effective settings of the given channel
+func (p *Plugin) GetChannelSettings(channelID string) *ChannelSettings {
+	config := p.getConfiguration()
+	channelConfig := p.ReadChannelConfig(channelID)
+
+	settings := &ChannelSettings{
+		GroupSize:        config.DefaultGroupSize,
+		PostAnnouncement: config.PostAnnouncement,
+		WelcomeMessage:   channelConfig.WelcomeMessage,
+		EligibleRoles:    channelConfig.EligibleRoles,
+		MatchStrategy:    config.MatchStrategy,
+	}
+	if channelConfig.GroupSize > 0 {
+		settings.GroupSize = channelConfig.GroupSize
+	}
+	if channelConfig.PostAnnouncement != nil {
+		settings.PostAnnouncement = *channelConfig.PostAnnouncement
+	}
+	if _, ok := matchStrategies[channelConfig.MatchStrategy]; ok {
+		settings.MatchStrategy = channelConfig.MatchStrategy
+	}
+	return settings
+}
+
+// HasEligibleRole returns true if the given user has one of the given system or channel roles. Every user is eligible if no roles are given.
+func (p *Plugin) HasEligibleRole(user *model.User, channelID string, eligibleRoles []string) bool {
+	if len(eligibleRoles) <= 0 {
+		return true
+	}
+	for _, role := range strings.Fields(user.Roles) {
+		if ContainsString(eligibleRoles, role) {
+			return true
+		}
+	}
+	member, appErr := p.API.GetChannelMember(channelID, user.Id)
+	if appErr != nil {
+		return false
+	}
+	for _, role := range strings.Fields(member.Roles) {
+		if ContainsString(eligibleRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetChannelConfigValue changes a single setting of the channel configuration. The value `default` resets the setting.
+func SetChannelConfigValue(channelConfig *ChannelConfig, key string, value string) error {
+	reset := value == channelConfigReset
+	switch key {
+	case channelConfigGroupSize:
+		if reset {
+			channelConfig.GroupSize = 0
+			return nil
+		}
+		groupSize, err := ParseGroupSize(value)
+		if err != nil {
+			return err
+		}
+		channelConfig.GroupSize = groupSize
+	case channelConfigAnnouncement:
+		if reset {
+			channelConfig.PostAnnouncement = nil
+			return nil
+		}
+		var postAnnouncement bool
+		switch strings.ToLower(value) {
+		case "on", "true", "yes":
+			postAnnouncement = true
+		case "off", "false", "no":
+			postAnnouncement = false
+		default:
+			return errors.Errorf("'%s' is not a valid value for %s, please use on or off", value, key)
+		}
+		channelConfig.PostAnnouncement = &postAnnouncement
+	case channelConfigWelcomeMessage:
+		if reset {
+			channelConfig.WelcomeMessage = ""
+			return nil
+		}
+		if len(value) <= 0 {
+			return errors.New("please enter a welcome message")
+		}
+		channelConfig.WelcomeMessage = value
+	case channelConfigRoles:
+		if reset {
+			channelConfig.EligibleRoles = nil
+			return nil
+		}
+		roles := []string{}
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); len(role) > 0 {
+				roles = append(roles, role)
+			}
+		}
+		if len(roles) <= 0 {
+			return errors.New("please enter a comma separated list of roles, e.g. channel_user,channel_admin")
+		}
+		channelConfig.EligibleRoles = roles
+	case channelConfigStrategy:
+		if reset {
+			channelConfig.MatchStrategy = ""
+			return nil
+		}
+		strategy := strings.ToLower(value)
+		if _, ok := matchStrategies[strategy]; !ok {
+			return errors.Errorf("'%s' is not a valid value for %s, please use one of %s", value, key, strings.Join(GetMatchStrategyNames(), ", "))
+		}
+		channelConfig.MatchStrategy = strategy
+	default:
+		return errors.Errorf("unknown setting '%s', available settings are %s, %s, %s, %s, %s and %s", key,
+			channelConfigGroupSize, channelConfigAnnouncement, channelConfigWelcomeMessage, channelConfigRoles, channelConfigStrategy, channelConfigSchedule)
+	}
+	return nil
+}
+
+// GetChannelConfigMsg returns a human readable description of the settings of the given channel
+func (p *Plugin) GetChannelConfigMsg(channelID string) string {
+	channelConfig := p.ReadChannelConfig(channelID)
+	settings := p.GetChannelSettings(channelID)
+	defaultMarker := func(isDefault bool) string {
+		if isDefault {
+			return " (default)"
+		}
+		return ""
+	}
+
+	message := "Lunchbot settings of this channel:\n"
+	message += fmt.Sprintf("  - %s: %d%s\n", channelConfigGroupSize, settings.GroupSize, defaultMarker(channelConfig.GroupSize <= 0))
+	message += fmt.Sprintf("  - %s: %s%s\n", channelConfigAnnouncement, map[bool]string{true: "on", false: "off"}[settings.PostAnnouncement], defaultMarker(channelConfig.PostAnnouncement == nil))
+	if len(settings.WelcomeMessage) > 0 {
+		message += fmt.Sprintf("  - %s: %s\n", channelConfigWelcomeMessage, settings.WelcomeMessage)
+	} else {
+		message += fmt.Sprintf("  - %s: none (default)\n", channelConfigWelcomeMessage)
+	}
+	if len(settings.EligibleRoles) > 0 {
+		message += fmt.Sprintf("  - %s: %s\n", channelConfigRoles, strings.Join(settings.EligibleRoles, ", "))
+	} else {
+		message += fmt.Sprintf("  - %s: everyone (default)\n", channelConfigRoles)
+	}
+	message += fmt.Sprintf("  - %s: %s%s\n", channelConfigStrategy, settings.MatchStrategy, defaultMarker(len(channelConfig.MatchStrategy) <= 0))
+	if schedule, err := p.store.GetSchedule(channelID); err != nil {
+		message += fmt.Sprintf("  - %s: unknown, %s\n", channelConfigSchedule, err.Error())
+	} else if schedule != nil {
+		message += fmt.Sprintf("  - %s: %s\n", channelConfigSchedule, schedule.String())
+	} else {
+		message += fmt.Sprintf("  - %s: none\n", channelConfigSchedule)
+	}
+	message += fmt.Sprintf("Use `/%s <setting> <value>` to change a setting, or `/%s <setting> %s` to reset it.", commandLunchbotChannelConfig, commandLunchbotChannelConfig, channelConfigReset)
+	return message
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetChannelConfigValue(t *testing.T) {
+	t.Run("Valid values", func(t *testing.T) {
+		channelConfig := &ChannelConfig{}
+		assert.Nil(t, SetChannelConfigValue(channelConfig, channelConfigGroupSize, "4"))
+		assert.Nil(t, SetChannelConfigValue(channelConfig, channelConfigAnnouncement, "off"))
+		assert.Nil(t, SetChannelConfigValue(channelConfig, channelConfigWelcomeMessage, "Enjoy your lunch!"))
+		assert.Nil(t, SetChannelConfigValue(channelConfig, channelConfigRoles, "channel_admin, system_admin"))
+		assert.Nil(t, SetChannelConfigValue(channelConfig, channelConfigStrategy, "New-Connections"))
+
+		assert.Equal(t, 4, channelConfig.GroupSize)
+		assert.False(t, *channelConfig.PostAnnouncement)
+		assert.Equal(t, "Enjoy your lunch!", channelConfig.WelcomeMessage)
+		assert.Equal(t, []string{"channel_admin", "system_admin"}, channelConfig.EligibleRoles)
+		assert.Equal(t, MatchStrategyNewConnections, channelConfig.MatchStrategy)
+	})
+
+	t.Run("Reset values", func(t *testing.T) {
+		postAnnouncement := false
+		channelConfig := &ChannelConfig{GroupSize: 3, PostAnnouncement: &postAnnouncement, WelcomeMessage: "Hi", EligibleRoles: []string{"channel_admin"}, MatchStrategy: MatchStrategyNewConnections}
+		for _, key := range []string{channelConfigGroupSize, channelConfigAnnouncement, channelConfigWelcomeMessage, channelConfigRoles, channelConfigStrategy} {
+			assert.Nil(t, SetChannelConfigValue(channelConfig, key, channelConfigReset))
+		}
+		assert.Equal(t, &ChannelConfig{}, channelConfig)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		channelConfig := &ChannelConfig{}
+		assert.NotNil(t, SetChannelConfigValue(channelConfig, channelConfigGroupSize, "100"))
+		assert.NotNil(t, SetChannelConfigValue(channelConfig, channelConfigAnnouncement, "maybe"))
+		assert.NotNil(t, SetChannelConfigValue(channelConfig, channelConfigRoles, " , "))
+		assert.NotNil(t, SetChannelConfigValue(channelConfig, channelConfigStrategy, "fastest"))
+		assert.NotNil(t, SetChannelConfigValue(channelConfig, "color", "blue"))
+		assert.Equal(t, &ChannelConfig{}, channelConfig)
+	})
+}
+
+func TestGetChannelSettings(t *testing.T) {
+	t.Run("Falls back to the global configuration", func(t *testing.T) {
+		plugin := &Plugin{}
+		plugin.store = newMemoryStore(&LunchbotData{})
+
+		settings := plugin.GetChannelSettings("channel")
+		assert.Equal(t, DefaultGroupSize, settings.GroupSize)
+		assert.True(t, settings.PostAnnouncement)
+		assert.Empty(t, settings.WelcomeMessage)
+		assert.Empty(t, settings.EligibleRoles)
+		assert.Equal(t, MatchStrategyWeightedRandom, settings.MatchStrategy)
+	})
+
+	t.Run("Channel configuration overrides the global configuration", func(t *testing.T) {
+		postAnnouncement := false
+		plugin := &Plugin{}
+		plugin.store = newMemoryStore(&LunchbotData{})
+		plugin.store.SaveChannelConfig("channel", &ChannelConfig{GroupSize: 4, PostAnnouncement: &postAnnouncement, WelcomeMessage: "Hi", MatchStrategy: MatchStrategyNewConnections})
+
+		settings := plugin.GetChannelSettings("channel")
+		assert.Equal(t, 4, settings.GroupSize)
+		assert.False(t, settings.PostAnnouncement)
+		assert.Equal(t, "Hi", settings.WelcomeMessage)
+		assert.Equal(t, MatchStrategyNewConnections, settings.MatchStrategy)
+	})
+}
+
+func TestHasEligibleRole(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetChannelMember", "channel", "1").Return(&model.ChannelMember{Roles: "channel_user channel_admin"}, nil)
+	api.On("GetChannelMember", "channel", "2").Return(&model.ChannelMember{Roles: "channel_user"}, nil)
+	api.On("GetChannelMember", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	plugin.SetAPI(api)
+
+	assert.True(t, plugin.HasEligibleRole(&model.User{Id: "2", Roles: "system_user"}, "channel", nil))
+	assert.True(t, plugin.HasEligibleRole(&model.User{Id: "1", Roles: "system_user"}, "channel", []string{"channel_admin"}))
+	assert.False(t, plugin.HasEligibleRole(&model.User{Id: "2", Roles: "system_user"}, "channel", []string{"channel_admin"}))
+	assert.True(t, plugin.HasEligibleRole(&model.User{Id: "3", Roles: "system_user system_admin"}, "channel", []string{"system_admin"}))
+	assert.False(t, plugin.HasEligibleRole(&model.User{Id: "3", Roles: "system_user"}, "channel", []string{"channel_admin"}))
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
@@ -10,33 +13,125 @@ import (
 )
 
 const (
-	commandLunchbot                = "lunchbot"
-	subcommandGo                   = "go"
-	subcommandFinish               = "finish"
-	subcommandBlacklistShow        = "blacklist show"
-	subcommandBlacklistAdd         = "blacklist add"
-	subcommandBlacklistRemove      = "blacklist remove"
-	subcommandTopicsShow           = "topics show"
-	subcommandTopicsAdd            = "topics add"
-	subcommandTopicsRemove         = "topics remove"
-	commandLunchbotGo              = commandLunchbot + " " + subcommandGo
-	commandLunchbotFinish          = commandLunchbot + " " + subcommandFinish
-	commandLunchbotBlacklistShow   = commandLunchbot + " " + subcommandBlacklistShow
-	commandLunchbotBlacklistAdd    = commandLunchbot + " " + subcommandBlacklistAdd
-	commandLunchbotBlacklistRemove = commandLunchbot + " " + subcommandBlacklistRemove
-	commandLunchbotTopicsShow      = commandLunchbot + " " + subcommandTopicsShow
-	commandLunchbotTopicsAdd       = commandLunchbot + " " + subcommandTopicsAdd
-	commandLunchbotTopicsRemove    = commandLunchbot + " " + subcommandTopicsRemove
+	commandLunchbot                     = "lunchbot"
+	scopeGlobal                         = "global"
+	subcommandGo                        = "go"
+	subcommandFinish                    = "finish"
+	subcommandExtend                    = "extend"
+	subcommandBlacklistShow             = "blacklist show"
+	subcommandBlacklistAdd              = "blacklist add"
+	subcommandBlacklistRemove           = "blacklist remove"
+	subcommandTopicsShow                = "topics show"
+	subcommandTopicsAdd                 = "topics add"
+	subcommandTopicsRemove              = "topics remove"
+	subcommandTopicsPopular             = "topics popular"
+	subcommandPairChannel               = "pair-channel"
+	subcommandJoin                      = "join"
+	subcommandLeave                     = "leave"
+	subcommandPause                     = "pause"
+	subcommandStatus                    = "status"
+	subcommandHistory                   = "history"
+	subcommandAvailabilityShow          = "availability show"
+	subcommandAvailabilitySet           = "availability set"
+	subcommandAvailabilityClear         = "availability clear"
+	subcommandScheduleShow              = "schedule show"
+	subcommandScheduleSet               = "schedule set"
+	subcommandScheduleRemove            = "schedule remove"
+	subcommandChannelConfig             = "channel config"
+	subcommandAdminList                 = "admin list"
+	subcommandAdminUnpair               = "admin unpair"
+	subcommandAdminPair                 = "admin pair"
+	subcommandAdminResetHistory         = "admin reset-history"
+	subcommandAdminWipe                 = "admin wipe"
+	subcommandAdminExport               = "admin export"
+	subcommandAdminImport               = "admin import"
+	subcommandAdminReport               = "admin report"
+	subcommandAdminReplay               = "admin replay"
+	subcommandAdminFairness             = "admin fairness"
+	subcommandAdminTopicsAdd            = "admin topics add"
+	subcommandAdminTopicsRemove         = "admin topics remove"
+	subcommandAdminQuestionsList        = "admin questions list"
+	subcommandAdminQuestionsAdd         = "admin questions add"
+	subcommandAdminQuestionsRemove      = "admin questions remove"
+	flagConfirm                         = "--confirm"
+	commandLunchbotGo                   = commandLunchbot + " " + subcommandGo
+	commandLunchbotFinish               = commandLunchbot + " " + subcommandFinish
+	commandLunchbotExtend               = commandLunchbot + " " + subcommandExtend
+	commandLunchbotBlacklistShow        = commandLunchbot + " " + subcommandBlacklistShow
+	commandLunchbotBlacklistAdd         = commandLunchbot + " " + subcommandBlacklistAdd
+	commandLunchbotBlacklistRemove      = commandLunchbot + " " + subcommandBlacklistRemove
+	commandLunchbotTopicsShow           = commandLunchbot + " " + subcommandTopicsShow
+	commandLunchbotTopicsAdd            = commandLunchbot + " " + subcommandTopicsAdd
+	commandLunchbotTopicsRemove         = commandLunchbot + " " + subcommandTopicsRemove
+	commandLunchbotTopicsPopular        = commandLunchbot + " " + subcommandTopicsPopular
+	commandLunchbotPairChannel          = commandLunchbot + " " + subcommandPairChannel
+	commandLunchbotJoin                 = commandLunchbot + " " + subcommandJoin
+	commandLunchbotLeave                = commandLunchbot + " " + subcommandLeave
+	commandLunchbotPause                = commandLunchbot + " " + subcommandPause
+	commandLunchbotStatus               = commandLunchbot + " " + subcommandStatus
+	commandLunchbotHistory              = commandLunchbot + " " + subcommandHistory
+	commandLunchbotAvailabilityShow     = commandLunchbot + " " + subcommandAvailabilityShow
+	commandLunchbotAvailabilitySet      = commandLunchbot + " " + subcommandAvailabilitySet
+	commandLunchbotAvailabilityClear    = commandLunchbot + " " + subcommandAvailabilityClear
+	commandLunchbotScheduleShow         = commandLunchbot + " " + subcommandScheduleShow
+	commandLunchbotScheduleSet          = commandLunchbot + " " + subcommandScheduleSet
+	commandLunchbotScheduleRemove       = commandLunchbot + " " + subcommandScheduleRemove
+	commandLunchbotChannelConfig        = commandLunchbot + " " + subcommandChannelConfig
+	commandLunchbotAdminList            = commandLunchbot + " " + subcommandAdminList
+	commandLunchbotAdminUnpair          = commandLunchbot + " " + subcommandAdminUnpair
+	commandLunchbotAdminPair            = commandLunchbot + " " + subcommandAdminPair
+	commandLunchbotAdminResetHistory    = commandLunchbot + " " + subcommandAdminResetHistory
+	commandLunchbotAdminWipe            = commandLunchbot + " " + subcommandAdminWipe
+	commandLunchbotAdminExport          = commandLunchbot + " " + subcommandAdminExport
+	commandLunchbotAdminImport          = commandLunchbot + " " + subcommandAdminImport
+	commandLunchbotAdminReport          = commandLunchbot + " " + subcommandAdminReport
+	commandLunchbotAdminReplay          = commandLunchbot + " " + subcommandAdminReplay
+	commandLunchbotAdminFairness        = commandLunchbot + " " + subcommandAdminFairness
+	commandLunchbotAdminTopicsAdd       = commandLunchbot + " " + subcommandAdminTopicsAdd
+	commandLunchbotAdminTopicsRemove    = commandLunchbot + " " + subcommandAdminTopicsRemove
+	commandLunchbotAdminQuestionsList   = commandLunchbot + " " + subcommandAdminQuestionsList
+	commandLunchbotAdminQuestionsAdd    = commandLunchbot + " " + subcommandAdminQuestionsAdd
+	commandLunchbotAdminQuestionsRemove = commandLunchbot + " " + subcommandAdminQuestionsRemove
 )
 
 func getAutocompleteData() *model.AutocompleteData {
-	lunchbotCommand := model.NewAutocompleteData(commandLunchbot, "[command]", "Get paired to get some lunch, available subcommands: [go], [finish], [blacklist show], [blacklist add], [blacklist remove], [topics show], [topics add], [topics remove]")
+	lunchbotCommand := model.NewAutocompleteData(commandLunchbot, "[command]", "Get paired to get some lunch, available subcommands: [go], [finish], [extend], [join], [leave], [pause], [status], [history], [availability show], [availability set], [availability clear], [blacklist show], [blacklist add], [blacklist remove], [topics show], [topics add], [topics remove], [topics popular], [pair-channel], [schedule show], [schedule set], [schedule remove], [channel config], [admin list], [admin unpair], [admin pair], [admin reset-history], [admin wipe], [admin export], [admin import], [admin report], [admin replay], [admin fairness], [admin topics add], [admin topics remove], [admin questions list], [admin questions add], [admin questions remove]")
 
-	goCommand := model.NewAutocompleteData(subcommandGo, "", "Pairs you with a random user")
+	goCommand := model.NewAutocompleteData(subcommandGo, "[group size]", "Pairs you with a random user, or with a group of random users")
+	goCommand.AddTextArgument(fmt.Sprintf("Group size: The number of people having lunch together (%d-%d)", MinGroupSize, MaxGroupSize), "[group size]", "")
 	lunchbotCommand.AddCommand(goCommand)
 
 	finish := model.NewAutocompleteData(subcommandFinish, "", "Finishes your current pairing")
 	lunchbotCommand.AddCommand(finish)
+	extend := model.NewAutocompleteData(subcommandExtend, "", "Keeps your current pairing going when it is about to end")
+	lunchbotCommand.AddCommand(extend)
+
+	join := model.NewAutocompleteData(subcommandJoin, "[global]", "Lets lunchbot pair you with others in this channel, or in every channel")
+	join.AddStaticListArgument("Scope: Join only this channel or every channel", false, []model.AutocompleteListItem{
+		{Item: scopeGlobal, HelpText: "Join the pairings in every channel"},
+	})
+	lunchbotCommand.AddCommand(join)
+	leave := model.NewAutocompleteData(subcommandLeave, "[global]", "Stops lunchbot from pairing you with others in this channel, or in every channel")
+	leave.AddStaticListArgument("Scope: Leave only this channel or every channel", false, []model.AutocompleteListItem{
+		{Item: scopeGlobal, HelpText: "Leave the pairings in every channel"},
+	})
+	lunchbotCommand.AddCommand(leave)
+	pause := model.NewAutocompleteData(subcommandPause, "[duration]", "Pauses your participation for the given duration, e.g. 3d or 2w")
+	pause.AddTextArgument("Duration: How long you do not want to get paired, e.g. 12h, 3d or 2w", "[duration]", "")
+	lunchbotCommand.AddCommand(pause)
+	status := model.NewAutocompleteData(subcommandStatus, "", "Shows whether you can currently get paired")
+	lunchbotCommand.AddCommand(status)
+	history := model.NewAutocompleteData(subcommandHistory, "[count]", "Shows who you have been paired with lately")
+	history.AddTextArgument(fmt.Sprintf("Count: The number of past pairings to show, defaults to %d", DefaultHistoryCount), "[count]", "")
+	lunchbotCommand.AddCommand(history)
+	availabilityShow := model.NewAutocompleteData(subcommandAvailabilityShow, "", "Shows the days and hours you can get paired on")
+	lunchbotCommand.AddCommand(availabilityShow)
+	availabilitySet := model.NewAutocompleteData(subcommandAvailabilitySet, "[days] [HH:MM-HH:MM]", "Only lets lunchbot pair you on the given days and hours, in your timezone")
+	availabilitySet.AddTextArgument("Days: The days you can get paired on, e.g. mon-fri or mon,wed,fri", "[days]", "")
+	availabilitySet.AddTextArgument("Hours: The hours you can get paired in, e.g. 09:00-17:00", "[HH:MM-HH:MM]", "")
+	lunchbotCommand.AddCommand(availabilitySet)
+	availabilityClear := model.NewAutocompleteData(subcommandAvailabilityClear, "", "Lets lunchbot pair you at any time again")
+	lunchbotCommand.AddCommand(availabilityClear)
 
 	blacklistShow := model.NewAutocompleteData(subcommandBlacklistShow, "", "Your blacklist is a list of users you do not want to get paired with")
 	lunchbotCommand.AddCommand(blacklistShow)
@@ -50,11 +145,90 @@ func getAutocompleteData() *model.AutocompleteData {
 	topicsShow := model.NewAutocompleteData(subcommandTopicsShow, "", "Topics are things you'd like to talk about")
 	lunchbotCommand.AddCommand(topicsShow)
 	topicsAdd := model.NewAutocompleteData(subcommandTopicsAdd, "[topic]", "Add a topic to your list")
-	topicsAdd.AddTextArgument("Topic: What do you want to talk about?", "[topic]", "")
+	topicsAdd.AddDynamicListArgument("Topic: What do you want to talk about? Pick a topic others are interested in or enter a new one", autocompleteTopicsPath, true)
 	lunchbotCommand.AddCommand(topicsAdd)
 	topicsRemove := model.NewAutocompleteData(subcommandTopicsRemove, "[topic]", "Remove a topic from your list")
 	topicsRemove.AddTextArgument("Topic: `Remove topic from your list`", "[topic]", "")
 	lunchbotCommand.AddCommand(topicsRemove)
+	topicsPopular := model.NewAutocompleteData(subcommandTopicsPopular, "", "Shows the topics the most users are interested in")
+	lunchbotCommand.AddCommand(topicsPopular)
+
+	pairChannel := model.NewAutocompleteData(subcommandPairChannel, "[group size]", "Pairs all available members of this channel at once (channel admins only)")
+	pairChannel.AddTextArgument(fmt.Sprintf("Group size: The number of people having lunch together (%d-%d)", MinGroupSize, MaxGroupSize), "[group size]", "")
+	lunchbotCommand.AddCommand(pairChannel)
+
+	scheduleShow := model.NewAutocompleteData(subcommandScheduleShow, "", "Shows the schedule of the recurring pairing rounds in this channel")
+	lunchbotCommand.AddCommand(scheduleShow)
+	scheduleSet := model.NewAutocompleteData(subcommandScheduleSet, "[weekday] [HH:MM] [timezone] [group size]", "Pairs all members of this channel every week at the given time (channel admins only)")
+	scheduleSet.AddTextArgument("Weekday: The day of the week the round takes place", "[weekday]", "")
+	scheduleSet.AddTextArgument("Time: The time of day the round takes place", "[HH:MM]", "")
+	scheduleSet.AddTextArgument("Timezone: The timezone of the schedule, defaults to your own timezone", "[timezone]", "")
+	scheduleSet.AddTextArgument(fmt.Sprintf("Group size: The number of people having lunch together (%d-%d)", MinGroupSize, MaxGroupSize), "[group size]", "")
+	lunchbotCommand.AddCommand(scheduleSet)
+	scheduleRemove := model.NewAutocompleteData(subcommandScheduleRemove, "", "Removes the schedule of this channel (channel admins only)")
+	lunchbotCommand.AddCommand(scheduleRemove)
+
+	channelConfig := model.NewAutocompleteData(subcommandChannelConfig, "[setting] [value]", "Shows or changes the lunchbot settings of this channel (channel admins only)")
+	channelConfig.AddStaticListArgument("Setting: The setting you want to change", false, []model.AutocompleteListItem{
+		{Item: channelConfigGroupSize, HelpText: fmt.Sprintf("The number of people having lunch together (%d-%d)", MinGroupSize, MaxGroupSize)},
+		{Item: channelConfigAnnouncement, HelpText: "Whether new pairings get announced in this channel (on or off)"},
+		{Item: channelConfigWelcomeMessage, HelpText: "The message paired users get greeted with"},
+		{Item: channelConfigRoles, HelpText: "Comma separated list of roles that can get paired, e.g. channel_user,channel_admin"},
+		{Item: channelConfigStrategy, HelpText: "How partners are picked: weighted-random or new-connections"},
+		{Item: channelConfigSchedule, HelpText: "The schedule of the pairing rounds, e.g. monday 10:00 Europe/Berlin, or off"},
+	})
+	channelConfig.AddTextArgument(fmt.Sprintf("Value: The new value of the setting, or %s to use the global configuration", channelConfigReset), "[value]", "")
+	lunchbotCommand.AddCommand(channelConfig)
+
+	adminList := model.NewAutocompleteData(subcommandAdminList, "", "Shows the active pairings of this channel, or of every channel for system admins (admins only)")
+	lunchbotCommand.AddCommand(adminList)
+	adminUnpair := model.NewAutocompleteData(subcommandAdminUnpair, "[username]", "Stops the active pairing of the given user (admins only)")
+	adminUnpair.AddTextArgument("Username: The user whose pairing you want to stop", "[username]", "")
+	lunchbotCommand.AddCommand(adminUnpair)
+	adminPair := model.NewAutocompleteData(subcommandAdminPair, "[username] [username] [...]", "Pairs the given participants of this channel with each other (admins only)")
+	adminPair.AddTextArgument("Usernames: The users you want to pair", "[username] [username] [...]", "")
+	lunchbotCommand.AddCommand(adminPair)
+	adminResetHistory := model.NewAutocompleteData(subcommandAdminResetHistory, "[username]", "Removes the pairing history of the given user (system admins only)")
+	adminResetHistory.AddTextArgument("Username: The user whose history you want to remove", "[username]", "")
+	lunchbotCommand.AddCommand(adminResetHistory)
+	adminWipe := model.NewAutocompleteData(subcommandAdminWipe, flagConfirm, "Removes all data stored by lunchbot (system admins only)")
+	adminWipe.AddStaticListArgument("Confirm: All pairings, histories, topics, schedules and settings will be lost", true, []model.AutocompleteListItem{
+		{Item: flagConfirm, HelpText: "I really want to remove all data"},
+	})
+	lunchbotCommand.AddCommand(adminWipe)
+	adminExport := model.NewAutocompleteData(subcommandAdminExport, "", "Sends you a JSON file with all data stored by lunchbot (system admins only)")
+	lunchbotCommand.AddCommand(adminExport)
+	adminImport := model.NewAutocompleteData(subcommandAdminImport, "[mode]", "Imports the JSON file you uploaded last in your direct messages with lunchbot (system admins only)")
+	adminImport.AddStaticListArgument("Mode: Whether the existing data is kept", true, []model.AutocompleteListItem{
+		{Item: ImportModeMerge, HelpText: "Add the imported data to the existing data"},
+		{Item: ImportModeReplace + " " + flagConfirm, HelpText: "Remove all existing data before importing"},
+	})
+	lunchbotCommand.AddCommand(adminImport)
+	adminReport := model.NewAutocompleteData(subcommandAdminReport, "[from] [to]", "Sends you CSV reports of the pairings within the given dates (system admins only)")
+	adminReport.AddTextArgument(fmt.Sprintf("From: The first day of the report, e.g. 2020-06-01. Defaults to %d days ago", defaultReportDays), "[from]", "")
+	adminReport.AddTextArgument("To: The last day of the report, e.g. 2020-06-30. Defaults to today", "[to]", "")
+	lunchbotCommand.AddCommand(adminReport)
+	adminReplay := model.NewAutocompleteData(subcommandAdminReplay, "[round ID]", "Replays a pairing round of this channel with its recorded seed, or lists the recent rounds (admins only)")
+	adminReplay.AddTextArgument("Round ID: The round you want to replay, leave empty to list the recent rounds", "[round ID]", "")
+	lunchbotCommand.AddCommand(adminReplay)
+	adminFairness := model.NewAutocompleteData(subcommandAdminFairness, "", "Lists the participants of this channel that have been waiting the longest for a pairing (admins only)")
+	lunchbotCommand.AddCommand(adminFairness)
+	adminTopicsAdd := model.NewAutocompleteData(subcommandAdminTopicsAdd, "[topic]", "Adds a topic to the topic catalogue that is suggested to everyone (system admins only)")
+	adminTopicsAdd.AddTextArgument("Topic: The topic you want to suggest", "[topic]", "")
+	lunchbotCommand.AddCommand(adminTopicsAdd)
+	adminTopicsRemove := model.NewAutocompleteData(subcommandAdminTopicsRemove, "[topic]", "Removes a topic from the topic catalogue (system admins only)")
+	adminTopicsRemove.AddDynamicListArgument("Topic: The topic you no longer want to suggest", autocompleteTopicsPath, true)
+	lunchbotCommand.AddCommand(adminTopicsRemove)
+	adminQuestionsList := model.NewAutocompleteData(subcommandAdminQuestionsList, "[category]", "Shows the icebreaker questions that get suggested to new pairings (system admins only)")
+	adminQuestionsList.AddTextArgument("Category: Only show the questions of this category", "[category]", "")
+	lunchbotCommand.AddCommand(adminQuestionsList)
+	adminQuestionsAdd := model.NewAutocompleteData(subcommandAdminQuestionsAdd, "[category] [question]", "Adds an icebreaker question (system admins only)")
+	adminQuestionsAdd.AddTextArgument("Category: The category of the question, e.g. food or travel", "[category]", "")
+	adminQuestionsAdd.AddTextArgument("Question: The question that gets suggested to new pairings", "[question]", "")
+	lunchbotCommand.AddCommand(adminQuestionsAdd)
+	adminQuestionsRemove := model.NewAutocompleteData(subcommandAdminQuestionsRemove, "[question ID]", "Removes an icebreaker question that has been added by an admin (system admins only)")
+	adminQuestionsRemove.AddTextArgument("Question ID: The ID shown by the question list", "[question ID]", "")
+	lunchbotCommand.AddCommand(adminQuestionsRemove)
 
 	return lunchbotCommand
 }
@@ -100,9 +274,99 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		commandLunchbotTopicsRemove: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 			return p.executeCommandLunchbotTopicsRemove(args), nil
 		},
+		commandLunchbotTopicsPopular: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotTopicsPopular(args), nil
+		},
+		commandLunchbotJoin: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotJoin(args), nil
+		},
+		commandLunchbotLeave: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotLeave(args), nil
+		},
+		commandLunchbotPause: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotPause(args), nil
+		},
+		commandLunchbotStatus: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotStatus(args), nil
+		},
+		commandLunchbotHistory: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotHistory(args), nil
+		},
+		commandLunchbotAvailabilityShow: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAvailabilityShow(args), nil
+		},
+		commandLunchbotAvailabilitySet: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAvailabilitySet(args), nil
+		},
+		commandLunchbotAvailabilityClear: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAvailabilityClear(args), nil
+		},
+		commandLunchbotPairChannel: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotPairChannel(args), nil
+		},
+		commandLunchbotScheduleShow: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotScheduleShow(args), nil
+		},
+		commandLunchbotScheduleSet: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotScheduleSet(args), nil
+		},
+		commandLunchbotScheduleRemove: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotScheduleRemove(args), nil
+		},
+		commandLunchbotChannelConfig: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotChannelConfig(args), nil
+		},
+		commandLunchbotAdminList: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminList(args), nil
+		},
+		commandLunchbotAdminUnpair: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminUnpair(args), nil
+		},
+		commandLunchbotAdminPair: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminPair(args), nil
+		},
+		commandLunchbotAdminResetHistory: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminResetHistory(args), nil
+		},
+		commandLunchbotAdminWipe: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminWipe(args), nil
+		},
+		commandLunchbotAdminExport: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminExport(args), nil
+		},
+		commandLunchbotAdminImport: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminImport(args), nil
+		},
+		commandLunchbotAdminReport: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminReport(args), nil
+		},
+		commandLunchbotAdminReplay: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminReplay(args), nil
+		},
+		commandLunchbotAdminFairness: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminFairness(args), nil
+		},
+		commandLunchbotAdminTopicsAdd: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminTopicsAdd(args), nil
+		},
+		commandLunchbotAdminTopicsRemove: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminTopicsRemove(args), nil
+		},
+		commandLunchbotAdminQuestionsList: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminQuestionsList(args), nil
+		},
+		commandLunchbotAdminQuestionsAdd: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminQuestionsAdd(args), nil
+		},
+		commandLunchbotAdminQuestionsRemove: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotAdminQuestionsRemove(args), nil
+		},
 		commandLunchbotFinish: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 			return p.executeCommandLunchbotFinish(args), nil
 		},
+		commandLunchbotExtend: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeCommandLunchbotExtend(args), nil
+		},
 		commandLunchbotGo: func(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 			return p.executeCommandLunchbot(args), nil
 		},
@@ -134,17 +398,27 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	}, nil
 }
 
+// getStorageErrorResponse logs the given storage error and returns a response that lets the user know about it
+func (p *Plugin) getStorageErrorResponse(err error) *model.CommandResponse {
+	p.API.LogError("Failed to access the stored data", "err", err.Error())
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Error: Cannot access the stored data: %s", err.Error()),
+	}
+}
+
 func (p *Plugin) executeCommandLunchbotBlacklistShow(args *model.CommandArgs) *model.CommandResponse {
 	message := fmt.Sprintf("Your blacklist is empty. Use '/%s' to add someone to your blacklist.", commandLunchbotBlacklistAdd)
 
-	data := p.ReadFromStorage()
-	if data.Blacklists != nil {
-		if blacklist, ok := data.Blacklists[args.UserId]; ok {
-			message = "Users on your blacklist:\n"
-			for entry := range blacklist {
-				user, _ := p.API.GetUser(entry)
-				message += fmt.Sprintf("  - %s\n", user.GetDisplayName(""))
-			}
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(userData.Blacklist) > 0 {
+		message = "Users on your blacklist:\n"
+		for entry := range userData.Blacklist {
+			user, _ := p.API.GetUser(entry)
+			message += fmt.Sprintf("  - %s\n", user.GetDisplayName(""))
 		}
 	}
 
@@ -172,16 +446,16 @@ func (p *Plugin) executeCommandLunchbotBlacklistAdd(args *model.CommandArgs) *mo
 		}
 	}
 
-	data := p.ReadFromStorage()
-	if data.Blacklists == nil {
-		data.Blacklists = make(map[string]map[string]struct{})
-	}
-	if blacklist, ok := data.Blacklists[args.UserId]; ok {
-		blacklist[user.Id] = struct{}{}
-	} else {
-		data.Blacklists[args.UserId] = map[string]struct{}{user.Id: struct{}{}}
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		if userData.Blacklist == nil {
+			userData.Blacklist = map[string]struct{}{}
+		}
+		userData.Blacklist[user.Id] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
 	}
-	p.WriteToStorage(&data)
 
 	return &model.CommandResponse{
 		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -207,16 +481,19 @@ func (p *Plugin) executeCommandLunchbotBlacklistRemove(args *model.CommandArgs)
 		}
 	}
 
-	data := p.ReadFromStorage()
-	if data.Blacklists != nil {
-		if blacklist, ok := data.Blacklists[args.UserId]; ok {
-			delete(blacklist, user.Id)
-			p.WriteToStorage(&data)
-
-			return &model.CommandResponse{
-				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-				Text:         fmt.Sprintf("Removed '%s' from your blacklist", user.GetDisplayName("")),
-			}
+	removed := false
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		_, removed = userData.Blacklist[user.Id]
+		delete(userData.Blacklist, user.Id)
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if removed {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Removed '%s' from your blacklist", user.GetDisplayName("")),
 		}
 	}
 
@@ -229,13 +506,14 @@ func (p *Plugin) executeCommandLunchbotBlacklistRemove(args *model.CommandArgs)
 func (p *Plugin) executeCommandLunchbotTopicsShow(args *model.CommandArgs) *model.CommandResponse {
 	message := fmt.Sprintf("There are no topics set yet... Use '/%s' to set a topic.", commandLunchbotTopicsShow)
 
-	data := p.ReadFromStorage()
-	if data.UserTopics != nil {
-		if topics, ok := data.UserTopics[args.UserId]; ok {
-			message = "Your topics:\n"
-			for entry := range topics {
-				message += fmt.Sprintf("  - %s\n", entry)
-			}
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(userData.Topics) > 0 {
+		message = "Your topics:\n"
+		for entry := range userData.Topics {
+			message += fmt.Sprintf("  - %s\n", entry)
 		}
 	}
 
@@ -247,7 +525,7 @@ func (p *Plugin) executeCommandLunchbotTopicsShow(args *model.CommandArgs) *mode
 
 func (p *Plugin) executeCommandLunchbotTopicsAdd(args *model.CommandArgs) *model.CommandResponse {
 	givenTopic := strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotTopicsAdd))
-	givenTopic = strings.TrimPrefix(givenTopic, " ")
+	givenTopic = strings.Join(strings.Fields(givenTopic), " ")
 	if len(givenTopic) <= 0 {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -255,16 +533,37 @@ func (p *Plugin) executeCommandLunchbotTopicsAdd(args *model.CommandArgs) *model
 		}
 	}
 
-	data := p.ReadFromStorage()
-	if data.UserTopics == nil {
-		data.UserTopics = make(map[string]map[string]struct{})
+	//topics are spelled like in the catalogue, new topics get added to it
+	_, err := p.store.UpdateTopicCatalogue(func(catalogue map[string]*CatalogueTopic) error {
+		givenTopic = AddToCatalogue(catalogue, givenTopic, false, model.GetMillis())
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+
+	existingTopic := ""
+	_, err = p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		if userData.Topics == nil {
+			userData.Topics = map[string]struct{}{}
+		}
+		//the same topic with a different spelling is not added again
+		existingTopic, _ = FindTopic(userData.Topics, givenTopic)
+		if len(existingTopic) > 0 {
+			return nil
+		}
+		userData.Topics[givenTopic] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
 	}
-	if topics, ok := data.UserTopics[args.UserId]; ok {
-		topics[givenTopic] = struct{}{}
-	} else {
-		data.UserTopics[args.UserId] = map[string]struct{}{givenTopic: struct{}{}}
+	if len(existingTopic) > 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("'%s' already is one of your topics", existingTopic),
+		}
 	}
-	p.WriteToStorage(&data)
 
 	return &model.CommandResponse{
 		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -274,7 +573,7 @@ func (p *Plugin) executeCommandLunchbotTopicsAdd(args *model.CommandArgs) *model
 
 func (p *Plugin) executeCommandLunchbotTopicsRemove(args *model.CommandArgs) *model.CommandResponse {
 	givenTopic := strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotTopicsRemove))
-	givenTopic = strings.TrimPrefix(givenTopic, " ")
+	givenTopic = strings.Join(strings.Fields(givenTopic), " ")
 	if len(givenTopic) <= 0 {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -282,17 +581,20 @@ func (p *Plugin) executeCommandLunchbotTopicsRemove(args *model.CommandArgs) *mo
 		}
 	}
 
-	data := p.ReadFromStorage()
-	if data.UserTopics != nil {
-		if topics, ok := data.UserTopics[args.UserId]; ok {
-			if _, ok := data.UserTopics[args.UserId][givenTopic]; ok {
-				delete(topics, givenTopic)
-				p.WriteToStorage(&data)
-				return &model.CommandResponse{
-					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-					Text:         fmt.Sprintf("Removed '%s' from your topics", givenTopic),
-				}
-			}
+	removed := false
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		var existingTopic string
+		existingTopic, removed = FindTopic(userData.Topics, givenTopic)
+		delete(userData.Topics, existingTopic)
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if removed {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Removed '%s' from your topics", givenTopic),
 		}
 	}
 
@@ -302,123 +604,1104 @@ func (p *Plugin) executeCommandLunchbotTopicsRemove(args *model.CommandArgs) *mo
 	}
 }
 
-func (p *Plugin) executeCommandLunchbotFinish(args *model.CommandArgs) *model.CommandResponse {
-	triggerUser, err := p.API.GetUser(args.UserId)
+func (p *Plugin) executeCommandLunchbotTopicsPopular(args *model.CommandArgs) *model.CommandResponse {
+	message, err := p.GetPopularTopicsMsg()
 	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotJoin(args *model.CommandArgs) *model.CommandResponse {
+	scope := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotJoin)))
+	if len(scope) > 0 && scope != scopeGlobal {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         "Error: Cannot get your user...",
+			Text:         fmt.Sprintf("Error: Unknown scope '%s', use '/%s' or '/%s %s'", scope, commandLunchbotJoin, commandLunchbotJoin, scopeGlobal),
+		}
+	}
+
+	message := "You joined the pairings of this channel"
+	if scope == scopeGlobal {
+		message = "You joined the pairings of every channel"
+	}
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		participation := userData.GetParticipation()
+		if scope == scopeGlobal {
+			participation.Joined = true
+		} else {
+			participation.Channels[args.ChannelId] = true
+		}
+		if participation.JoinedAt == 0 {
+			participation.JoinedAt = model.GetMillis()
 		}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
 	}
 
-	data := p.ReadFromStorage()
-	if data.ActivePairings == nil {
-		data.ActivePairings = map[string]string{}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
 	}
-	pairedUserID, ok := data.ActivePairings[args.UserId]
-	if !ok {
+}
+
+func (p *Plugin) executeCommandLunchbotLeave(args *model.CommandArgs) *model.CommandResponse {
+	scope := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotLeave)))
+	if len(scope) > 0 && scope != scopeGlobal {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         "Error: You do not seem to be paired with another user",
+			Text:         fmt.Sprintf("Error: Unknown scope '%s', use '/%s' or '/%s %s'", scope, commandLunchbotLeave, commandLunchbotLeave, scopeGlobal),
+		}
+	}
+
+	message := "You left the pairings of this channel"
+	if scope == scopeGlobal {
+		message = "You left the pairings of every channel"
+	}
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		participation := userData.GetParticipation()
+		if scope == scopeGlobal {
+			participation.Joined = false
+			participation.Channels = map[string]bool{}
+		} else {
+			participation.Channels[args.ChannelId] = false
 		}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
 	}
 
-	//Remove from active sessions
-	delete(data.ActivePairings, args.UserId)
-	delete(data.ActivePairings, pairedUserID)
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
 
-	//Add to the history of pairings, needed to avoid users getting paired again immediately
-	if data.LastPairings == nil {
-		data.LastPairings = map[string][]string{}
+func (p *Plugin) executeCommandLunchbotPause(args *model.CommandArgs) *model.CommandResponse {
+	givenDuration := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotPause)))
+	if len(givenDuration) <= 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Please enter how long you want to pause, e.g. 3d or 2w",
+		}
 	}
-	data.LastPairings[triggerUser.Id] = append(data.LastPairings[triggerUser.Id], pairedUserID)
-	data.LastPairings[pairedUserID] = append(data.LastPairings[pairedUserID], triggerUser.Id)
-	if len(data.LastPairings[triggerUser.Id]) > NumHistoryEntries {
-		index := 0 //remove the oldest element
-		data.LastPairings[triggerUser.Id] = append(data.LastPairings[triggerUser.Id][:index], data.LastPairings[triggerUser.Id][index+1:]...)
+	duration, err := ParseDuration(givenDuration)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: %s", err.Error()),
+		}
 	}
-	if len(data.LastPairings[pairedUserID]) > NumHistoryEntries {
-		index := 0 //remove the oldest element
-		data.LastPairings[pairedUserID] = append(data.LastPairings[pairedUserID][:index], data.LastPairings[pairedUserID][index+1:]...)
+
+	pausedUntil := time.Now().Add(duration)
+	_, err = p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		userData.GetParticipation().PausedUntil = pausedUntil.UnixNano() / int64(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
 	}
-	p.WriteToStorage(&data)
 
-	//notify both users that their pairing has been stopped
-	resp := p.SendGroupMessage("Your session has been finished! Thanks a lot for using Lunchbot :sunglasses:", []string{triggerUser.Id, pairedUserID})
-	if resp != nil {
-		return resp
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("You will not get paired until %s", pausedUntil.UTC().Format("2006-01-02 15:04 MST")),
 	}
+}
 
-	return &model.CommandResponse{}
+func (p *Plugin) executeCommandLunchbotStatus(args *model.CommandArgs) *model.CommandResponse {
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         GetParticipationStatusMsg(userData, args.ChannelId, time.Now()),
+	}
 }
 
-func (p *Plugin) executeCommandLunchbot(args *model.CommandArgs) *model.CommandResponse {
-	triggerUser, err := p.API.GetUser(args.UserId)
+func (p *Plugin) executeCommandLunchbotAvailabilityShow(args *model.CommandArgs) *model.CommandResponse {
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	message := fmt.Sprintf("You can get paired at any time. Use '/%s' to limit the days and hours.", commandLunchbotAvailabilitySet)
+	if userData.Participation != nil && userData.Participation.Availability != nil {
+		message = fmt.Sprintf("You can get paired on %s in your timezone.", userData.Participation.Availability.String())
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAvailabilitySet(args *model.CommandArgs) *model.CommandResponse {
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAvailabilitySet)))
+	if len(params) != 2 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Please enter the days and hours you can get paired, e.g. '/%s mon-fri 11:30-14:00'", commandLunchbotAvailabilitySet),
+		}
+	}
+	availability, err := ParseAvailability(params[0], params[1])
 	if err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         "Error: Cannot get your user...",
+			Text:         fmt.Sprintf("Error: %s", err.Error()),
 		}
 	}
 
-	//is this user already paired?
-	data := p.ReadFromStorage()
-	if data.ActivePairings == nil {
-		data.ActivePairings = map[string]string{}
+	_, err = p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		userData.GetParticipation().Availability = availability
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("You will only get paired on %s in your timezone.", availability.String()),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAvailabilityClear(args *model.CommandArgs) *model.CommandResponse {
+	_, err := p.store.UpdateUserData(args.UserId, func(userData *UserData) error {
+		if userData.Participation != nil {
+			userData.Participation.Availability = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         "You can get paired at any time again.",
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotHistory(args *model.CommandArgs) *model.CommandResponse {
+	count := DefaultHistoryCount
+	givenCount := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotHistory)))
+	if len(givenCount) > 0 {
+		var err error
+		if count, err = strconv.Atoi(givenCount); err != nil || count <= 0 {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: '%s' is not a valid number of pairings", givenCount),
+			}
+		}
+	}
+
+	message, err := p.GetHistoryMsg(args.UserId, count)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
 	}
-	if pairing, ok := data.ActivePairings[triggerUser.Id]; ok {
-		otherUser, _ := p.API.GetUser(pairing)
+}
+
+func (p *Plugin) executeCommandLunchbotPairChannel(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsChannelAdmin(args.UserId, args.ChannelId) {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         fmt.Sprintf("Error: You are already paired with @%s. Please finish that pairing with `/lunchbot finish`.", otherUser.GetDisplayName("")),
+			Text:         "Error: Only channel admins are allowed to pair the whole channel",
+		}
+	}
+
+	groupSize := p.GetChannelSettings(args.ChannelId).GroupSize
+	givenGroupSize := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotPairChannel)))
+	if len(givenGroupSize) > 0 {
+		var err error
+		if groupSize, err = ParseGroupSize(givenGroupSize); err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: %s", err.Error()),
+			}
 		}
 	}
 
-	pairedUser, err := p.GetPairingForUserID(args.ChannelId, args.UserId)
+	result, err := p.RunPairingRound(args.ChannelId, groupSize, args.UserId)
 	if err != nil {
+		p.API.LogError("Failed to pair the channel", "channel_id", args.ChannelId, "err", err.Error())
+	}
+	if result == nil {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         "Error: Cannot match you with a user from this channel",
+			Text:         "Error: Cannot pair the members of this channel",
 		}
 	}
-	data.ActivePairings[triggerUser.Id] = pairedUser.Id
-	data.ActivePairings[pairedUser.Id] = triggerUser.Id
-	p.WriteToStorage(&data)
 
-	users := []string{triggerUser.Id, pairedUser.Id}
-	resp := p.SendGroupMessage("Hey! I think both of you should meet for lunch soon!", users)
-	if resp != nil {
-		return resp
+	message := fmt.Sprintf("Paired %d groups in this channel (round `%s`).", len(result.Groups), result.Round.ID)
+	if len(result.Unmatched) > 0 {
+		names := []string{}
+		for _, user := range result.Unmatched {
+			names = append(names, "@"+user.GetDisplayName(""))
+		}
+		message += fmt.Sprintf(" Could not find a partner for %s.", strings.Join(names, ", "))
+	}
+	if err != nil {
+		message += fmt.Sprintf(" Error: %s.", err.Error())
 	}
 
-	topics := p.GetRandomTopicsMsg(users)
-	resp = p.SendGroupMessage(topics, users)
-	if resp != nil {
-		return resp
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
 	}
+}
 
-	resp = p.SendGroupMessage("You can finish this pairing by entering `/lunchbot finish`. Have fun!", users)
-	if resp != nil {
-		return resp
+func (p *Plugin) executeCommandLunchbotScheduleShow(args *model.CommandArgs) *model.CommandResponse {
+	message := fmt.Sprintf("There is no schedule for this channel yet. Use '/%s' to set one.", commandLunchbotScheduleSet)
+
+	schedule, err := p.store.GetSchedule(args.ChannelId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if schedule != nil {
+		message = fmt.Sprintf("Members of this channel get paired %s", schedule.String())
 	}
 
-	//advertise the lunchbot a bit :)
-	message := fmt.Sprintf("Yeah! @%s and @%s are going to lunch together! I am lunchbot, and you can trigger me by entering `/lunchbot` :sunglasses::point_right::point_right:",
-		triggerUser.GetDisplayName(""),
-		pairedUser.GetDisplayName(""))
-	post := &model.Post{
-		ChannelId: args.ChannelId,
-		UserId:    p.botID,
-		Message:   message,
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
 	}
-	if _, err = p.API.CreatePost(post); err != nil {
-		const errorMessage = "Error: Failed to create post"
-		p.API.LogError(errorMessage, "err", err.Error())
+}
+
+func (p *Plugin) executeCommandLunchbotScheduleSet(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsChannelAdmin(args.UserId, args.ChannelId) {
 		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			Text:         errorMessage,
+			Text:         "Error: Only channel admins are allowed to change the schedule of this channel",
 		}
 	}
 
-	return &model.CommandResponse{}
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotScheduleSet)))
+	groupSize := p.GetChannelSettings(args.ChannelId).GroupSize
+	if len(params) > 2 {
+		//the group size is optional and always the last parameter
+		if _, err := strconv.Atoi(params[len(params)-1]); err == nil {
+			groupSize, err = ParseGroupSize(params[len(params)-1])
+			if err != nil {
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					Text:         fmt.Sprintf("Error: %s", err.Error()),
+				}
+			}
+			params = params[:len(params)-1]
+		}
+	}
+	if len(params) < 2 || len(params) > 3 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Please enter a weekday and a time, e.g. '/%s monday 10:00'", commandLunchbotScheduleSet),
+		}
+	}
+
+	timezone := ""
+	if len(params) == 3 {
+		timezone = params[2]
+	} else if triggerUser, err := p.API.GetUser(args.UserId); err == nil {
+		timezone = triggerUser.GetPreferredTimezone()
+	}
+	if len(timezone) <= 0 {
+		timezone = "UTC"
+	}
+
+	schedule, err := ParseSchedule(params[0], params[1], timezone)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: %s", err.Error()),
+		}
+	}
+	schedule.ChannelID = args.ChannelId
+	schedule.CreatorID = args.UserId
+	schedule.GroupSize = groupSize
+	schedule.LastRun = model.GetMillis() //do not run occurrences that have been before the schedule has been set
+
+	if err := p.store.SaveSchedule(schedule); err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Members of this channel will get paired %s", schedule.String()),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotScheduleRemove(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only channel admins are allowed to change the schedule of this channel",
+		}
+	}
+
+	schedule, err := p.store.GetSchedule(args.ChannelId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if schedule == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: There is no schedule for this channel",
+		}
+	}
+	if err := p.store.DeleteSchedule(args.ChannelId); err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         "Removed the schedule of this channel",
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotChannelConfig(args *model.CommandArgs) *model.CommandResponse {
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotChannelConfig)))
+	if len(params) <= 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         p.GetChannelConfigMsg(args.ChannelId),
+		}
+	}
+
+	if !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only channel admins are allowed to change the settings of this channel",
+		}
+	}
+
+	key := params[0]
+	value := strings.Join(params[1:], " ")
+	if key == channelConfigSchedule {
+		//the schedule is managed by the schedule commands
+		scheduleArgs := *args
+		if value == "off" || value == channelConfigReset {
+			scheduleArgs.Command = fmt.Sprintf("/%s", commandLunchbotScheduleRemove)
+			return p.executeCommandLunchbotScheduleRemove(&scheduleArgs)
+		}
+		scheduleArgs.Command = fmt.Sprintf("/%s %s", commandLunchbotScheduleSet, value)
+		return p.executeCommandLunchbotScheduleSet(&scheduleArgs)
+	}
+
+	//other settings might get changed concurrently, only the given one is changed
+	var valueErr error
+	_, err := p.store.UpdateChannelConfig(args.ChannelId, func(channelConfig *ChannelConfig) error {
+		valueErr = SetChannelConfigValue(channelConfig, key, value)
+		return valueErr
+	})
+	if valueErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: %s", valueErr.Error()),
+		}
+	}
+	if err != nil {
+		p.API.LogError("Failed to store channel configuration", "channel_id", args.ChannelId, "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Failed to store the settings of this channel",
+		}
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         p.GetChannelConfigMsg(args.ChannelId),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminList(args *model.CommandArgs) *model.CommandResponse {
+	channelID := args.ChannelId
+	if p.IsSystemAdmin(args.UserId) {
+		channelID = ""
+	} else if !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only admins are allowed to see the active pairings",
+		}
+	}
+
+	message, err := p.GetActivePairingsMsg(channelID, time.Now())
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminUnpair(args *model.CommandArgs) *model.CommandResponse {
+	isSystemAdmin := p.IsSystemAdmin(args.UserId)
+	if !isSystemAdmin && !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only admins are allowed to stop pairings",
+		}
+	}
+
+	userName := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminUnpair)))
+	user := p.GetUser(userName)
+	if user == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot find user '%s'", userName),
+		}
+	}
+
+	userData, err := p.store.GetUserData(user.Id)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	pairing, err := p.store.GetPairing(userData.ActivePairingID)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(userData.ActivePairingID) <= 0 || pairing == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: @%s is not paired with anyone", user.Username),
+		}
+	}
+	//channel admins can only manage the pairings of their own channel
+	if !isSystemAdmin && pairing.ChannelID != args.ChannelId {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: @%s has been paired in another channel", user.Username),
+		}
+	}
+
+	if p.CancelPairing(pairing) == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: The pairing has already been finished",
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Stopped the pairing of @%s", user.Username),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminPair(args *model.CommandArgs) *model.CommandResponse {
+	isSystemAdmin := p.IsSystemAdmin(args.UserId)
+	if !isSystemAdmin && !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only admins are allowed to pair users",
+		}
+	}
+
+	userNames := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminPair)))
+	if len(userNames) < MinGroupSize || len(userNames) > MaxGroupSize {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Please enter between %d and %d usernames", MinGroupSize, MaxGroupSize),
+		}
+	}
+	users := []*model.User{}
+	userIDs := []string{}
+	for _, userName := range userNames {
+		user := p.GetUser(userName)
+		if user == nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: Cannot find user '%s'", userName),
+			}
+		}
+		if ContainsString(userIDs, user.Id) {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: @%s has been given more than once", user.Username),
+			}
+		}
+		users = append(users, user)
+		userIDs = append(userIDs, user.Id)
+	}
+
+	data, err := p.store.ReadUsers(userIDs)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	now := time.Now()
+	for index, user := range users {
+		//channel admins can only pair members of their own channel
+		if !isSystemAdmin {
+			if _, appErr := p.API.GetChannelMember(args.ChannelId, user.Id); appErr != nil {
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					Text:         fmt.Sprintf("Error: @%s is not a member of this channel", user.Username),
+				}
+			}
+		}
+		if !IsParticipating(&data, user.Id, args.ChannelId, now) {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: @%s does not take part in the pairings of this channel", user.Username),
+			}
+		}
+		if _, ok := data.PendingInvitations[user.Id]; ok {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: @%s has a pending invitation", user.Username),
+			}
+		}
+		for _, otherUser := range users[index+1:] {
+			if IsBlacklisted(&data, user.Id, otherUser.Id) {
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					Text:         fmt.Sprintf("Error: @%s and @%s do not want to be paired with each other", user.Username, otherUser.Username),
+				}
+			}
+		}
+	}
+
+	if resp := p.StartPairing(args.ChannelId, users); resp != nil {
+		return resp
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Paired %s", strings.Join(userNames, ", ")),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminResetHistory(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to reset the history of a user",
+		}
+	}
+
+	userName := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminResetHistory)))
+	user := p.GetUser(userName)
+	if user == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot find user '%s'", userName),
+		}
+	}
+	if err := p.ResetHistory(user.Id); err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Removed the pairing history of @%s", user.Username),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminWipe(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to remove all data",
+		}
+	}
+
+	confirm := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminWipe)))
+	if confirm != flagConfirm {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("This removes all pairings, histories, topics, blacklists, schedules and channel settings. Use `/%s %s` if you are sure.", commandLunchbotAdminWipe, flagConfirm),
+		}
+	}
+	if err := p.store.Clear(); err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	p.API.LogInfo("All lunchbot data has been removed", "user_id", args.UserId)
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         "Removed all lunchbot data",
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminExport(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to export the data",
+		}
+	}
+
+	if err := p.SendExport(args.UserId); err != nil {
+		p.API.LogError("Failed to export the data", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot export the data: %s", err.Error()),
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         "I sent you the export as a direct message",
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminImport(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to import data",
+		}
+	}
+
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminImport)))
+	if len(params) <= 0 || (params[0] != ImportModeMerge && params[0] != ImportModeReplace) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text: fmt.Sprintf("Error: Please upload an export in your direct messages with lunchbot, then use `/%s %s` or `/%s %s %s`",
+				commandLunchbotAdminImport, ImportModeMerge, commandLunchbotAdminImport, ImportModeReplace, flagConfirm),
+		}
+	}
+	mode := params[0]
+	if mode == ImportModeReplace && (len(params) < 2 || params[1] != flagConfirm) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("This removes all existing lunchbot data before importing. Use `/%s %s %s` if you are sure.", commandLunchbotAdminImport, ImportModeReplace, flagConfirm),
+		}
+	}
+
+	content, err := p.FindImportFile(args.UserId)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: %s", err.Error()),
+		}
+	}
+	doc := &ExportDocument{}
+	if err := json.Unmarshal(content, doc); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: The file is not a lunchbot export: %s", err.Error()),
+		}
+	}
+	message, err := p.ImportData(doc, mode)
+	if err != nil {
+		p.API.LogError("Failed to import the data", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot import the data: %s", err.Error()),
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminReport(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to create reports",
+		}
+	}
+
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminReport)))
+	from, to, err := ParseReportRange(params, time.Now())
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: %s", err.Error()),
+		}
+	}
+	if err := p.SendReport(args.UserId, from, to); err != nil {
+		p.API.LogError("Failed to create the report", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot create the report: %s", err.Error()),
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         "I sent you the report as a direct message",
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminReplay(args *model.CommandArgs) *model.CommandResponse {
+	isSystemAdmin := p.IsSystemAdmin(args.UserId)
+	if !isSystemAdmin && !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only admins are allowed to replay pairing rounds",
+		}
+	}
+
+	roundID := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminReplay)))
+	if len(roundID) <= 0 {
+		rounds, err := p.store.GetRounds(args.ChannelId)
+		if err != nil {
+			return p.getStorageErrorResponse(err)
+		}
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         GetRoundsMsg(rounds),
+		}
+	}
+
+	round, err := p.store.GetRound(roundID)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	//channel admins can only replay the rounds of their own channel
+	if round == nil || (!isSystemAdmin && round.ChannelID != args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: There is no recorded round '%s' in this channel", roundID),
+		}
+	}
+
+	cache := NewUserCache(p.API)
+	getUsername := func(userID string) string {
+		if user, appErr := cache.GetUser(userID); appErr == nil {
+			return user.Username
+		}
+		return userID
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         GetReplayMsg(round, getUsername),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminFairness(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) && !p.IsChannelAdmin(args.UserId, args.ChannelId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only admins are allowed to see the fairness report",
+		}
+	}
+
+	members, appErr := NewUserCache(p.API).GetChannelMembers(args.ChannelId, 0)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Cannot get the members of this channel...",
+		}
+	}
+	data, err := p.store.ReadUsers(GetUserIDList(members))
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         GetFairnessReportMsg(&data, members, args.ChannelId, time.Now()),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotFinish(args *model.CommandArgs) *model.CommandResponse {
+	if _, err := p.API.GetUser(args.UserId); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Cannot get your user...",
+		}
+	}
+
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	pairing, err := p.store.GetPairing(userData.ActivePairingID)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(userData.ActivePairingID) <= 0 || pairing == nil {
+		if len(userData.ActivePairingID) > 0 {
+			//the pairing does not exist anymore, the user should not be marked as paired either
+			p.releasePairing(userData.ActivePairingID, []string{args.UserId})
+		}
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: You do not seem to be paired with another user",
+		}
+	}
+
+	//Remove from active sessions, only one of the users that finish at the same time gets to do this
+	pairing = p.releasePairing(pairing.ID, pairing.UserIDs)
+	if pairing == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Your pairing has already been finished",
+		}
+	}
+	pairedUserIDs := pairing.UserIDs
+
+	//Add to the history of pairings, needed to avoid users getting paired again immediately
+	p.recordHistory(NewPairingHistoryEntry(pairing, OutcomeFinished))
+
+	//notify all users that their pairing has been stopped
+	resp := p.SendGroupMessage("Your session has been finished! Thanks a lot for using Lunchbot :sunglasses:", pairedUserIDs)
+	if resp != nil {
+		return resp
+	}
+
+	return &model.CommandResponse{}
+}
+
+func (p *Plugin) executeCommandLunchbotExtend(args *model.CommandArgs) *model.CommandResponse {
+	userData, err := p.store.GetUserData(args.UserId)
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(userData.ActivePairingID) <= 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: You do not seem to be paired with another user",
+		}
+	}
+
+	pairing, err := p.ExtendPairing(userData.ActivePairingID, time.Now())
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if pairing == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Your pairing has already been finished",
+		}
+	}
+
+	expiresAt := pairing.GetExpiresAt(p.getConfiguration().GetPairingTimeToLive())
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Your pairing has been extended until %s", expiresAt.UTC().Format("2006-01-02 15:04 MST")),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbot(args *model.CommandArgs) *model.CommandResponse {
+	cache := NewUserCache(p.API)
+	triggerUser, err := cache.GetUser(args.UserId)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Cannot get your user...",
+		}
+	}
+
+	//is this user already paired?
+	userData, storageErr := p.store.GetUserData(triggerUser.Id)
+	if storageErr != nil {
+		return p.getStorageErrorResponse(storageErr)
+	}
+	pairing, storageErr := p.store.GetPairing(userData.ActivePairingID)
+	if storageErr != nil {
+		return p.getStorageErrorResponse(storageErr)
+	}
+	if len(userData.ActivePairingID) > 0 && pairing != nil {
+		names := []string{}
+		for _, userID := range pairing.UserIDs {
+			if userID == triggerUser.Id {
+				continue
+			}
+			if otherUser, err := cache.GetUser(userID); err == nil {
+				names = append(names, "@"+otherUser.GetDisplayName(""))
+			}
+		}
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: You are already paired with %s. Please finish that pairing with `/lunchbot finish`.", strings.Join(names, ", ")),
+		}
+	}
+
+	//is this user waiting for an answer to an invitation?
+	if len(userData.PendingInvitationID) > 0 {
+		invitation, storageErr := p.store.GetInvitation(userData.PendingInvitationID)
+		if storageErr != nil {
+			return p.getStorageErrorResponse(storageErr)
+		}
+		if invitation != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         "Error: " + p.GetInvitationStatusMsg(invitation, triggerUser.Id),
+			}
+		}
+	}
+
+	groupSize := p.GetChannelSettings(args.ChannelId).GroupSize
+	givenGroupSize := strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotGo))
+	givenGroupSize = strings.TrimSpace(strings.TrimPrefix(givenGroupSize, fmt.Sprintf("/%s", commandLunchbot)))
+	if len(givenGroupSize) > 0 {
+		var parseErr error
+		if groupSize, parseErr = ParseGroupSize(givenGroupSize); parseErr != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				Text:         fmt.Sprintf("Error: %s", parseErr.Error()),
+			}
+		}
+	}
+
+	//the chosen users need to accept the invitation before the pairing starts
+	invitation, inviteErr := p.InviteGroupForUserID(args.ChannelId, triggerUser.Id, groupSize, nil)
+	if inviteErr != nil {
+		p.API.LogDebug("Failed to invite a group", "user_id", triggerUser.Id, "err", inviteErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Cannot match you with a user from this channel",
+		}
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         p.GetInvitationStatusMsg(invitation, triggerUser.Id),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminTopicsAdd(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to change the topic catalogue",
+		}
+	}
+
+	givenTopic := strings.Join(strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminTopicsAdd))), " ")
+	if len(givenTopic) <= 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Please enter a valid topic",
+		}
+	}
+	_, err := p.store.UpdateTopicCatalogue(func(catalogue map[string]*CatalogueTopic) error {
+		givenTopic = AddToCatalogue(catalogue, givenTopic, true, model.GetMillis())
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Added '%s' to the topic catalogue", givenTopic),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminTopicsRemove(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to change the topic catalogue",
+		}
+	}
+
+	givenTopic := strings.Join(strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminTopicsRemove))), " ")
+	removedTopic := ""
+	_, err := p.store.UpdateTopicCatalogue(func(catalogue map[string]*CatalogueTopic) error {
+		removedTopic = ""
+		if catalogueTopic, ok := catalogue[NormalizeTopic(givenTopic)]; ok {
+			removedTopic = catalogueTopic.Name
+			delete(catalogue, NormalizeTopic(givenTopic))
+		}
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if len(removedTopic) <= 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: The topic catalogue does not contain '%s'", givenTopic),
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Removed '%s' from the topic catalogue. Users that are interested in it keep it in their topics.", removedTopic),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminQuestionsList(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to manage the icebreaker questions",
+		}
+	}
+
+	category := strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminQuestionsList)))
+	message, err := p.GetQuestionListMsg(category)
+	if err != nil {
+		message = "Error: " + err.Error()
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         message,
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminQuestionsAdd(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to manage the icebreaker questions",
+		}
+	}
+
+	params := strings.Fields(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminQuestionsAdd)))
+	if len(params) < 2 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Please enter a category and a question, e.g. `/%s food Pizza or pasta?`", commandLunchbotAdminQuestionsAdd),
+		}
+	}
+	question := &Question{
+		ID:        model.NewId(),
+		Category:  NormalizeCategory(params[0]),
+		Text:      strings.Join(params[1:], " "),
+		CreatedAt: model.GetMillis(),
+	}
+	_, err := p.store.UpdateQuestions(func(questions map[string]*Question) error {
+		questions[question.ID] = question
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Added the question '%s' to the category %s", question.Text, question.Category),
+	}
+}
+
+func (p *Plugin) executeCommandLunchbotAdminQuestionsRemove(args *model.CommandArgs) *model.CommandResponse {
+	if !p.IsSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Only system admins are allowed to manage the icebreaker questions",
+		}
+	}
+
+	questionID := strings.Trim(strings.TrimSpace(strings.TrimPrefix(args.Command, fmt.Sprintf("/%s", commandLunchbotAdminQuestionsRemove))), "`")
+	if strings.HasPrefix(questionID, builtinQuestionPrefix) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Error: Built-in questions cannot be removed",
+		}
+	}
+	var removed *Question
+	_, err := p.store.UpdateQuestions(func(questions map[string]*Question) error {
+		removed = questions[questionID]
+		delete(questions, questionID)
+		return nil
+	})
+	if err != nil {
+		return p.getStorageErrorResponse(err)
+	}
+	if removed == nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot find the question '%s'", questionID),
+		}
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         fmt.Sprintf("Removed the question '%s'", removed.Text),
+	}
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExecuteCommandLunchbotTopics(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(&LunchbotData{})
+	args := func(command string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: "1", ChannelId: "channel", Command: "/" + command}
+	}
+
+	resp := plugin.executeCommandLunchbotTopicsShow(args(commandLunchbotTopicsShow))
+	assert.Contains(t, resp.Text, "There are no topics set yet")
+
+	resp = plugin.executeCommandLunchbotTopicsAdd(args(commandLunchbotTopicsAdd + " Cooking"))
+	assert.Equal(t, "Added 'Cooking' to your topics", resp.Text)
+	resp = plugin.executeCommandLunchbotTopicsAdd(args(commandLunchbotTopicsAdd + " cooking "))
+	assert.Equal(t, "'Cooking' already is one of your topics", resp.Text)
+	resp = plugin.executeCommandLunchbotTopicsShow(args(commandLunchbotTopicsShow))
+	assert.Equal(t, "Your topics:\n  - Cooking\n", resp.Text)
+
+	resp = plugin.executeCommandLunchbotTopicsRemove(args(commandLunchbotTopicsRemove + " Skiing"))
+	assert.Equal(t, "Error: Cannot remove 'Skiing' from your topics.", resp.Text)
+	resp = plugin.executeCommandLunchbotTopicsRemove(args(commandLunchbotTopicsRemove + " COOKING"))
+	assert.Equal(t, "Removed 'COOKING' from your topics", resp.Text)
+
+	userData, _ := plugin.store.GetUserData("1")
+	assert.Empty(t, userData.Topics)
+
+	//new topics are spelled like the topic catalogue
+	resp = plugin.executeCommandLunchbotTopicsAdd(args(commandLunchbotTopicsAdd + " cooking"))
+	assert.Equal(t, "Added 'Cooking' to your topics", resp.Text)
+	resp = plugin.executeCommandLunchbotTopicsPopular(args(commandLunchbotTopicsPopular))
+	assert.Equal(t, "The most popular topics:\n  - Cooking (1 user)\n", resp.Text)
+}
+
+func TestExecuteCommandLunchbotParticipation(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(&LunchbotData{})
+	args := func(command string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: "1", ChannelId: "channel", Command: "/" + command}
+	}
+
+	resp := plugin.executeCommandLunchbotStatus(args(commandLunchbotStatus))
+	assert.Equal(t, fmt.Sprintf("You have not joined lunchbot yet. Use `/%s` to join.", commandLunchbotJoin), resp.Text)
+
+	resp = plugin.executeCommandLunchbotJoin(args(commandLunchbotJoin + " " + scopeGlobal))
+	assert.Equal(t, "You joined the pairings of every channel", resp.Text)
+	resp = plugin.executeCommandLunchbotLeave(args(commandLunchbotLeave))
+	assert.Equal(t, "You left the pairings of this channel", resp.Text)
+
+	userData, _ := plugin.store.GetUserData("1")
+	assert.True(t, userData.Participation.Joined)
+	assert.Equal(t, map[string]bool{"channel": false}, userData.Participation.Channels)
+	assert.NotZero(t, userData.Participation.JoinedAt)
+
+	resp = plugin.executeCommandLunchbotStatus(args(commandLunchbotStatus))
+	assert.Contains(t, resp.Text, "You currently cannot get paired in this channel.")
+
+	resp = plugin.executeCommandLunchbotPause(args(commandLunchbotPause + " 1w"))
+	assert.Contains(t, resp.Text, "You will not get paired until")
+	userData, _ = plugin.store.GetUserData("1")
+	assert.NotZero(t, userData.Participation.PausedUntil)
+
+	resp = plugin.executeCommandLunchbotJoin(args(commandLunchbotJoin + " everywhere"))
+	assert.Contains(t, resp.Text, "Error: Unknown scope 'everywhere'")
+
+	resp = plugin.executeCommandLunchbotAvailabilitySet(args(commandLunchbotAvailabilitySet + " mon-fri"))
+	assert.Contains(t, resp.Text, "Error: Please enter the days and hours")
+	resp = plugin.executeCommandLunchbotAvailabilitySet(args(commandLunchbotAvailabilitySet + " mon-wed 11:30-14:00"))
+	assert.Equal(t, "You will only get paired on Mon, Tue, Wed from 11:30 to 14:00 in your timezone.", resp.Text)
+	resp = plugin.executeCommandLunchbotAvailabilityShow(args(commandLunchbotAvailabilityShow))
+	assert.Equal(t, "You can get paired on Mon, Tue, Wed from 11:30 to 14:00 in your timezone.", resp.Text)
+	resp = plugin.executeCommandLunchbotStatus(args(commandLunchbotStatus))
+	assert.Contains(t, resp.Text, "You can get paired on Mon, Tue, Wed from 11:30 to 14:00 in your timezone.")
+	resp = plugin.executeCommandLunchbotAvailabilityClear(args(commandLunchbotAvailabilityClear))
+	assert.Equal(t, "You can get paired at any time again.", resp.Text)
+	userData, _ = plugin.store.GetUserData("1")
+	assert.Nil(t, userData.Participation.Availability)
+}
+
+func TestExecuteCommandLunchbotAdmin(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_SYSTEM).Return(false)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "channel", model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Return()
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{
+		UserTopics: map[string]map[string]struct{}{"1": map[string]struct{}{"Cooking": struct{}{}}},
+	})
+	args := func(userID string, command string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: userID, ChannelId: "channel", Command: "/" + command}
+	}
+
+	resp := plugin.executeCommandLunchbotAdminList(args("1", commandLunchbotAdminList))
+	assert.Equal(t, "Error: Only admins are allowed to see the active pairings", resp.Text)
+	resp = plugin.executeCommandLunchbotAdminWipe(args("1", commandLunchbotAdminWipe+" "+flagConfirm))
+	assert.Equal(t, "Error: Only system admins are allowed to remove all data", resp.Text)
+
+	resp = plugin.executeCommandLunchbotAdminWipe(args("admin", commandLunchbotAdminWipe))
+	assert.Contains(t, resp.Text, "if you are sure")
+	userData, _ := plugin.store.GetUserData("1")
+	assert.NotEmpty(t, userData.Topics)
+
+	resp = plugin.executeCommandLunchbotAdminWipe(args("admin", commandLunchbotAdminWipe+" "+flagConfirm))
+	assert.Equal(t, "Removed all lunchbot data", resp.Text)
+	userData, _ = plugin.store.GetUserData("1")
+	assert.Empty(t, userData.Topics)
+}
+
+func TestExecuteCommandLunchbotAdminReplay(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_SYSTEM).Return(false)
+	api.On("HasPermissionToChannel", "channeladmin", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(true)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(func(userID string) *model.User { return &model.User{Id: userID, Username: "user" + userID} }, nil)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{})
+
+	users, data, departments := getRoundTestData()
+	input := NewRoundInput(newTestMatchContext(data, departments, 0), MatchStrategyWeightedRandom, users, nil)
+	groups, unmatched := input.Match(42, 2)
+	assert.Nil(t, plugin.store.SaveRound(&Round{ID: "round", ChannelID: "channel", Seed: 42, GroupSize: 2, Input: input, Groups: groups, Unmatched: unmatched}))
+	args := func(userID string, channelID string, command string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: userID, ChannelId: channelID, Command: "/" + command}
+	}
+
+	resp := plugin.executeCommandLunchbotAdminReplay(args("1", "channel", commandLunchbotAdminReplay+" round"))
+	assert.Equal(t, "Error: Only admins are allowed to replay pairing rounds", resp.Text)
+
+	resp = plugin.executeCommandLunchbotAdminReplay(args("channeladmin", "channel", commandLunchbotAdminReplay))
+	assert.Contains(t, resp.Text, "`round`")
+	resp = plugin.executeCommandLunchbotAdminReplay(args("channeladmin", "channel", commandLunchbotAdminReplay+" round"))
+	assert.Contains(t, resp.Text, "results in the same groups")
+	assert.Contains(t, resp.Text, "@user")
+
+	//channel admins cannot replay rounds of other channels
+	resp = plugin.executeCommandLunchbotAdminReplay(args("channeladmin", "other", commandLunchbotAdminReplay+" round"))
+	assert.Equal(t, "Error: There is no recorded round 'round' in this channel", resp.Text)
+	resp = plugin.executeCommandLunchbotAdminReplay(args("admin", "other", commandLunchbotAdminReplay+" round"))
+	assert.Contains(t, resp.Text, "results in the same groups")
+	resp = plugin.executeCommandLunchbotAdminReplay(args("admin", "other", commandLunchbotAdminReplay+" unknown"))
+	assert.Equal(t, "Error: There is no recorded round 'unknown' in this channel", resp.Text)
+}
+
+func TestExecuteCommandLunchbotAdminFairness(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_SYSTEM).Return(false)
+	api.On("HasPermissionToChannel", "channeladmin", "channel", model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(true)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	users := []*model.User{&model.User{Id: "1", Username: "one"}, &model.User{Id: "2", Username: "two"}}
+	api.On("GetUsersInChannel", "channel", mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{Participations: getJoinedParticipations("1")})
+	args := func(userID string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: userID, ChannelId: "channel", Command: "/" + commandLunchbotAdminFairness}
+	}
+
+	resp := plugin.executeCommandLunchbotAdminFairness(args("1"))
+	assert.Equal(t, "Error: Only admins are allowed to see the fairness report", resp.Text)
+	resp = plugin.executeCommandLunchbotAdminFairness(args("channeladmin"))
+	assert.Equal(t, "Participants of this channel that have been waiting the longest for a pairing (1):\n  - @one: never paired, goes first with priority 1000\n", resp.Text)
+}
+
+func TestExecuteCommandLunchbotAdminPair_rejected(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_SYSTEM).Return(false)
+	api.On("HasPermissionToChannel", "channeladmin", "channel", model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(true)
+	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	api.On("GetUserByUsername", mock.AnythingOfType("string")).Return(func(userName string) *model.User { return &model.User{Id: userName, Username: userName} }, nil)
+	api.On("GetChannelMember", "channel", "outsider").Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannelMember", "channel", mock.AnythingOfType("string")).Return(&model.ChannelMember{}, nil)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{
+		Participations:     getJoinedParticipations("1", "2", "3", "invited", "outsider"),
+		PendingInvitations: map[string]string{"invited": "invitation"},
+		Blacklists:         map[string]map[string]struct{}{"3": map[string]struct{}{"1": struct{}{}}},
+	})
+	args := func(userID string, userNames string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: userID, ChannelId: "channel", Command: "/" + commandLunchbotAdminPair + " " + userNames}
+	}
+
+	resp := plugin.executeCommandLunchbotAdminPair(args("1", "1 2"))
+	assert.Equal(t, "Error: Only admins are allowed to pair users", resp.Text)
+
+	t.Run("Channel admins can only pair members of their channel", func(t *testing.T) {
+		resp := plugin.executeCommandLunchbotAdminPair(args("channeladmin", "1 outsider"))
+		assert.Equal(t, "Error: @outsider is not a member of this channel", resp.Text)
+	})
+
+	t.Run("Users that do not take part", func(t *testing.T) {
+		resp := plugin.executeCommandLunchbotAdminPair(args("admin", "1 stranger"))
+		assert.Equal(t, "Error: @stranger does not take part in the pairings of this channel", resp.Text)
+	})
+
+	t.Run("Users with a pending invitation", func(t *testing.T) {
+		resp := plugin.executeCommandLunchbotAdminPair(args("channeladmin", "invited 2"))
+		assert.Equal(t, "Error: @invited has a pending invitation", resp.Text)
+	})
+
+	t.Run("Blacklisted users", func(t *testing.T) {
+		resp := plugin.executeCommandLunchbotAdminPair(args("admin", "1 2 3"))
+		assert.Equal(t, "Error: @1 and @3 do not want to be paired with each other", resp.Text)
+	})
+
+	data, _ := plugin.store.ReadAll()
+	assert.Empty(t, data.Pairings)
+}
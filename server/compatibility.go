@@ -0,0 +1,306 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//noEdge is the weight between users that must not be matched with each other
+	noEdge = -1
+	//maxImprovementPasses limits how often the groups are searched for swaps that increase their weight
+	maxImprovementPasses = 50
+)
+
+// CompatibilityGraph contains how well every pair of the given users fits together. Users are referred to by their index,
+// pairs with a blacklist conflict have no edge.
+type CompatibilityGraph struct {
+	Users   []*model.User
+	indices map[string]int //Key: UserID, Value: index of the user
+	weights []int32        //Weight between user i and user j > i, the edges of user i start at i*(len(Users)-1)-i*(i-1)/2
+}
+
+// NewCompatibilityGraph rates every pair of the given users with the scorers of the given matcher. The weight of a pair i < j is the score
+// user j gets for a group that only contains user i.
+func NewCompatibilityGraph(ctx *MatchContext, matcher *Matcher, users []*model.User) *CompatibilityGraph {
+	count := len(users)
+	graph := &CompatibilityGraph{
+		Users:   users,
+		indices: make(map[string]int, count),
+		weights: make([]int32, count*(count-1)/2),
+	}
+	for index, user := range users {
+		graph.indices[user.Id] = index
+	}
+	for _, scorer := range matcher.Scorers {
+		if graphScorer, ok := scorer.(GraphScorer); ok {
+			graphScorer.AddScores(ctx, graph)
+			continue
+		}
+		for i := 0; i < count; i++ {
+			group := []string{users[i].Id}
+			for j := i + 1; j < count; j++ {
+				graph.AddWeight(i, j, int32(scorer.Score(ctx, group, users[j].Id)))
+			}
+		}
+	}
+
+	//only the users that have a blacklist are looked at, instead of checking every pair
+	for i, user := range users {
+		for otherUserID := range ctx.Data.Blacklists[user.Id] {
+			if j, ok := graph.indices[otherUserID]; ok && j != i {
+				graph.weights[graph.edge(i, j)] = noEdge
+			}
+		}
+	}
+	return graph
+}
+
+// edge returns the position of the edge between the given different users in the weights
+func (g *CompatibilityGraph) edge(user int, otherUser int) int {
+	if user > otherUser {
+		user, otherUser = otherUser, user
+	}
+	return user*(len(g.Users)-1) - user*(user-1)/2 + otherUser - user - 1
+}
+
+// Index returns the index of the user with the given ID, false if the user is not part of the graph
+func (g *CompatibilityGraph) Index(userID string) (int, bool) {
+	index, ok := g.indices[userID]
+	return index, ok
+}
+
+// AddWeight adds the given weight to the edge between the given different users
+func (g *CompatibilityGraph) AddWeight(user int, otherUser int, weight int32) {
+	g.weights[g.edge(user, otherUser)] += weight
+}
+
+// AddWeightToAll adds the given weight to the edges between all users
+func (g *CompatibilityGraph) AddWeightToAll(weight int32) {
+	for index := range g.weights {
+		g.weights[index] += weight
+	}
+}
+
+// Weight returns the weight of the edge between the given users, noEdge if they must not be matched with each other
+func (g *CompatibilityGraph) Weight(user int, otherUser int) int32 {
+	if user == otherUser {
+		return noEdge
+	}
+	return g.weights[g.edge(user, otherUser)]
+}
+
+// GetJoinWeight returns how much the weight of the given group increases if the given user joins it in place of the replaced member.
+// Use -1 if no member is replaced. Returns false if the user has no edge to one of the remaining members.
+func (g *CompatibilityGraph) GetJoinWeight(group []int, user int, replaced int) (int64, bool) {
+	weight := int64(0)
+	for _, member := range group {
+		if member == replaced || member == user {
+			continue
+		}
+		edge := g.Weight(member, user)
+		if edge == noEdge {
+			return 0, false
+		}
+		weight += int64(edge)
+	}
+	return weight, true
+}
+
+// GetGroupWeight returns the sum of the weights between all members of the given group
+func (g *CompatibilityGraph) GetGroupWeight(group []int) int64 {
+	weight := int64(0)
+	for index, member := range group {
+		for _, otherMember := range group[index+1:] {
+			weight += int64(g.Weight(member, otherMember))
+		}
+	}
+	return weight
+}
+
+// FillGroup adds candidates to the given group until it has the given size or nobody is left that can join it, the given strategy picks among them.
+// This works like Matcher.FillGroup, but the scores of the candidates are taken from the graph instead of scoring them again. Returns the added users.
+func (g *CompatibilityGraph) FillGroup(ctx *MatchContext, strategy MatchStrategy, group []int, candidates []int, groupSize int) []int {
+	members := make([]int, len(group))
+	copy(members, group)
+	memberIDs := []string{}
+	for _, member := range members {
+		memberIDs = append(memberIDs, g.Users[member].Id)
+	}
+	picked := []int{}
+	scored := make([]ScoredCandidate, 0, len(candidates))
+	scoredUsers := make([]int, 0, len(candidates))
+	for len(members) < groupSize {
+		scored, scoredUsers = scored[:0], scoredUsers[:0]
+		for _, candidate := range candidates {
+			if ContainsInt(members, candidate) {
+				continue
+			}
+			if weight, ok := g.GetJoinWeight(members, candidate, -1); ok {
+				scored = append(scored, ScoredCandidate{User: g.Users[candidate], Score: uint(weight)})
+				scoredUsers = append(scoredUsers, candidate)
+			}
+		}
+		if len(scored) <= 0 {
+			break
+		}
+
+		user := strategy.Pick(ctx, memberIDs, scored)
+		for index, candidate := range scored {
+			if candidate.User == user {
+				members = append(members, scoredUsers[index])
+				memberIDs = append(memberIDs, user.Id)
+				picked = append(picked, scoredUsers[index])
+				break
+			}
+		}
+	}
+	return picked
+}
+
+// getSwapGain returns how much the total weight of both groups increases if the given members swap their groups. Returns 0 if they cannot swap.
+func (g *CompatibilityGraph) getSwapGain(group []int, otherGroup []int, member int, otherMember int) int64 {
+	newWeight, ok := g.GetJoinWeight(group, otherMember, member)
+	if !ok {
+		return 0
+	}
+	otherNewWeight, ok := g.GetJoinWeight(otherGroup, member, otherMember)
+	if !ok {
+		return 0
+	}
+	oldWeight, _ := g.GetJoinWeight(group, member, -1)
+	otherOldWeight, _ := g.GetJoinWeight(otherGroup, otherMember, -1)
+	return newWeight + otherNewWeight - oldWeight - otherOldWeight
+}
+
+// ImproveGroups swaps members between the given groups as long as a swap increases the total weight of the groups.
+// The groups keep their sizes and no swap creates a blacklist conflict.
+func (g *CompatibilityGraph) ImproveGroups(groups [][]int) {
+	for pass := 0; pass < maxImprovementPasses; pass++ {
+		improved := false
+		for index := range groups {
+			for otherIndex := index + 1; otherIndex < len(groups); otherIndex++ {
+				group, otherGroup := groups[index], groups[otherIndex]
+				for memberIndex := range group {
+					for otherMemberIndex := range otherGroup {
+						if g.getSwapGain(group, otherGroup, group[memberIndex], otherGroup[otherMemberIndex]) > 0 {
+							group[memberIndex], otherGroup[otherMemberIndex] = otherGroup[otherMemberIndex], group[memberIndex]
+							improved = true
+						}
+					}
+				}
+			}
+		}
+		if !improved {
+			return
+		}
+	}
+}
+
+// GroupGreedily splits the users of the graph into groups of the given size. Starting with the first user, every group is filled one after another
+// with the users that increase its weight the most. Users that are left over are handled like MatchUsers does, but join the group they fit in best.
+// Returns the groups and the users that could not be matched with anyone.
+func (g *CompatibilityGraph) GroupGreedily(groupSize int) ([][]int, []int) {
+	groups := [][]int{}
+	matched := make([]bool, len(g.Users))
+	buildGroups := func(candidates []int, groupSize int) []int {
+		for _, user := range candidates {
+			if matched[user] {
+				continue
+			}
+
+			matched[user] = true
+			group := []int{user}
+			for len(group) < groupSize {
+				bestUser, bestWeight := -1, int64(-1)
+				for _, candidate := range candidates {
+					if matched[candidate] {
+						continue
+					}
+					if weight, ok := g.GetJoinWeight(group, candidate, -1); ok && weight > bestWeight {
+						bestUser, bestWeight = candidate, weight
+					}
+				}
+				if bestUser < 0 {
+					break
+				}
+				group = append(group, bestUser)
+				matched[bestUser] = true
+			}
+
+			if len(group) < groupSize {
+				//the group cannot be filled, its members are left over
+				for _, member := range group {
+					matched[member] = false
+				}
+				continue
+			}
+			groups = append(groups, group)
+		}
+
+		remainingUsers := []int{}
+		for _, user := range candidates {
+			if !matched[user] {
+				remainingUsers = append(remainingUsers, user)
+			}
+		}
+		return remainingUsers
+	}
+
+	allUsers := make([]int, len(g.Users))
+	for index := range allUsers {
+		allUsers[index] = index
+	}
+	leftovers := buildGroups(allUsers, groupSize)
+
+	//if there are enough users left over they get a smaller group of their own
+	if len(leftovers) >= MinGroupSize && len(leftovers) >= groupSize/2 {
+		leftovers = buildGroups(leftovers, len(leftovers))
+	}
+
+	//instead of leaving someone out, add them to the group they fit in best
+	unmatched := []int{}
+	for _, user := range leftovers {
+		bestGroup, bestWeight := -1, int64(-1)
+		for index, group := range groups {
+			if len(group) > groupSize {
+				continue
+			}
+			if weight, ok := g.GetJoinWeight(group, user, -1); ok && weight > bestWeight {
+				bestGroup, bestWeight = index, weight
+			}
+		}
+		if bestGroup < 0 {
+			unmatched = append(unmatched, user)
+			continue
+		}
+		groups[bestGroup] = append(groups[bestGroup], user)
+	}
+	return groups, unmatched
+}
+
+// MatchOptimally splits the given users into groups of the given size, aiming for a total weight of all groups that is as high as possible.
+// The weight of a group is the sum of the weights between all of its members, as rated by the scorers of the given matcher.
+// The groups are built greedily first, then members are swapped between the groups as long as this increases the total weight.
+// This is an approximation that stays fast in large channels: the result cannot be improved by swapping two users, but a better matching might still exist.
+// The random source of the context only decides between equally good groups.
+// Returns the matched groups and the users that could not be matched with anyone.
+func MatchOptimally(ctx *MatchContext, matcher *Matcher, users []*model.User, groupSize int, queued map[string]struct{}) ([][]*model.User, []*model.User) {
+	sortedUsers := SortUsersForMatching(ctx, users, queued)
+	graph := NewCompatibilityGraph(ctx, matcher, sortedUsers)
+	groups, unmatchedUsers := graph.GroupGreedily(groupSize)
+	graph.ImproveGroups(groups)
+
+	userGroups := [][]*model.User{}
+	for _, group := range groups {
+		userGroup := []*model.User{}
+		for _, member := range group {
+			userGroup = append(userGroup, sortedUsers[member])
+		}
+		userGroups = append(userGroups, userGroup)
+	}
+	unmatched := []*model.User{}
+	for _, user := range unmatchedUsers {
+		unmatched = append(unmatched, sortedUsers[user])
+	}
+	return userGroups, unmatched
+}
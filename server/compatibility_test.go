@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// getCompatibilityTestData returns four users and data in which A and B share a topic and C and D have been paired recently.
+// Matching greedily from A pairs A with B and leaves C and D with each other.
+func getCompatibilityTestData() ([]*model.User, *LunchbotData) {
+	users := getTestUsers("A", "B", "C", "D")
+	data := &LunchbotData{
+		History: map[string][]*HistoryEntry{
+			"C": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"C", "D"}, Outcome: OutcomeFinished}},
+			"D": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"C", "D"}, Outcome: OutcomeFinished}},
+		},
+		UserTopics: map[string]map[string]struct{}{
+			"A": map[string]struct{}{"Cooking": struct{}{}},
+			"B": map[string]struct{}{"Cooking": struct{}{}},
+		},
+	}
+	return users, data
+}
+
+// getGroupIDs returns the user IDs of the given groups, each group in alphabetical order
+func getGroupIDs(groups [][]*model.User) []string {
+	groupIDs := []string{}
+	for _, group := range groups {
+		userIDs := GetUserIDList(group)
+		sort.Strings(userIDs)
+		groupIDs = append(groupIDs, fmt.Sprint(userIDs))
+	}
+	return groupIDs
+}
+
+func TestCompatibilityGraph(t *testing.T) {
+	users, data := getCompatibilityTestData()
+	data.Blacklists = map[string]map[string]struct{}{"A": map[string]struct{}{"D": struct{}{}}}
+	ctx := newTestMatchContext(data, nil, 1)
+	graph := NewCompatibilityGraph(ctx, NewMatcher(NewConnectionsStrategy{}), users)
+
+	newUserWeight := int32(ctx.Config.NewUserWeight)
+	assert.Equal(t, newUserWeight+int32(ctx.Config.SharedTopicWeight), graph.Weight(0, 1))
+	assert.Equal(t, graph.Weight(0, 1), graph.Weight(1, 0))
+	assert.Equal(t, int32(1), graph.Weight(2, 3))
+	assert.Equal(t, int32(noEdge), graph.Weight(0, 3))
+	assert.Equal(t, int32(noEdge), graph.Weight(0, 0))
+
+	weight, ok := graph.GetJoinWeight([]int{0, 1}, 2, -1)
+	assert.True(t, ok)
+	assert.Equal(t, 2*int64(newUserWeight), weight)
+	_, ok = graph.GetJoinWeight([]int{0, 1}, 3, -1)
+	assert.False(t, ok)
+	//D can take the place of A
+	weight, ok = graph.GetJoinWeight([]int{0, 1}, 3, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(newUserWeight), weight)
+	assert.Equal(t, int64(graph.Weight(0, 1)+graph.Weight(0, 2)+graph.Weight(1, 2)), graph.GetGroupWeight([]int{0, 1, 2}))
+}
+
+func TestCompatibilityGraph_graphScorers(t *testing.T) {
+	users, data, departments := getLargeMatchingData(60)
+	data.Blacklists = map[string]map[string]struct{}{
+		"user3": map[string]struct{}{"user5": struct{}{}, "user40": struct{}{}},
+		"user5": map[string]struct{}{"user3": struct{}{}},
+	}
+	departments["user7"] = []string{"department 7", "Department 8"}
+	delete(departments, "user8")
+	departments["user9"] = []string{}
+	ctx := newTestMatchContext(data, departments, 1)
+	matcher := NewMatcher(WeightedRandomStrategy{})
+
+	//scoring all pairs at once gives the same weights as scoring one pair after another
+	graph := NewCompatibilityGraph(ctx, matcher, users)
+	for i := range users {
+		for j := i + 1; j < len(users); j++ {
+			expected := int32(noEdge)
+			if !IsBlacklisted(data, users[i].Id, users[j].Id) {
+				expected = int32(matcher.Score(ctx, []string{users[i].Id}, users[j].Id))
+			}
+			assert.Equal(t, expected, graph.Weight(i, j), "%s and %s", users[i].Id, users[j].Id)
+		}
+	}
+}
+
+func TestImproveGroups(t *testing.T) {
+	users, data := getCompatibilityTestData()
+	graph := NewCompatibilityGraph(newTestMatchContext(data, nil, 1), NewMatcher(NewConnectionsStrategy{}), users)
+
+	groups := [][]int{[]int{0, 1}, []int{2, 3}}
+	graph.ImproveGroups(groups)
+	assert.Equal(t, 2*int64(newConfiguration().NewUserWeight), graph.GetGroupWeight(groups[0])+graph.GetGroupWeight(groups[1]))
+
+	//swaps never create blacklist conflicts
+	data.Blacklists = map[string]map[string]struct{}{"A": map[string]struct{}{"C": struct{}{}, "D": struct{}{}}}
+	graph = NewCompatibilityGraph(newTestMatchContext(data, nil, 1), NewMatcher(NewConnectionsStrategy{}), users)
+	groups = [][]int{[]int{0, 1}, []int{2, 3}}
+	graph.ImproveGroups(groups)
+	assert.Equal(t, [][]int{[]int{0, 1}, []int{2, 3}}, groups)
+}
+
+func TestGroupGreedily(t *testing.T) {
+	users, data := getCompatibilityTestData()
+	graph := NewCompatibilityGraph(newTestMatchContext(data, nil, 1), NewMatcher(NewConnectionsStrategy{}), users)
+
+	//greedily, A gets its best partner B, which leaves C and D with each other although they have been paired recently
+	groups, unmatched := graph.GroupGreedily(2)
+	assert.Equal(t, [][]int{[]int{0, 1}, []int{2, 3}}, groups)
+	assert.Empty(t, unmatched)
+	greedyWeight := graph.GetGroupWeight(groups[0]) + graph.GetGroupWeight(groups[1])
+
+	//swapping fixes this, the groups lose the shared topic but both make a new connection
+	graph.ImproveGroups(groups)
+	assert.NotContains(t, groups, []int{2, 3})
+	assert.Greater(t, graph.GetGroupWeight(groups[0])+graph.GetGroupWeight(groups[1]), greedyWeight)
+
+	//a user that cannot join any group is left out
+	graph = NewCompatibilityGraph(newTestMatchContext(&LunchbotData{
+		Blacklists: map[string]map[string]struct{}{"E": map[string]struct{}{"A": struct{}{}, "C": struct{}{}}},
+	}, nil, 1), NewMatcher(NewConnectionsStrategy{}), getTestUsers("A", "B", "C", "D", "E"))
+	groups, unmatched = graph.GroupGreedily(2)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, []int{4}, unmatched)
+}
+
+func TestMatchOptimally(t *testing.T) {
+	t.Run("Avoids leaving repeat partners for the end", func(t *testing.T) {
+		users, data := getCompatibilityTestData()
+		for seed := int64(0); seed < 20; seed++ {
+			groups, unmatched := MatchOptimally(newTestMatchContext(data, nil, seed), NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+			assert.Empty(t, unmatched)
+			assert.Len(t, groups, 2)
+			assert.NotContains(t, getGroupIDs(groups), "[C D]")
+		}
+	})
+
+	t.Run("Same seed results in the same groups", func(t *testing.T) {
+		users := getTestUsers("1", "2", "3", "4", "5", "6", "7", "8", "9")
+		groups, _ := MatchOptimally(newTestMatchContext(&LunchbotData{}, nil, 42), NewMatcher(NewConnectionsStrategy{}), users, 3, nil)
+		otherGroups, _ := MatchOptimally(newTestMatchContext(&LunchbotData{}, nil, 42), NewMatcher(NewConnectionsStrategy{}), users, 3, nil)
+		assert.Equal(t, groups, otherGroups)
+		assert.Len(t, groups, 3)
+	})
+
+	t.Run("Blacklists are respected", func(t *testing.T) {
+		data := &LunchbotData{
+			Blacklists: map[string]map[string]struct{}{
+				"1": map[string]struct{}{"2": struct{}{}, "3": struct{}{}},
+			},
+		}
+		users := getTestUsers("1", "2", "3", "4", "5")
+		for seed := int64(0); seed < 20; seed++ {
+			groups, unmatched := MatchOptimally(newTestMatchContext(data, nil, seed), NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+			assert.Empty(t, unmatched)
+			assert.Len(t, groups, 2)
+			for _, group := range groups {
+				userIDs := GetUserIDList(group)
+				if ContainsString(userIDs, "1") {
+					assert.NotContains(t, userIDs, "2")
+					assert.NotContains(t, userIDs, "3")
+				}
+			}
+		}
+	})
+
+	t.Run("Nobody to pair with", func(t *testing.T) {
+		data := &LunchbotData{
+			Blacklists: map[string]map[string]struct{}{"1": map[string]struct{}{"2": struct{}{}}},
+		}
+		groups, unmatched := MatchOptimally(newTestMatchContext(data, nil, 1), NewMatcher(NewConnectionsStrategy{}), getTestUsers("1", "2"), 2, nil)
+		assert.Empty(t, groups)
+		assert.Len(t, unmatched, 2)
+	})
+}
+
+func TestMatchUsers_batchStrategy(t *testing.T) {
+	users, data := getCompatibilityTestData()
+	groups, unmatched := MatchUsers(newTestMatchContext(data, nil, 3), NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+	optimalGroups, optimalUnmatched := MatchOptimally(newTestMatchContext(data, nil, 3), NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+	assert.Equal(t, optimalGroups, groups)
+	assert.Equal(t, optimalUnmatched, unmatched)
+}
+
+// getLargeMatchingData returns the given number of users with a history of ten partners, two topics and a department each
+func getLargeMatchingData(count int) ([]*model.User, *LunchbotData, Departments) {
+	users := []*model.User{}
+	data := &LunchbotData{
+		History:    map[string][]*HistoryEntry{},
+		UserTopics: map[string]map[string]struct{}{},
+	}
+	departments := Departments{}
+	for index := 0; index < count; index++ {
+		userID := fmt.Sprintf("user%d", index)
+		users = append(users, &model.User{Id: userID})
+		for partner := 1; partner <= 5; partner++ {
+			for _, partnerIndex := range []int{(index + partner*7) % count, (index - partner*7 + count) % count} {
+				partnerID := fmt.Sprintf("user%d", partnerIndex)
+				data.History[userID] = append(data.History[userID], &HistoryEntry{UserIDs: []string{userID, partnerID}, Outcome: OutcomeFinished})
+			}
+		}
+		data.UserTopics[userID] = map[string]struct{}{
+			fmt.Sprintf("Topic %d", index%20):     struct{}{},
+			fmt.Sprintf("Topic %d", (index*3)%20): struct{}{},
+		}
+		departments[userID] = []string{fmt.Sprintf("Department %d", index%10)}
+	}
+	return users, data, departments
+}
+
+func TestMatchOptimally_large(t *testing.T) {
+	users, data, departments := getLargeMatchingData(500)
+	ctx := newTestMatchContext(data, departments, 1)
+	groups, unmatched := MatchOptimally(ctx, NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+	assert.Empty(t, unmatched)
+	assert.Len(t, groups, 250)
+
+	//nobody is paired with a recent partner while there are plenty of new ones
+	for _, group := range groups {
+		assert.Equal(t, 1, CountNewConnections(data, []string{group[0].Id}, group[1].Id))
+	}
+}
+
+func BenchmarkMatchOptimally(b *testing.B) {
+	users, data, departments := getLargeMatchingData(2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MatchOptimally(newTestMatchContext(data, departments, int64(i)), NewMatcher(NewConnectionsStrategy{}), users, 2, nil)
+	}
+}
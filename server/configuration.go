@@ -2,7 +2,10 @@ package main
 
 import (
 	"reflect"
+	"strings"
+	"time"
 
+	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
 )
 
@@ -18,6 +21,170 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// NumHistoryEntries is the number of pairings and the number of invitations per user that get stored in order to avoid pairing with the same users again and again
+	NumHistoryEntries int
+	// NewUserWeight is the weight of users that have never been paired with the triggering user
+	NewUserWeight int
+	// SharedTopicWeight is the weight that gets added for every topic two users are both interested in
+	SharedTopicWeight int
+	// DepartmentAttribute is the attribute of a user that decides which department he belongs to
+	DepartmentAttribute string
+	// DepartmentProperty is the name of the custom profile property that is used as department
+	DepartmentProperty string
+	// CrossDepartmentWeight is the weight that gets added for every group member from a different department
+	CrossDepartmentWeight int
+	// MatchStrategy is the name of the strategy that picks partners among the candidates, channels can choose their own
+	MatchStrategy string
+	// MaxChannelMembers is the number of channel members that are considered when looking for a pairing, 0 considers every member
+	MaxChannelMembers int
+	// DefaultGroupSize is the number of users per group when no group size is given
+	DefaultGroupSize int
+	// PostAnnouncement enables the public post in the channel that announces new pairings
+	PostAnnouncement bool
+	// OfflineStatusPolicy decides whether users with the status offline can get paired.
+	// Deprecated: replaced by EligibleStatuses, only read to migrate existing configurations.
+	OfflineStatusPolicy string
+	// EligibleStatuses is a comma-separated list of the statuses users can get paired with
+	EligibleStatuses string
+	// UnavailableUserPolicy decides what happens to users that are not available when a pairing round runs
+	UnavailableUserPolicy string
+	// InvitationTimeout is the number of minutes invited users have to answer an invitation
+	InvitationTimeout int
+	// PairingTimeToLive is the number of hours after which a pairing ends if nobody finished or extended it
+	PairingTimeToLive int
+	// PairingExpiryWarning is the number of hours before a pairing ends that its members get notified
+	PairingExpiryWarning int
+	// BotDisplayName is the display name of the lunchbot
+	BotDisplayName string
+}
+
+const (
+	//OfflineStatusPolicySkip skips users with the status offline when looking for a pairing
+	OfflineStatusPolicySkip = "skip"
+	//OfflineStatusPolicyInclude pairs users regardless of their status
+	OfflineStatusPolicyInclude = "include"
+)
+
+// defaultEligibleStatuses are the statuses users can get paired with, unless configured otherwise
+var defaultEligibleStatuses = []string{model.STATUS_ONLINE, model.STATUS_AWAY, model.STATUS_DND}
+
+// newConfiguration returns a configuration with the default values. They are used when the plugin has not been configured yet,
+// and for every setting that is missing in the configuration of the server.
+func newConfiguration() *configuration {
+	return &configuration{
+		NumHistoryEntries:     50,
+		NewUserWeight:         1000,
+		SharedTopicWeight:     100,
+		DepartmentAttribute:   DepartmentAttributeNone,
+		CrossDepartmentWeight: 500,
+		MatchStrategy:         MatchStrategyWeightedRandom,
+		DefaultGroupSize:      DefaultGroupSize,
+		PostAnnouncement:      true,
+		EligibleStatuses:      strings.Join(defaultEligibleStatuses, ","),
+		UnavailableUserPolicy: UnavailableUserPolicySkip,
+		InvitationTimeout:     60,
+		PairingTimeToLive:     7 * 24,
+		PairingExpiryWarning:  24,
+		BotDisplayName:        "LunchBot",
+	}
+}
+
+// MigrateSettings converts the settings that have been replaced by newer ones. The eligible statuses of configurations that do not have them yet
+// are taken from the deprecated offline status policy.
+func (c *configuration) MigrateSettings() {
+	if c.EligibleStatuses != "" {
+		return
+	}
+	c.EligibleStatuses = strings.Join(defaultEligibleStatuses, ",")
+	if c.OfflineStatusPolicy == OfflineStatusPolicyInclude {
+		c.EligibleStatuses = strings.Join(userStatuses, ",")
+	}
+}
+
+// IsValid checks that every setting has a sensible value
+func (c *configuration) IsValid() error {
+	if c.NumHistoryEntries < 1 || c.NumHistoryEntries > 1000 {
+		return errors.Errorf("the number of history entries must be between 1 and 1000, got %d", c.NumHistoryEntries)
+	}
+	if c.NewUserWeight < 1 || c.NewUserWeight > 100000 {
+		return errors.Errorf("the weight of new users must be between 1 and 100000, got %d", c.NewUserWeight)
+	}
+	if c.SharedTopicWeight < 0 || c.SharedTopicWeight > 100000 {
+		return errors.Errorf("the weight of shared topics must be between 0 and 100000, got %d", c.SharedTopicWeight)
+	}
+	switch c.DepartmentAttribute {
+	case DepartmentAttributeNone, DepartmentAttributePosition, DepartmentAttributeTeams:
+	case DepartmentAttributeCustom:
+		if len(c.DepartmentProperty) <= 0 {
+			return errors.New("the name of the profile property that contains the department must be set")
+		}
+	default:
+		return errors.Errorf("the department attribute must be '%s', '%s', '%s' or '%s', got '%s'", DepartmentAttributeNone, DepartmentAttributePosition, DepartmentAttributeTeams, DepartmentAttributeCustom, c.DepartmentAttribute)
+	}
+	if c.CrossDepartmentWeight < 0 || c.CrossDepartmentWeight > 100000 {
+		return errors.Errorf("the weight of partners from other departments must be between 0 and 100000, got %d", c.CrossDepartmentWeight)
+	}
+	if _, ok := matchStrategies[c.MatchStrategy]; !ok {
+		return errors.Errorf("the match strategy must be one of %s, got '%s'", strings.Join(GetMatchStrategyNames(), ", "), c.MatchStrategy)
+	}
+	if c.MaxChannelMembers != 0 && c.MaxChannelMembers < 2 {
+		return errors.Errorf("the maximum number of channel members must be 0 or at least 2, got %d", c.MaxChannelMembers)
+	}
+	if c.DefaultGroupSize < MinGroupSize || c.DefaultGroupSize > MaxGroupSize {
+		return errors.Errorf("the default group size must be between %d and %d, got %d", MinGroupSize, MaxGroupSize, c.DefaultGroupSize)
+	}
+	eligibleStatuses := c.GetEligibleStatuses()
+	if len(eligibleStatuses) <= 0 {
+		return errors.New("at least one status must be eligible for pairings")
+	}
+	for _, status := range eligibleStatuses {
+		if !ContainsString(userStatuses, status) {
+			return errors.Errorf("'%s' is not a valid status, the eligible statuses must be a list of %s", status, strings.Join(userStatuses, ", "))
+		}
+	}
+	if c.UnavailableUserPolicy != UnavailableUserPolicySkip && c.UnavailableUserPolicy != UnavailableUserPolicyQueue {
+		return errors.Errorf("the unavailable user policy must be '%s' or '%s', got '%s'", UnavailableUserPolicySkip, UnavailableUserPolicyQueue, c.UnavailableUserPolicy)
+	}
+	if c.InvitationTimeout < 1 || c.InvitationTimeout > 7*24*60 {
+		return errors.Errorf("the invitation timeout must be between 1 and %d minutes, got %d", 7*24*60, c.InvitationTimeout)
+	}
+	if c.PairingTimeToLive < 1 || c.PairingTimeToLive > 365*24 {
+		return errors.Errorf("the pairing duration must be between 1 and %d hours, got %d", 365*24, c.PairingTimeToLive)
+	}
+	if c.PairingExpiryWarning < 1 || c.PairingExpiryWarning >= c.PairingTimeToLive {
+		return errors.Errorf("the pairing expiry warning must be between 1 hour and the pairing duration of %d hours, got %d", c.PairingTimeToLive, c.PairingExpiryWarning)
+	}
+	if len(c.BotDisplayName) <= 0 || len(c.BotDisplayName) > 64 {
+		return errors.Errorf("the display name of the bot must be between 1 and 64 characters long")
+	}
+	return nil
+}
+
+// GetEligibleStatuses returns the statuses users can get paired with
+func (c *configuration) GetEligibleStatuses() []string {
+	statuses := []string{}
+	for _, status := range strings.Split(c.EligibleStatuses, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if len(status) > 0 && !ContainsString(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// GetInvitationTimeout returns the time invited users have to answer an invitation
+func (c *configuration) GetInvitationTimeout() time.Duration {
+	return time.Duration(c.InvitationTimeout) * time.Minute
+}
+
+// GetPairingTimeToLive returns the time after which a pairing ends if nobody finished or extended it
+func (c *configuration) GetPairingTimeToLive() time.Duration {
+	return time.Duration(c.PairingTimeToLive) * time.Hour
+}
+
+// GetPairingExpiryWarning returns the time before a pairing ends that its members get notified
+func (c *configuration) GetPairingExpiryWarning() time.Duration {
+	return time.Duration(c.PairingExpiryWarning) * time.Hour
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -35,7 +202,7 @@ func (p *Plugin) getConfiguration() *configuration {
 	defer p.configurationLock.RUnlock()
 
 	if p.configuration == nil {
-		return &configuration{}
+		return newConfiguration()
 	}
 
 	return p.configuration
@@ -70,16 +237,28 @@ func (p *Plugin) setConfiguration(configuration *configuration) {
 
 // OnConfigurationChange is invoked when configuration changes may have been made.
 //
-// This demo implementation ensures the configured demo user and channel are created for use
-// by the plugin.
+// Invalid configurations are rejected, the plugin keeps using the previous configuration then.
+// The display name of the bot gets updated according to the configuration.
 func (p *Plugin) OnConfigurationChange() error {
-	configuration := p.getConfiguration().Clone()
+	// Settings that are missing in the server configuration keep their default values, all others are validated as they are.
+	configuration := newConfiguration()
+	configuration.EligibleStatuses = ""
 
 	// Load the public configuration fields from the Mattermost server configuration.
 	if loadConfigErr := p.API.LoadPluginConfiguration(configuration); loadConfigErr != nil {
 		return errors.Wrap(loadConfigErr, "failed to load plugin configuration")
 	}
+	configuration.MigrateSettings()
+	if err := configuration.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid plugin configuration")
+	}
 
 	p.setConfiguration(configuration)
+
+	if p.botID != "" {
+		if _, appErr := p.API.PatchBot(p.botID, &model.BotPatch{DisplayName: &configuration.BotDisplayName}); appErr != nil {
+			return errors.Wrap(appErr, "failed to update the display name of the bot")
+		}
+	}
 	return nil
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestConfigurationIsValid(t *testing.T) {
+	t.Run("Default configuration", func(t *testing.T) {
+		assert.Nil(t, newConfiguration().IsValid())
+	})
+
+	t.Run("Legacy offline status policy", func(t *testing.T) {
+		config := &configuration{OfflineStatusPolicy: OfflineStatusPolicyInclude}
+		config.MigrateSettings()
+		assert.Equal(t, []string{"online", "away", "dnd", "offline"}, config.GetEligibleStatuses())
+		config = &configuration{}
+		config.MigrateSettings()
+		assert.Equal(t, []string{"online", "away", "dnd"}, config.GetEligibleStatuses())
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		config := newConfiguration()
+		config.NumHistoryEntries = -1
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.DefaultGroupSize = MaxGroupSize + 1
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.MatchStrategy = "fastest"
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.EligibleStatuses = "online,sleeping"
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.EligibleStatuses = " , "
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.UnavailableUserPolicy = "sometimes"
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.SharedTopicWeight = -5
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.PairingTimeToLive = 12
+		config.PairingExpiryWarning = 12
+		assert.NotNil(t, config.IsValid())
+
+		//zero is not replaced by the default
+		config = newConfiguration()
+		config.NewUserWeight = 0
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.BotDisplayName = ""
+		assert.NotNil(t, config.IsValid())
+
+		config = newConfiguration()
+		config.DepartmentAttribute = DepartmentAttributeCustom
+		assert.NotNil(t, config.IsValid())
+		config.DepartmentProperty = "department"
+		assert.Nil(t, config.IsValid())
+	})
+}
+
+func TestOnConfigurationChange(t *testing.T) {
+	//loadConfiguration lets the plugin load the given settings of the server configuration and returns the configuration it uses afterwards
+	loadConfiguration := func(settings string) (*configuration, error) {
+		api := &plugintest.API{}
+		api.On("LoadPluginConfiguration", mock.Anything).Return(func(dest interface{}) error {
+			return json.Unmarshal([]byte(settings), dest)
+		})
+		plugin := &Plugin{}
+		plugin.SetAPI(api)
+		err := plugin.OnConfigurationChange()
+		return plugin.getConfiguration(), err
+	}
+
+	t.Run("Missing settings get defaults", func(t *testing.T) {
+		config, err := loadConfiguration(`{"NumHistoryEntries": 10, "OfflineStatusPolicy": "include"}`)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, config.NumHistoryEntries)
+		assert.Equal(t, 1000, config.NewUserWeight)
+		assert.Equal(t, 100, config.SharedTopicWeight)
+		assert.Equal(t, 500, config.CrossDepartmentWeight)
+		assert.True(t, config.PostAnnouncement)
+		assert.Equal(t, []string{"online", "away", "dnd", "offline"}, config.GetEligibleStatuses())
+	})
+
+	t.Run("Settings are not replaced by defaults", func(t *testing.T) {
+		config, err := loadConfiguration(`{"SharedTopicWeight": 0, "PostAnnouncement": false}`)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, config.SharedTopicWeight)
+		assert.False(t, config.PostAnnouncement)
+
+		for _, settings := range []string{
+			`{"NewUserWeight": 0}`,
+			`{"NumHistoryEntries": 0}`,
+			`{"InvitationTimeout": 0}`,
+			`{"PairingTimeToLive": 0}`,
+			`{"MatchStrategy": ""}`,
+		} {
+			_, err = loadConfiguration(settings)
+			assert.NotNil(t, err, settings)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//DepartmentAttributeNone disables the preference for partners from other departments
+	DepartmentAttributeNone = "none"
+	//DepartmentAttributePosition uses the position of a user's profile as his department
+	DepartmentAttributePosition = "position"
+	//DepartmentAttributeTeams uses the teams a user is member of as his departments
+	DepartmentAttributeTeams = "teams"
+	//DepartmentAttributeCustom uses a custom property of a user's profile as his department
+	DepartmentAttributeCustom = "custom"
+)
+
+// Departments maps user IDs to the departments or teams the users belong to. Users without a known department are not contained.
+type Departments map[string][]string
+
+// AreDifferent returns true if the departments of both users are known and the users do not share any department
+func (d Departments) AreDifferent(userID string, otherUserID string) bool {
+	departments, ok := d[userID]
+	if !ok {
+		return false
+	}
+	otherDepartments, ok := d[otherUserID]
+	if !ok {
+		return false
+	}
+	for _, department := range departments {
+		for _, otherDepartment := range otherDepartments {
+			if strings.EqualFold(department, otherDepartment) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GetDepartmentWeight returns the weight that gets added for every group member that belongs to a different department than the given user
+func GetDepartmentWeight(config *configuration, departments Departments, group []string, userID string) uint {
+	weight := uint(0)
+	for _, memberID := range group {
+		if departments.AreDifferent(memberID, userID) {
+			weight += uint(config.CrossDepartmentWeight)
+		}
+	}
+	return weight
+}
+
+// GetUserDepartments returns the departments of the given user according to the configured attribute
+func (p *Plugin) GetUserDepartments(user *model.User) []string {
+	config := p.getConfiguration()
+	department := ""
+	switch config.DepartmentAttribute {
+	case DepartmentAttributePosition:
+		department = user.Position
+	case DepartmentAttributeCustom:
+		department = user.Props[config.DepartmentProperty]
+	case DepartmentAttributeTeams:
+		teams, appErr := p.API.GetTeamsForUser(user.Id)
+		if appErr != nil {
+			p.API.LogError("Failed to get the teams of a user", "user_id", user.Id, "err", appErr.Error())
+			return nil
+		}
+		departments := []string{}
+		for _, team := range teams {
+			departments = append(departments, team.DisplayName)
+		}
+		return departments
+	}
+	department = strings.TrimSpace(department)
+	if len(department) <= 0 {
+		return nil
+	}
+	return []string{department}
+}
+
+// GetDepartments returns the departments of the given users. Returns nil if no department attribute is configured.
+func (p *Plugin) GetDepartments(users []*model.User) Departments {
+	if p.getConfiguration().DepartmentAttribute == DepartmentAttributeNone {
+		return nil
+	}
+	departments := Departments{}
+	for _, user := range users {
+		if userDepartments := p.GetUserDepartments(user); len(userDepartments) > 0 {
+			departments[user.Id] = userDepartments
+		}
+	}
+	return departments
+}
+
+// GetCrossDepartmentMsg returns a message that explains that the given users have been paired across departments.
+// Returns an empty string if no members of the group belong to different departments.
+func GetCrossDepartmentMsg(users []*model.User, departments Departments) string {
+	isCrossDepartment := false
+	for _, user := range users {
+		for _, otherUser := range users {
+			if departments.AreDifferent(user.Id, otherUser.Id) {
+				isCrossDepartment = true
+			}
+		}
+	}
+	if !isCrossDepartment {
+		return ""
+	}
+
+	members := []string{}
+	for _, user := range users {
+		if userDepartments, ok := departments[user.Id]; ok {
+			members = append(members, fmt.Sprintf("@%s (%s)", user.Username, strings.Join(userDepartments, ", ")))
+		}
+	}
+	return fmt.Sprintf("I picked you from different departments so you get to know other parts of the company: %s", strings.Join(members, ", "))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDepartments(t *testing.T) {
+	departments := Departments{
+		"1": []string{"Sales"},
+		"2": []string{"sales", "Marketing"},
+		"3": []string{"Engineering"},
+	}
+	assert.False(t, departments.AreDifferent("1", "2"))
+	assert.True(t, departments.AreDifferent("1", "3"))
+	assert.True(t, departments.AreDifferent("2", "3"))
+	//users without a department are never preferred
+	assert.False(t, departments.AreDifferent("1", "4"))
+
+	config := newConfiguration()
+	assert.Equal(t, uint(0), GetDepartmentWeight(config, departments, []string{"1"}, "2"))
+	assert.Equal(t, uint(2*config.CrossDepartmentWeight), GetDepartmentWeight(config, departments, []string{"1", "2"}, "3"))
+	assert.Equal(t, uint(0), GetDepartmentWeight(config, nil, []string{"1", "2"}, "3"))
+
+	users := []*model.User{&model.User{Id: "1", Username: "john"}, &model.User{Id: "3", Username: "anna"}}
+	assert.Equal(t, "I picked you from different departments so you get to know other parts of the company: @john (Sales), @anna (Engineering)", GetCrossDepartmentMsg(users, departments))
+	assert.Empty(t, GetCrossDepartmentMsg(users[:1], departments))
+}
+
+func TestGetDepartments(t *testing.T) {
+	users := []*model.User{
+		&model.User{Id: "1", Position: "Sales", Props: model.StringMap{"department": "Finance"}},
+		&model.User{Id: "2", Position: " "},
+	}
+	api := &plugintest.API{}
+	api.On("GetTeamsForUser", "1").Return([]*model.Team{&model.Team{DisplayName: "Team A"}, &model.Team{DisplayName: "Team B"}}, nil)
+	api.On("GetTeamsForUser", "2").Return(nil, &model.AppError{Message: "not found"})
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	plugin := &Plugin{}
+	plugin.SetAPI(api)
+
+	config := newConfiguration()
+	plugin.setConfiguration(config)
+	assert.Nil(t, plugin.GetDepartments(users))
+
+	config = newConfiguration()
+	config.DepartmentAttribute = DepartmentAttributePosition
+	plugin.setConfiguration(config)
+	assert.Equal(t, Departments{"1": []string{"Sales"}}, plugin.GetDepartments(users))
+
+	config = newConfiguration()
+	config.DepartmentAttribute = DepartmentAttributeCustom
+	config.DepartmentProperty = "department"
+	plugin.setConfiguration(config)
+	assert.Equal(t, Departments{"1": []string{"Finance"}}, plugin.GetDepartments(users))
+
+	config = newConfiguration()
+	config.DepartmentAttribute = DepartmentAttributeTeams
+	plugin.setConfiguration(config)
+	assert.Equal(t, Departments{"1": []string{"Team A", "Team B"}}, plugin.GetDepartments(users))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetExpiresAt returns the time the pairing ends if nobody finishes or extends it before
+func (pr *Pairing) GetExpiresAt(timeToLive time.Duration) time.Time {
+	startedAt := pr.CreatedAt
+	if pr.ExtendedAt > startedAt {
+		startedAt = pr.ExtendedAt
+	}
+	return time.Unix(0, startedAt*int64(time.Millisecond)).Add(timeToLive)
+}
+
+// IsExpired returns true if the pairing has not been finished or extended within the given time to live
+func (pr *Pairing) IsExpired(now time.Time, timeToLive time.Duration) bool {
+	return !now.Before(pr.GetExpiresAt(timeToLive))
+}
+
+// NeedsExpiryWarning returns true if the pairing expires within the given warning time and its members have not been notified yet
+func (pr *Pairing) NeedsExpiryWarning(now time.Time, timeToLive time.Duration, warning time.Duration) bool {
+	return !pr.WarningSent && !now.Before(pr.GetExpiresAt(timeToLive).Add(-warning))
+}
+
+// ExtendPairing restarts the time to live of the given pairing
+func (p *Plugin) ExtendPairing(pairingID string, now time.Time) (*Pairing, error) {
+	return p.store.UpdatePairing(pairingID, func(pairing *Pairing) error {
+		pairing.ExtendedAt = now.UnixNano() / int64(time.Millisecond)
+		pairing.WarningSent = false
+		return nil
+	})
+}
+
+// expirePairings ends all pairings of the given snapshot that have not been finished in time and warns the members of pairings that are about to expire
+func (p *Plugin) expirePairings(data *LunchbotData, now time.Time) {
+	config := p.getConfiguration()
+	timeToLive := config.GetPairingTimeToLive()
+
+	for _, pairing := range data.Pairings {
+		if pairing.IsExpired(now, timeToLive) {
+			//the pairing might have been finished in the meantime
+			if pairing = p.releasePairing(pairing.ID, pairing.UserIDs); pairing == nil {
+				continue
+			}
+			p.recordHistory(NewPairingHistoryEntry(pairing, OutcomeExpired))
+			p.notifyPairingMembers(pairing, "Your lunch pairing has ended as nobody finished it in time. Thanks a lot for using Lunchbot :sunglasses:")
+			continue
+		}
+
+		if !pairing.NeedsExpiryWarning(now, timeToLive, config.GetPairingExpiryWarning()) {
+			continue
+		}
+		//only warn once, even if the pairing has been warned about by someone else in the meantime
+		warnedPairing, err := p.store.UpdatePairing(pairing.ID, func(pairing *Pairing) error {
+			if pairing.WarningSent {
+				return errConflict
+			}
+			pairing.WarningSent = true
+			return nil
+		})
+		if err != nil || warnedPairing == nil {
+			continue
+		}
+		expiresAt := warnedPairing.GetExpiresAt(timeToLive)
+		p.notifyPairingMembers(warnedPairing, fmt.Sprintf("Your lunch pairing ends on %s. Use `/%s` to keep it going, or `/%s` once you had lunch.",
+			expiresAt.UTC().Format("2006-01-02 15:04 MST"), commandLunchbotExtend, commandLunchbotFinish))
+	}
+}
+
+// notifyPairingMembers sends the given message as a direct message to every member of the given pairing
+func (p *Plugin) notifyPairingMembers(pairing *Pairing, message string) {
+	for _, userID := range pairing.UserIDs {
+		if err := p.SendDirectMessage(message, userID); err != nil {
+			p.API.LogError("Failed to notify pairing member", "user_id", userID, "err", err.Error())
+		}
+	}
+}
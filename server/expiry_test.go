@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPairingIsExpired(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+	pairing := &Pairing{CreatedAt: now.UnixNano() / int64(time.Millisecond)}
+
+	assert.False(t, pairing.IsExpired(now.Add(23*time.Hour), 24*time.Hour))
+	assert.True(t, pairing.IsExpired(now.Add(24*time.Hour), 24*time.Hour))
+	assert.False(t, pairing.NeedsExpiryWarning(now.Add(11*time.Hour), 24*time.Hour, 12*time.Hour))
+	assert.True(t, pairing.NeedsExpiryWarning(now.Add(13*time.Hour), 24*time.Hour, 12*time.Hour))
+
+	//extending the pairing restarts its time to live
+	pairing.ExtendedAt = now.Add(20*time.Hour).UnixNano() / int64(time.Millisecond)
+	assert.False(t, pairing.IsExpired(now.Add(24*time.Hour), 24*time.Hour))
+	assert.Equal(t, now.Add(44*time.Hour), pairing.GetExpiresAt(24*time.Hour).UTC())
+
+	pairing.WarningSent = true
+	assert.False(t, pairing.NeedsExpiryWarning(now.Add(40*time.Hour), 24*time.Hour, 12*time.Hour))
+}
+
+func TestExpirePairings(t *testing.T) {
+	now := time.Now()
+	millis := func(d time.Duration) int64 {
+		return now.Add(d).UnixNano() / int64(time.Millisecond)
+	}
+
+	plugin := &Plugin{}
+	plugin.setConfiguration(&configuration{NumHistoryEntries: 10, PairingTimeToLive: 24, PairingExpiryWarning: 12})
+	api := &plugintest.API{}
+	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{
+		Pairings: map[string]*Pairing{
+			"expired":  &Pairing{ID: "expired", ChannelID: "channel", UserIDs: []string{"1", "2"}, CreatedAt: millis(-25 * time.Hour)},
+			"expiring": &Pairing{ID: "expiring", UserIDs: []string{"3", "4"}, CreatedAt: millis(-13 * time.Hour)},
+			"extended": &Pairing{ID: "extended", UserIDs: []string{"5", "6"}, CreatedAt: millis(-25 * time.Hour), ExtendedAt: millis(-time.Hour)},
+		},
+		ActivePairings: map[string]string{"1": "expired", "2": "expired", "3": "expiring", "4": "expiring", "5": "extended", "6": "extended"},
+	})
+
+	data, _ := plugin.store.ReadAll()
+	plugin.expirePairings(&data, now)
+
+	pairing, _ := plugin.store.GetPairing("expired")
+	assert.Nil(t, pairing)
+	userData, _ := plugin.store.GetUserData("1")
+	assert.Empty(t, userData.ActivePairingID)
+	assert.Len(t, userData.History, 1)
+	assert.Equal(t, OutcomeExpired, userData.History[0].Outcome)
+	assert.Equal(t, "channel", userData.History[0].ChannelID)
+
+	pairing, _ = plugin.store.GetPairing("expiring")
+	assert.True(t, pairing.WarningSent)
+	pairing, _ = plugin.store.GetPairing("extended")
+	assert.False(t, pairing.WarningSent)
+	api.AssertNumberOfCalls(t, "CreatePost", 4)
+
+	//members only get warned once, even if the pairings are taken from an outdated snapshot
+	plugin.expirePairings(&data, now)
+	api.AssertNumberOfCalls(t, "CreatePost", 4)
+
+	pairing, _ = plugin.ExtendPairing("expiring", now)
+	assert.False(t, pairing.WarningSent)
+	assert.False(t, pairing.IsExpired(now.Add(23*time.Hour), plugin.getConfiguration().GetPairingTimeToLive()))
+}
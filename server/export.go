@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	//ExportFormatVersion is the current version of the ExportDocument layout
+	ExportFormatVersion int = 1
+	//ImportModeMerge adds the imported data to the existing data
+	ImportModeMerge = "merge"
+	//ImportModeReplace removes all existing data before importing
+	ImportModeReplace = "replace"
+	//importSearchPosts is the number of recent direct message posts that are searched for the file to import
+	importSearchPosts = 20
+)
+
+// ExportDocument contains all data of the lunchbot, it is used to move the data to another server or to restore it later
+type ExportDocument struct {
+	FormatVersion int                       `json:"FormatVersion"` //Version of the document layout
+	ExportedAt    int64                     `json:"ExportedAt"`    //Unix timestamp in milliseconds
+	Usernames     map[string]string         `json:"Usernames"`     //Key: UserID, Value: Username, used to find the users on servers where their IDs are different
+	Channels      map[string]*ExportChannel `json:"Channels"`      //Key: ChannelID, used to find the channels on servers where their IDs are different
+	Data          LunchbotData              `json:"Data"`          //All stored data except the pending invitations
+}
+
+// ExportChannel contains the names of an exported channel
+type ExportChannel struct {
+	TeamName    string `json:"TeamName"`
+	ChannelName string `json:"ChannelName"`
+}
+
+// GetUserIDs returns every user that is referenced by the given data
+func GetUserIDs(data *LunchbotData) []string {
+	userIDs := map[string]struct{}{}
+	add := func(ids ...string) {
+		for _, id := range ids {
+			userIDs[id] = struct{}{}
+		}
+	}
+	for userID := range data.ActivePairings {
+		add(userID)
+	}
+	for _, pairing := range data.Pairings {
+		add(pairing.UserIDs...)
+	}
+	for userID, history := range data.History {
+		add(userID)
+		for _, entry := range history {
+			add(entry.UserIDs...)
+		}
+	}
+	for userID := range data.UserTopics {
+		add(userID)
+	}
+	for userID, blacklist := range data.Blacklists {
+		add(userID)
+		for otherUserID := range blacklist {
+			add(otherUserID)
+		}
+	}
+	for userID := range data.Participations {
+		add(userID)
+	}
+	for _, schedule := range data.Schedules {
+		if len(schedule.CreatorID) > 0 {
+			add(schedule.CreatorID)
+		}
+	}
+
+	result := []string{}
+	for userID := range userIDs {
+		result = append(result, userID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GetChannelIDs returns every channel that is referenced by the given data
+func GetChannelIDs(data *LunchbotData) []string {
+	channelIDs := map[string]struct{}{}
+	add := func(channelID string) {
+		if len(channelID) > 0 {
+			channelIDs[channelID] = struct{}{}
+		}
+	}
+	for _, pairing := range data.Pairings {
+		add(pairing.ChannelID)
+	}
+	for _, history := range data.History {
+		for _, entry := range history {
+			add(entry.ChannelID)
+		}
+	}
+	for _, participation := range data.Participations {
+		for channelID := range participation.QueuedChannels {
+			add(channelID)
+		}
+	}
+	for channelID := range data.Schedules {
+		add(channelID)
+	}
+	for channelID := range data.ChannelConfigs {
+		add(channelID)
+	}
+
+	result := []string{}
+	for channelID := range channelIDs {
+		result = append(result, channelID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ValidateExport checks that the given document can be imported
+func ValidateExport(doc *ExportDocument) error {
+	if doc.FormatVersion < 1 || doc.FormatVersion > ExportFormatVersion {
+		return errors.Errorf("unsupported export format version %d", doc.FormatVersion)
+	}
+	if doc.Data.Version < 1 || doc.Data.Version > DataVersion {
+		return errors.Errorf("unsupported data version %d", doc.Data.Version)
+	}
+	for pairingID, pairing := range doc.Data.Pairings {
+		if pairing == nil || pairing.ID != pairingID {
+			return errors.Errorf("pairing '%s' has an invalid ID", pairingID)
+		}
+		if len(pairing.UserIDs) < MinGroupSize {
+			return errors.Errorf("pairing '%s' has less than %d members", pairingID, MinGroupSize)
+		}
+	}
+	for userID, pairingID := range doc.Data.ActivePairings {
+		pairing, ok := doc.Data.Pairings[pairingID]
+		if !ok || !ContainsString(pairing.UserIDs, userID) {
+			return errors.Errorf("user '%s' is part of the unknown pairing '%s'", userID, pairingID)
+		}
+	}
+	for userID, history := range doc.Data.History {
+		for _, entry := range history {
+			if entry == nil || !ContainsString(entry.UserIDs, userID) {
+				return errors.Errorf("the history of user '%s' contains an entry without him", userID)
+			}
+			switch entry.Outcome {
+			case OutcomeFinished, OutcomeDeclined, OutcomeExpired, OutcomeCancelled:
+			default:
+				return errors.Errorf("the history of user '%s' contains the unknown outcome '%s'", userID, entry.Outcome)
+			}
+		}
+	}
+	for channelID, schedule := range doc.Data.Schedules {
+		if schedule == nil || schedule.ChannelID != channelID {
+			return errors.Errorf("the schedule of channel '%s' has an invalid channel ID", channelID)
+		}
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			return errors.Errorf("the schedule of channel '%s' has the unknown timezone '%s'", channelID, schedule.Timezone)
+		}
+	}
+	for questionID, question := range doc.Data.Questions {
+		if question == nil || question.ID != questionID || strings.HasPrefix(questionID, builtinQuestionPrefix) {
+			return errors.Errorf("question '%s' has an invalid ID", questionID)
+		}
+		if len(question.Category) <= 0 || len(question.Text) <= 0 {
+			return errors.Errorf("question '%s' has no category or text", questionID)
+		}
+	}
+	for channelID, channelConfig := range doc.Data.ChannelConfigs {
+		if channelConfig == nil {
+			return errors.Errorf("the settings of channel '%s' are empty", channelID)
+		}
+		if channelConfig.GroupSize != 0 && (channelConfig.GroupSize < MinGroupSize || channelConfig.GroupSize > MaxGroupSize) {
+			return errors.Errorf("the settings of channel '%s' have the invalid group size %d", channelID, channelConfig.GroupSize)
+		}
+	}
+	return nil
+}
+
+// MapUserIDs replaces the user IDs of the given data according to the given mapping.
+// Users that are mapped to an empty ID are removed, as well as pairings and history entries that do not have enough members left.
+func MapUserIDs(data *LunchbotData, mapping map[string]string) {
+	mapIDs := func(userIDs []string) []string {
+		mapped := []string{}
+		for _, userID := range userIDs {
+			if newID := mapping[userID]; len(newID) > 0 {
+				mapped = append(mapped, newID)
+			}
+		}
+		return mapped
+	}
+
+	pairings := map[string]*Pairing{}
+	for pairingID, pairing := range data.Pairings {
+		pairing.UserIDs = mapIDs(pairing.UserIDs)
+		if len(pairing.UserIDs) >= MinGroupSize {
+			pairings[pairingID] = pairing
+		}
+	}
+	data.Pairings = pairings
+
+	activePairings := map[string]string{}
+	for userID, pairingID := range data.ActivePairings {
+		if _, ok := pairings[pairingID]; ok && len(mapping[userID]) > 0 {
+			activePairings[mapping[userID]] = pairingID
+		}
+	}
+	data.ActivePairings = activePairings
+
+	histories := map[string][]*HistoryEntry{}
+	for userID, history := range data.History {
+		if len(mapping[userID]) <= 0 {
+			continue
+		}
+		mappedHistory := []*HistoryEntry{}
+		for _, entry := range history {
+			mappedEntry := *entry
+			mappedEntry.UserIDs = mapIDs(entry.UserIDs)
+			if len(entry.AcceptedUserIDs) > 0 {
+				mappedEntry.AcceptedUserIDs = mapIDs(entry.AcceptedUserIDs)
+			}
+			if len(mappedEntry.UserIDs) >= MinGroupSize {
+				mappedHistory = append(mappedHistory, &mappedEntry)
+			}
+		}
+		histories[mapping[userID]] = mappedHistory
+	}
+	data.History = histories
+
+	userTopics := map[string]map[string]struct{}{}
+	for userID, topics := range data.UserTopics {
+		if len(mapping[userID]) > 0 {
+			userTopics[mapping[userID]] = topics
+		}
+	}
+	data.UserTopics = userTopics
+
+	blacklists := map[string]map[string]struct{}{}
+	for userID, blacklist := range data.Blacklists {
+		if len(mapping[userID]) <= 0 {
+			continue
+		}
+		blacklists[mapping[userID]] = map[string]struct{}{}
+		for otherUserID := range blacklist {
+			if newID := mapping[otherUserID]; len(newID) > 0 {
+				blacklists[mapping[userID]][newID] = struct{}{}
+			}
+		}
+	}
+	data.Blacklists = blacklists
+
+	participations := map[string]*Participation{}
+	for userID, participation := range data.Participations {
+		if len(mapping[userID]) > 0 {
+			participations[mapping[userID]] = participation
+		}
+	}
+	data.Participations = participations
+
+	for _, schedule := range data.Schedules {
+		schedule.CreatorID = mapping[schedule.CreatorID]
+	}
+}
+
+// MapChannelIDs replaces the channel IDs of the given data according to the given mapping.
+// Schedules, channel settings and queued rounds of channels that are mapped to an empty ID are removed,
+// pairings and history entries of these channels are kept without their channel.
+func MapChannelIDs(data *LunchbotData, mapping map[string]string) {
+	for _, pairing := range data.Pairings {
+		pairing.ChannelID = mapping[pairing.ChannelID]
+	}
+
+	for _, history := range data.History {
+		for _, entry := range history {
+			entry.ChannelID = mapping[entry.ChannelID]
+		}
+	}
+
+	for _, participation := range data.Participations {
+		if len(participation.QueuedChannels) <= 0 {
+			continue
+		}
+		queuedChannels := map[string]int64{}
+		for channelID, queuedAt := range participation.QueuedChannels {
+			if newID := mapping[channelID]; len(newID) > 0 {
+				queuedChannels[newID] = queuedAt
+			}
+		}
+		participation.QueuedChannels = queuedChannels
+	}
+
+	schedules := map[string]*Schedule{}
+	for channelID, schedule := range data.Schedules {
+		if newID := mapping[channelID]; len(newID) > 0 {
+			schedule.ChannelID = newID
+			schedules[newID] = schedule
+		}
+	}
+	data.Schedules = schedules
+
+	channelConfigs := map[string]*ChannelConfig{}
+	for channelID, channelConfig := range data.ChannelConfigs {
+		if newID := mapping[channelID]; len(newID) > 0 {
+			channelConfigs[newID] = channelConfig
+		}
+	}
+	data.ChannelConfigs = channelConfigs
+}
+
+// MergeUserData adds the given imported data of a user to his existing data. At most numHistoryEntries history entries are kept.
+// The pairing state is not merged, imported pairings are stored separately.
+func MergeUserData(userData *UserData, imported *UserData, numHistoryEntries int) {
+	historyKey := func(entry *HistoryEntry) string {
+		return fmt.Sprintf("%s/%d/%s", entry.PairingID, entry.FinishedAt, strings.Join(entry.UserIDs, ","))
+	}
+	knownEntries := map[string]struct{}{}
+	for _, entry := range userData.History {
+		knownEntries[historyKey(entry)] = struct{}{}
+	}
+	for _, entry := range imported.History {
+		if _, ok := knownEntries[historyKey(entry)]; !ok {
+			userData.History = append(userData.History, entry)
+		}
+	}
+	//the most recent entry needs to be the last one, entries without a timestamp are the oldest
+	sort.SliceStable(userData.History, func(i, j int) bool {
+		return userData.History[i].FinishedAt < userData.History[j].FinishedAt
+	})
+	userData.History = TrimHistory(userData.History, numHistoryEntries)
+
+	for topic := range imported.Topics {
+		if userData.Topics == nil {
+			userData.Topics = map[string]struct{}{}
+		}
+		userData.Topics[topic] = struct{}{}
+	}
+	for otherUserID := range imported.Blacklist {
+		if userData.Blacklist == nil {
+			userData.Blacklist = map[string]struct{}{}
+		}
+		userData.Blacklist[otherUserID] = struct{}{}
+	}
+	if userData.Participation == nil {
+		userData.Participation = imported.Participation
+	}
+}
+
+// BuildExport returns a document that contains all data of the lunchbot
+func (p *Plugin) BuildExport() (*ExportDocument, error) {
+	data, err := p.store.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	//invitations reference posts of this server, they cannot be moved
+	data.Invitations = nil
+	data.PendingInvitations = nil
+
+	doc := &ExportDocument{
+		FormatVersion: ExportFormatVersion,
+		ExportedAt:    model.GetMillis(),
+		Usernames:     map[string]string{},
+		Channels:      map[string]*ExportChannel{},
+		Data:          data,
+	}
+	for _, userID := range GetUserIDs(&data) {
+		if user, appErr := p.API.GetUser(userID); appErr == nil {
+			doc.Usernames[userID] = user.Username
+		}
+	}
+	teamNames := map[string]string{}
+	for _, channelID := range GetChannelIDs(&data) {
+		channel, appErr := p.API.GetChannel(channelID)
+		if appErr != nil || len(channel.TeamId) <= 0 {
+			continue
+		}
+		if _, ok := teamNames[channel.TeamId]; !ok {
+			if team, appErr := p.API.GetTeam(channel.TeamId); appErr == nil {
+				teamNames[channel.TeamId] = team.Name
+			}
+		}
+		if teamName := teamNames[channel.TeamId]; len(teamName) > 0 {
+			doc.Channels[channelID] = &ExportChannel{TeamName: teamName, ChannelName: channel.Name}
+		}
+	}
+	return doc, nil
+}
+
+// SendExport sends a document with all data of the lunchbot to the given user as a file attachment of a direct message
+func (p *Plugin) SendExport(userID string) error {
+	doc, err := p.BuildExport()
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the export")
+	}
+
+	fileName := fmt.Sprintf("lunchbot-export-%s.json", time.Now().UTC().Format("2006-01-02-1504"))
+	message := fmt.Sprintf("Here is the export of all lunchbot data. Upload it here and use `/%s` to import it again.", commandLunchbotAdminImport)
+	return p.SendDirectMessageWithFiles(message, userID, map[string][]byte{fileName: content})
+}
+
+// FindImportFile returns the content of the most recent JSON file that the given user uploaded to his direct message channel with the bot
+func (p *Plugin) FindImportFile(userID string) ([]byte, error) {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the direct channel")
+	}
+	posts, appErr := p.API.GetPostsForChannel(channel.Id, 0, importSearchPosts)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the posts of the direct channel")
+	}
+	//the order starts with the most recent post
+	for _, postID := range posts.Order {
+		post := posts.Posts[postID]
+		if post == nil || post.UserId != userID {
+			continue
+		}
+		for _, fileID := range post.FileIds {
+			fileInfo, appErr := p.API.GetFileInfo(fileID)
+			if appErr != nil || fileInfo.Extension != "json" {
+				continue
+			}
+			content, appErr := p.API.GetFile(fileID)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "failed to read the file")
+			}
+			return content, nil
+		}
+	}
+	return nil, errors.New("there is no JSON file in your direct messages with lunchbot, please upload the export there first")
+}
+
+// ImportData validates the given document and imports its data. In the replace mode all existing data is removed first.
+// Users and channels that do not exist on this server are looked up by their names, the data of channels that cannot be found is skipped.
+// Returns a summary of the import.
+func (p *Plugin) ImportData(doc *ExportDocument, mode string) (string, error) {
+	if mode != ImportModeMerge && mode != ImportModeReplace {
+		return "", errors.Errorf("unknown import mode '%s', use %s or %s", mode, ImportModeMerge, ImportModeReplace)
+	}
+	if err := ValidateExport(doc); err != nil {
+		return "", errors.Wrap(err, "invalid export")
+	}
+
+	mapping := map[string]string{}
+	unknownUsers := []string{}
+	for _, userID := range GetUserIDs(&doc.Data) {
+		if _, appErr := p.API.GetUser(userID); appErr == nil {
+			mapping[userID] = userID
+			continue
+		}
+		username, ok := doc.Usernames[userID]
+		if !ok {
+			unknownUsers = append(unknownUsers, userID)
+			continue
+		}
+		if user, appErr := p.API.GetUserByUsername(username); appErr == nil {
+			mapping[userID] = user.Id
+		} else {
+			unknownUsers = append(unknownUsers, "@"+username)
+		}
+	}
+	channelMapping := map[string]string{}
+	unknownChannels := []string{}
+	for _, channelID := range GetChannelIDs(&doc.Data) {
+		if _, appErr := p.API.GetChannel(channelID); appErr == nil {
+			channelMapping[channelID] = channelID
+			continue
+		}
+		names, ok := doc.Channels[channelID]
+		if !ok || names == nil {
+			unknownChannels = append(unknownChannels, channelID)
+			continue
+		}
+		if channel, appErr := p.API.GetChannelByNameForTeamName(names.TeamName, names.ChannelName, false); appErr == nil {
+			channelMapping[channelID] = channel.Id
+		} else {
+			unknownChannels = append(unknownChannels, fmt.Sprintf("~%s (%s)", names.ChannelName, names.TeamName))
+		}
+	}
+	data := doc.Data
+	MapUserIDs(&data, mapping)
+	MapChannelIDs(&data, channelMapping)
+
+	if mode == ImportModeReplace {
+		if err := p.store.Clear(); err != nil {
+			return "", err
+		}
+	}
+
+	numHistoryEntries := p.getConfiguration().NumHistoryEntries
+	users := SplitData(&data)
+	for userID, imported := range users {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			MergeUserData(userData, imported, numHistoryEntries)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	skippedPairings := 0
+	for _, pairing := range data.Pairings {
+		//users that are already paired on this server keep their pairing
+		if err := p.storePairing(pairing); err != nil {
+			skippedPairings++
+		}
+	}
+	for _, schedule := range data.Schedules {
+		if err := p.store.SaveSchedule(schedule); err != nil {
+			return "", err
+		}
+	}
+	for channelID, channelConfig := range data.ChannelConfigs {
+		if err := p.store.SaveChannelConfig(channelID, channelConfig); err != nil {
+			return "", err
+		}
+	}
+
+	_, err := p.store.UpdateTopicCatalogue(func(catalogue map[string]*CatalogueTopic) error {
+		for key, topic := range data.TopicCatalogue {
+			if _, ok := catalogue[key]; !ok {
+				catalogue[key] = topic
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = p.store.UpdateQuestions(func(questions map[string]*Question) error {
+		for questionID, question := range data.Questions {
+			questions[questionID] = question
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("Imported the data of %d users, %d pairings, %d schedules, %d channel settings, %d catalogue topics and %d questions.",
+		len(users), len(data.Pairings)-skippedPairings, len(data.Schedules), len(data.ChannelConfigs), len(data.TopicCatalogue), len(data.Questions))
+	if skippedPairings > 0 {
+		message += fmt.Sprintf(" Skipped %d pairings as their members are already paired.", skippedPairings)
+	}
+	if len(unknownUsers) > 0 {
+		message += fmt.Sprintf(" Skipped unknown users: %s.", strings.Join(unknownUsers, ", "))
+	}
+	if len(unknownChannels) > 0 {
+		message += fmt.Sprintf(" Skipped the schedules and settings of unknown channels: %s.", strings.Join(unknownChannels, ", "))
+	}
+	return message, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func getExportTestData() *LunchbotData {
+	return &LunchbotData{
+		Version: DataVersion,
+		Pairings: map[string]*Pairing{
+			"A": &Pairing{ID: "A", ChannelID: "channel", UserIDs: []string{"1", "2"}},
+		},
+		ActivePairings: map[string]string{"1": "A", "2": "A"},
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{&HistoryEntry{PairingID: "B", UserIDs: []string{"1", "3"}, FinishedAt: 10, Outcome: OutcomeFinished}},
+			"3": []*HistoryEntry{&HistoryEntry{PairingID: "B", UserIDs: []string{"1", "3"}, FinishedAt: 10, Outcome: OutcomeFinished}},
+		},
+		UserTopics:     map[string]map[string]struct{}{"3": map[string]struct{}{"Go": struct{}{}}},
+		Blacklists:     map[string]map[string]struct{}{"2": map[string]struct{}{"3": struct{}{}}},
+		Participations: getJoinedParticipations("1", "2", "3"),
+		Schedules: map[string]*Schedule{
+			"channel": &Schedule{ChannelID: "channel", CreatorID: "1", Timezone: "UTC"},
+		},
+		ChannelConfigs: map[string]*ChannelConfig{
+			"channel": &ChannelConfig{GroupSize: 3},
+		},
+		TopicCatalogue: map[string]*CatalogueTopic{
+			"go": &CatalogueTopic{Name: "Go", Curated: true},
+		},
+		Questions: map[string]*Question{
+			"Q": &Question{ID: "Q", Category: "food", Text: "Pizza or pasta?"},
+		},
+		Invitations: map[string]*Invitation{
+			"C": &Invitation{ID: "C", RequesterID: "4", UserIDs: []string{"5"}},
+		},
+		PendingInvitations: map[string]string{"4": "C", "5": "C"},
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	doc := &ExportDocument{FormatVersion: ExportFormatVersion, Data: *getExportTestData()}
+	assert.Nil(t, ValidateExport(doc))
+
+	doc.FormatVersion = ExportFormatVersion + 1
+	assert.NotNil(t, ValidateExport(doc))
+
+	doc = &ExportDocument{FormatVersion: ExportFormatVersion, Data: *getExportTestData()}
+	doc.Data.ActivePairings["3"] = "A"
+	assert.NotNil(t, ValidateExport(doc))
+
+	doc = &ExportDocument{FormatVersion: ExportFormatVersion, Data: *getExportTestData()}
+	doc.Data.History["1"][0].Outcome = "eaten"
+	assert.NotNil(t, ValidateExport(doc))
+
+	doc = &ExportDocument{FormatVersion: ExportFormatVersion, Data: *getExportTestData()}
+	doc.Data.ChannelConfigs["channel"].GroupSize = MaxGroupSize + 1
+	assert.NotNil(t, ValidateExport(doc))
+}
+
+func TestMapUserIDs(t *testing.T) {
+	data := getExportTestData()
+	MapUserIDs(data, map[string]string{"1": "1", "2": "new2", "3": ""})
+
+	assert.Equal(t, []string{"1", "new2"}, data.Pairings["A"].UserIDs)
+	assert.Equal(t, map[string]string{"1": "A", "new2": "A"}, data.ActivePairings)
+	//the only history entry has no partner left
+	assert.Empty(t, data.History["1"])
+	assert.NotContains(t, data.History, "3")
+	assert.Empty(t, data.UserTopics)
+	assert.Equal(t, map[string]struct{}{}, data.Blacklists["new2"])
+	assert.Contains(t, data.Participations, "new2")
+	assert.Equal(t, "1", data.Schedules["channel"].CreatorID)
+}
+
+func TestMapChannelIDs(t *testing.T) {
+	data := getExportTestData()
+	data.History["1"][0].ChannelID = "other"
+	data.Participations["1"].QueuedChannels = map[string]int64{"channel": 10, "other": 20}
+	data.ChannelConfigs["other"] = &ChannelConfig{GroupSize: 4}
+	assert.Equal(t, []string{"channel", "other"}, GetChannelIDs(data))
+
+	MapChannelIDs(data, map[string]string{"channel": "new", "other": ""})
+	assert.Equal(t, "new", data.Pairings["A"].ChannelID)
+	//history entries of unknown channels are kept for the matching
+	assert.Len(t, data.History["1"], 1)
+	assert.Empty(t, data.History["1"][0].ChannelID)
+	assert.Equal(t, map[string]int64{"new": 10}, data.Participations["1"].QueuedChannels)
+	assert.Equal(t, map[string]*Schedule{"new": &Schedule{ChannelID: "new", CreatorID: "1", Timezone: "UTC"}}, data.Schedules)
+	assert.Equal(t, map[string]*ChannelConfig{"new": &ChannelConfig{GroupSize: 3}}, data.ChannelConfigs)
+}
+
+func TestMergeUserData(t *testing.T) {
+	userData := &UserData{
+		History: []*HistoryEntry{&HistoryEntry{PairingID: "B", UserIDs: []string{"1", "3"}, FinishedAt: 10}},
+		Topics:  map[string]struct{}{"Go": struct{}{}},
+	}
+	imported := &UserData{
+		History: []*HistoryEntry{
+			&HistoryEntry{PairingID: "A", UserIDs: []string{"1", "2"}, FinishedAt: 5},
+			&HistoryEntry{PairingID: "B", UserIDs: []string{"1", "3"}, FinishedAt: 10},
+			&HistoryEntry{PairingID: "C", UserIDs: []string{"1", "4"}, FinishedAt: 20},
+		},
+		Topics:        map[string]struct{}{"Rust": struct{}{}},
+		Blacklist:     map[string]struct{}{"5": struct{}{}},
+		Participation: &Participation{Joined: true},
+	}
+	MergeUserData(userData, imported, 2)
+
+	assert.Equal(t, []string{"3", "4"}, GetLastPartners(userData.History, "1"))
+	assert.Len(t, userData.Topics, 2)
+	assert.Contains(t, userData.Blacklist, "5")
+	assert.True(t, userData.Participation.Joined)
+}
+
+func TestExportImport(t *testing.T) {
+	api := &plugintest.API{}
+	for _, user := range []*model.User{&model.User{Id: "1", Username: "john"}, &model.User{Id: "2", Username: "mike"}, &model.User{Id: "3", Username: "anna"}} {
+		api.On("GetUser", user.Id).Return(user, nil)
+	}
+	api.On("GetUser", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", TeamId: "team", Name: "lunch"}, nil)
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetTeam", "team").Return(&model.Team{Id: "team", Name: "acme"}, nil)
+
+	plugin := &Plugin{}
+	plugin.SetAPI(api)
+	data := getExportTestData()
+	invitation := &HistoryEntry{PairingID: "D", UserIDs: []string{"1", "2"}, AcceptedUserIDs: []string{"1"}, FinishedAt: 20, Outcome: OutcomeDeclined, Invitation: true}
+	data.History["1"] = append(data.History["1"], invitation)
+	data.History["2"] = []*HistoryEntry{invitation}
+	data.ChannelConfigs["deleted"] = &ChannelConfig{GroupSize: 4}
+	plugin.store = newMemoryStore(data)
+
+	doc, err := plugin.BuildExport()
+	assert.Nil(t, err)
+	assert.Empty(t, doc.Data.Invitations)
+	assert.Equal(t, map[string]string{"1": "john", "2": "mike", "3": "anna"}, doc.Usernames)
+	assert.Equal(t, map[string]*ExportChannel{"channel": &ExportChannel{TeamName: "acme", ChannelName: "lunch"}}, doc.Channels)
+	content, err := json.Marshal(doc)
+	assert.Nil(t, err)
+
+	//on the other server, john and the channel have a different ID, anna does not exist
+	otherAPI := &plugintest.API{}
+	otherAPI.On("GetUser", "2").Return(&model.User{Id: "2", Username: "mike"}, nil)
+	otherAPI.On("GetUser", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	otherAPI.On("GetUserByUsername", "john").Return(&model.User{Id: "10", Username: "john"}, nil)
+	otherAPI.On("GetUserByUsername", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	otherAPI.On("GetChannel", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	otherAPI.On("GetChannelByNameForTeamName", "acme", "lunch", false).Return(&model.Channel{Id: "newchannel", TeamId: "newteam", Name: "lunch"}, nil)
+
+	otherPlugin := &Plugin{}
+	otherPlugin.SetAPI(otherAPI)
+	otherPlugin.store = newMemoryStore(&LunchbotData{
+		UserTopics: map[string]map[string]struct{}{"2": map[string]struct{}{"Cooking": struct{}{}}},
+	})
+
+	importedDoc := &ExportDocument{}
+	assert.Nil(t, json.Unmarshal(content, importedDoc))
+	_, err = otherPlugin.ImportData(importedDoc, "append")
+	assert.NotNil(t, err)
+	message, err := otherPlugin.ImportData(importedDoc, ImportModeMerge)
+	assert.Nil(t, err)
+	assert.Contains(t, message, "1 pairings")
+	assert.Contains(t, message, "Skipped unknown users: @anna.")
+	assert.Contains(t, message, "1 channel settings")
+	assert.Contains(t, message, "unknown channels: deleted.")
+
+	userData, _ := otherPlugin.store.GetUserData("10")
+	assert.Equal(t, "A", userData.ActivePairingID)
+	userData, _ = otherPlugin.store.GetUserData("2")
+	assert.Equal(t, "A", userData.ActivePairingID)
+	assert.Contains(t, userData.Topics, "Cooking")
+	//the users that accepted an invitation are mapped as well
+	assert.Len(t, userData.History, 1)
+	assert.Equal(t, []string{"10", "2"}, userData.History[0].UserIDs)
+	assert.Equal(t, []string{"10"}, userData.History[0].AcceptedUserIDs)
+	pairing, _ := otherPlugin.store.GetPairing("A")
+	assert.Equal(t, "newchannel", pairing.ChannelID)
+	channelConfig, _ := otherPlugin.store.GetChannelConfig("newchannel")
+	assert.Equal(t, 3, channelConfig.GroupSize)
+	schedule, _ := otherPlugin.store.GetSchedule("newchannel")
+	assert.Equal(t, "10", schedule.CreatorID)
+	assert.Equal(t, "newchannel", schedule.ChannelID)
+	schedule, _ = otherPlugin.store.GetSchedule("channel")
+	assert.Nil(t, schedule)
+	catalogue, _ := otherPlugin.store.GetTopicCatalogue()
+	assert.Contains(t, catalogue, "go")
+	questions, _ := otherPlugin.store.GetQuestions()
+	assert.Contains(t, questions, "Q")
+
+	//replacing removes the existing data
+	assert.Nil(t, json.Unmarshal(content, importedDoc))
+	_, err = otherPlugin.ImportData(importedDoc, ImportModeReplace)
+	assert.Nil(t, err)
+	userData, _ = otherPlugin.store.GetUserData("2")
+	assert.NotContains(t, userData.Topics, "Cooking")
+	assert.Equal(t, "A", userData.ActivePairingID)
+}
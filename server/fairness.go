@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//numListedWaitingUsers is the number of users that are listed in the fairness report
+	numListedWaitingUsers = 20
+	//priorityWaitingTime is how long a user has to wait without getting paired to gain another point of priority
+	priorityWaitingTime = 7 * 24 * time.Hour
+	//unknownWaitingPriority is the priority of users whose waiting time is unknown, it puts them before every user whose waiting time is known
+	unknownWaitingPriority = 1000
+)
+
+// GetLastPairedAt returns when the given user has been paired the last time as Unix timestamp in milliseconds, 0 if the user has never been paired.
+// Pairings from before this was tracked are taken from the history of the user.
+func GetLastPairedAt(data *LunchbotData, userID string) int64 {
+	lastPairedAt := int64(0)
+	if participation, ok := data.Participations[userID]; ok {
+		lastPairedAt = participation.LastPairedAt
+	}
+	if pairing, ok := data.Pairings[data.ActivePairings[userID]]; ok && pairing.CreatedAt > lastPairedAt {
+		lastPairedAt = pairing.CreatedAt
+	}
+	history := data.History[userID]
+	for index := len(history) - 1; index >= 0; index-- {
+		if history[index].IsPairing() {
+			if history[index].CreatedAt > lastPairedAt {
+				lastPairedAt = history[index].CreatedAt
+			}
+			break
+		}
+	}
+	return lastPairedAt
+}
+
+// GetSkippedRounds returns how many pairing rounds in a row the given user has been left out of
+func GetSkippedRounds(data *LunchbotData, userID string) int {
+	if participation, ok := data.Participations[userID]; ok {
+		return participation.SkippedRounds
+	}
+	return 0
+}
+
+// GetWaitingSince returns since when the given user has been waiting for a pairing as Unix timestamp in milliseconds.
+// This is the last pairing of the user, or the time the user joined if the user has never been paired. Returns 0 if neither is known.
+func GetWaitingSince(data *LunchbotData, userID string) int64 {
+	if lastPairedAt := GetLastPairedAt(data, userID); lastPairedAt > 0 {
+		return lastPairedAt
+	}
+	if participation, ok := data.Participations[userID]; ok {
+		return participation.JoinedAt
+	}
+	return 0
+}
+
+// GetFairnessPriority returns how urgently the given user should get matched in a pairing round. This is the number of rounds in a row
+// the user has been left out of, plus a point for every week the user has been waiting for a pairing.
+// Users that have never been paired and joined before join times were recorded have been waiting the longest.
+func GetFairnessPriority(data *LunchbotData, userID string, now time.Time) int {
+	priority := GetSkippedRounds(data, userID)
+	waitingSince := GetWaitingSince(data, userID)
+	if waitingSince <= 0 {
+		return priority + unknownWaitingPriority
+	}
+	waitingTime := now.Sub(time.Unix(0, waitingSince*int64(time.Millisecond)))
+	return priority + int(waitingTime/priorityWaitingTime)
+}
+
+// GetFairnessPriorities returns the priorities of the given users, users without any priority are not contained
+func GetFairnessPriorities(data *LunchbotData, users []*model.User, now time.Time) map[string]int {
+	priorities := map[string]int{}
+	for _, user := range users {
+		if priority := GetFairnessPriority(data, user.Id, now); priority > 0 {
+			priorities[user.Id] = priority
+		}
+	}
+	return priorities
+}
+
+// RecordSkippedUsers counts another pairing round that the given users have been left out of
+func (p *Plugin) RecordSkippedUsers(users []*model.User) {
+	for _, user := range users {
+		_, err := p.store.UpdateUserData(user.Id, func(userData *UserData) error {
+			userData.GetParticipation().SkippedRounds++
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to record skipped user", "user_id", user.Id, "err", err.Error())
+		}
+	}
+}
+
+// GetFairnessReportMsg returns a message that lists the participants among the given channel members that have been waiting the longest for a pairing.
+// They are listed in the order they go first in the next pairing round.
+func GetFairnessReportMsg(data *LunchbotData, members []*model.User, channelID string, now time.Time) string {
+	participants := []*model.User{}
+	for _, user := range members {
+		if !user.IsBot && IsParticipating(data, user.Id, channelID, now) {
+			participants = append(participants, user)
+		}
+	}
+	if len(participants) <= 0 {
+		return "Nobody takes part in the pairings of this channel yet."
+	}
+	priorities := map[string]int{}
+	for _, user := range participants {
+		priorities[user.Id] = GetFairnessPriority(data, user.Id, now)
+	}
+	sort.SliceStable(participants, func(i, j int) bool {
+		iPriority, jPriority := priorities[participants[i].Id], priorities[participants[j].Id]
+		if iPriority != jPriority {
+			return iPriority > jPriority
+		}
+		return GetWaitingSince(data, participants[i].Id) < GetWaitingSince(data, participants[j].Id)
+	})
+	if len(participants) > numListedWaitingUsers {
+		participants = participants[:numListedWaitingUsers]
+	}
+
+	formatAge := func(timestamp int64) string {
+		return FormatAge(now.Sub(time.Unix(0, timestamp*int64(time.Millisecond))))
+	}
+	message := fmt.Sprintf("Participants of this channel that have been waiting the longest for a pairing (%d):\n", len(participants))
+	for _, user := range participants {
+		waiting := "never paired"
+		if lastPairedAt := GetLastPairedAt(data, user.Id); lastPairedAt > 0 {
+			waiting = fmt.Sprintf("last paired %s ago", formatAge(lastPairedAt))
+		} else if waitingSince := GetWaitingSince(data, user.Id); waitingSince > 0 {
+			waiting = fmt.Sprintf("never paired, joined %s ago", formatAge(waitingSince))
+		}
+		if skippedRounds := GetSkippedRounds(data, user.Id); skippedRounds > 0 {
+			waiting += fmt.Sprintf(", left out of the last %d rounds", skippedRounds)
+		}
+		if priority := priorities[user.Id]; priority > 0 {
+			waiting += fmt.Sprintf(", goes first with priority %d", priority)
+		}
+		message += fmt.Sprintf("  - @%s: %s\n", user.Username, waiting)
+	}
+	return message
+}
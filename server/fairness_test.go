@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFairnessPriority(t *testing.T) {
+	now := time.Date(2020, time.June, 29, 12, 0, 0, 0, time.UTC)
+	toMillis := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+	data := &LunchbotData{
+		Participations: getJoinedParticipations("1", "2", "3", "4", "5", "6"),
+		History: map[string][]*HistoryEntry{
+			"2": []*HistoryEntry{
+				&HistoryEntry{UserIDs: []string{"2", "5"}, CreatedAt: toMillis(now.AddDate(0, 0, -30)), Outcome: OutcomeFinished},
+				&HistoryEntry{UserIDs: []string{"2", "6"}, CreatedAt: toMillis(now.AddDate(0, 0, -2)), Invitation: true},
+			},
+		},
+		ActivePairings: map[string]string{"3": "pairing"},
+		Pairings:       map[string]*Pairing{"pairing": &Pairing{ID: "pairing", UserIDs: []string{"3", "5"}, CreatedAt: toMillis(now.AddDate(0, 0, -1))}},
+	}
+	data.Participations["1"].JoinedAt = toMillis(now.AddDate(0, 0, -15))
+	data.Participations["1"].SkippedRounds = 2
+	data.Participations["4"].LastPairedAt = toMillis(now.AddDate(0, 0, -15))
+	data.Participations["4"].SkippedRounds = 1
+	data.Participations["5"].JoinedAt = toMillis(now.AddDate(0, 0, -10))
+	data.Participations["6"].LastPairedAt = toMillis(now.AddDate(0, 0, -2))
+
+	//never paired users wait since they joined
+	assert.Equal(t, int64(0), GetLastPairedAt(data, "1"))
+	assert.Equal(t, toMillis(now.AddDate(0, 0, -15)), GetWaitingSince(data, "1"))
+	assert.Equal(t, 4, GetFairnessPriority(data, "1", now))
+	//invitations do not count as pairings
+	assert.Equal(t, toMillis(now.AddDate(0, 0, -30)), GetLastPairedAt(data, "2"))
+	assert.Equal(t, 4, GetFairnessPriority(data, "2", now))
+	assert.Equal(t, 0, GetFairnessPriority(data, "3", now))
+	assert.Equal(t, 3, GetFairnessPriority(data, "4", now))
+	//a new participant goes before someone that has been paired more recently
+	assert.Greater(t, GetFairnessPriority(data, "5", now), GetFairnessPriority(data, "6", now))
+	//the waiting time of users that joined before join times were recorded is unknown
+	delete(data.Participations, "6")
+	data.Participations["7"] = &Participation{Joined: true}
+	assert.Equal(t, int64(0), GetWaitingSince(data, "7"))
+	assert.Equal(t, unknownWaitingPriority, GetFairnessPriority(data, "7", now))
+
+	users := []*model.User{&model.User{Id: "1"}, &model.User{Id: "2"}, &model.User{Id: "3"}, &model.User{Id: "4"}, &model.User{Id: "5"}}
+	assert.Equal(t, map[string]int{"1": 4, "2": 4, "4": 3, "5": 1}, GetFairnessPriorities(data, users, now))
+}
+
+func TestRecordSkippedUsers(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(&LunchbotData{Participations: getJoinedParticipations("1", "2")})
+	users := []*model.User{&model.User{Id: "1"}, &model.User{Id: "2"}}
+
+	plugin.RecordSkippedUsers(users)
+	plugin.RecordSkippedUsers(users[:1])
+	data, _ := plugin.store.ReadAll()
+	assert.Equal(t, 2, GetSkippedRounds(&data, "1"))
+	assert.Equal(t, 1, GetSkippedRounds(&data, "2"))
+
+	//a pairing resets the skipped rounds
+	pairing := &Pairing{ID: "pairing", ChannelID: "channel", UserIDs: []string{"1", "3"}, CreatedAt: 1000}
+	plugin.markPaired(pairing)
+	data, _ = plugin.store.ReadAll()
+	assert.Equal(t, 0, GetSkippedRounds(&data, "1"))
+	assert.Equal(t, int64(1000), data.Participations["1"].LastPairedAt)
+	assert.Equal(t, 1, GetSkippedRounds(&data, "2"))
+}
+
+func TestMatchUsers_priorities(t *testing.T) {
+	users := []*model.User{&model.User{Id: "A"}, &model.User{Id: "B"}, &model.User{Id: "P"}}
+	//P and B can only be paired with A, P has been waiting longer and goes first
+	data := &LunchbotData{
+		Blacklists: map[string]map[string]struct{}{
+			"B": map[string]struct{}{"P": struct{}{}},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		ctx := newTestMatchContext(data, nil, int64(i))
+		ctx.Priorities = map[string]int{"P": 3, "B": 1}
+		groups, unmatched := MatchUsers(ctx, NewMatcher(WeightedRandomStrategy{}), users, 2, nil)
+		assert.Len(t, groups, 1)
+		assert.ElementsMatch(t, []string{"A", "P"}, GetUserIDList(groups[0]))
+		assert.Equal(t, []string{"B"}, GetUserIDList(unmatched))
+	}
+
+	//queued users still go first
+	ctx := newTestMatchContext(data, nil, 1)
+	ctx.Priorities = map[string]int{"P": 3}
+	sortedUsers := SortUsersForMatching(ctx, users, map[string]struct{}{"B": struct{}{}})
+	assert.Equal(t, []string{"B", "P"}, GetUserIDList(sortedUsers)[:2])
+}
+
+func TestGetFairnessReportMsg(t *testing.T) {
+	now := time.Date(2020, time.June, 29, 12, 0, 0, 0, time.UTC)
+	data := &LunchbotData{Participations: getJoinedParticipations("1", "2", "3")}
+	data.Participations["1"].LastPairedAt = now.Add(-50*time.Hour).UnixNano() / int64(time.Millisecond)
+	data.Participations["2"].JoinedAt = now.AddDate(0, 0, -8).UnixNano() / int64(time.Millisecond)
+	data.Participations["2"].SkippedRounds = 2
+	members := []*model.User{
+		&model.User{Id: "1", Username: "one"},
+		&model.User{Id: "2", Username: "two"},
+		&model.User{Id: "3", Username: "three"},
+		&model.User{Id: "4", Username: "four"},
+		&model.User{Id: "bot", Username: "bot", IsBot: true},
+	}
+
+	//the participants are listed in the order they go first in the next round
+	message := GetFairnessReportMsg(data, members, "channel", now)
+	assert.Equal(t, "Participants of this channel that have been waiting the longest for a pairing (3):\n"+
+		"  - @three: never paired, goes first with priority 1000\n"+
+		"  - @two: never paired, joined 8d 0h ago, left out of the last 2 rounds, goes first with priority 3\n"+
+		"  - @one: last paired 2d 2h ago\n", message)
+	assert.Equal(t, "Nobody takes part in the pairings of this channel yet.", GetFairnessReportMsg(&LunchbotData{}, members, "channel", now))
+}
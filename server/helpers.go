@@ -4,36 +4,79 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v5/model"
-	"github.com/mroth/weightedrand"
+	"github.com/pkg/errors"
 )
 
-// GetRandomTopicsMsg return a random topic for the given userIDs
+// GetRandomTopicsMsg return the topics the given userIDs share and a random topic for each of them
 // Return nothing when there's no topics stored for the userIDs
 func (p *Plugin) GetRandomTopicsMsg(userIDs []string) string {
+	data := &LunchbotData{UserTopics: map[string]map[string]struct{}{}}
+	for _, userID := range userIDs {
+		userData, err := p.store.GetUserData(userID)
+		if err != nil {
+			p.API.LogError("Failed to read user data", "user_id", userID, "err", err.Error())
+			continue
+		}
+		data.UserTopics[userID] = userData.Topics
+	}
 
-	randomTopics := []string{}
+	//topics that at least two of the users share get named first
+	sharedTopics := map[string]struct{}{}
 	for _, userID := range userIDs {
-		data := p.ReadFromStorage()
-		if topics, ok := data.UserTopics[userID]; ok {
-			topicKeys := reflect.ValueOf(topics).MapKeys()
-			if len(topicKeys) > 0 {
-				rand.Shuffle(len(topicKeys), func(i, j int) {
-					topicKeys[i], topicKeys[j] = topicKeys[j], topicKeys[i]
-				})
-				randomTopics = append(randomTopics, fmt.Sprintf("%s", topicKeys[0]))
+		for _, otherUserID := range userIDs {
+			if userID == otherUserID {
+				continue
+			}
+			for _, topic := range GetSharedTopics(data, userID, otherUserID) {
+				if _, ok := FindTopic(sharedTopics, topic); !ok {
+					sharedTopics[topic] = struct{}{}
+				}
 			}
 		}
 	}
 
-	if len(randomTopics) <= 0 {
-		return ""
+	randomTopics := []string{}
+	pickedTopics := map[string]struct{}{}
+	for _, userID := range userIDs {
+		topicKeys := []string{}
+		for topic := range data.UserTopics[userID] {
+			_, isShared := FindTopic(sharedTopics, topic)
+			_, isPicked := FindTopic(pickedTopics, topic)
+			if !isShared && !isPicked {
+				topicKeys = append(topicKeys, topic)
+			}
+		}
+		if len(topicKeys) > 0 {
+			sort.Strings(topicKeys)
+			rand.Shuffle(len(topicKeys), func(i, j int) {
+				topicKeys[i], topicKeys[j] = topicKeys[j], topicKeys[i]
+			})
+			randomTopics = append(randomTopics, topicKeys[0])
+			pickedTopics[topicKeys[0]] = struct{}{}
+		}
 	}
 
-	return fmt.Sprintf("You could talk about %s", strings.Join(randomTopics, " or "))
+	message := ""
+	if len(sharedTopics) > 0 {
+		topics := []string{}
+		for topic := range sharedTopics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		message = fmt.Sprintf("You share an interest in %s!", strings.Join(topics, ", "))
+		if len(randomTopics) > 0 {
+			message += fmt.Sprintf(" You could also talk about %s", strings.Join(randomTopics, " or "))
+		}
+	} else if len(randomTopics) > 0 {
+		message = fmt.Sprintf("You could talk about %s", strings.Join(randomTopics, " or "))
+	}
+	return message
 }
 
 //GetUser returns a user that is identified by a given string. It tries different ways to get the user.
@@ -91,78 +134,367 @@ func (p *Plugin) SendGroupMessage(message string, userIDs []string) *model.Comma
 	return nil
 }
 
+// SendDirectMessage sends the given message to the given user as a direct message from the bot
+func (p *Plugin) SendDirectMessage(message string, userID string) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get the direct channel")
+	}
+	post := &model.Post{
+		ChannelId: channel.Id,
+		UserId:    p.botID,
+		Message:   message,
+	}
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
+
+// SendDirectMessageWithFiles sends the given message with the given files attached to the given user as a direct message from the bot.
+// The files are given as name and content, they are attached in the order of their names.
+func (p *Plugin) SendDirectMessageWithFiles(message string, userID string, files map[string][]byte) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get the direct channel")
+	}
+	fileNames := []string{}
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	post := &model.Post{
+		ChannelId: channel.Id,
+		UserId:    p.botID,
+		Message:   message,
+	}
+	for _, fileName := range fileNames {
+		fileInfo, appErr := p.API.UploadFile(files[fileName], channel.Id, fileName)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to upload %s", fileName)
+		}
+		post.FileIds = append(post.FileIds, fileInfo.Id)
+	}
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
+
 // GetPairingForUserID returns a random user that is found in the given channel and that is not a bot
-// This function is limited to 1000 users per channel
+// Only the configured number of channel members is considered
 func (p *Plugin) GetPairingForUserID(channelID string, userID string) (*model.User, *model.AppError) {
-	users, _ := p.API.GetUsersInChannel(channelID, "username", 0, 1000)
+	users, err := p.GetGroupForUserID(channelID, userID, 2, nil)
+	if err != nil {
+		return nil, err
+	}
+	return users[0], nil
+}
 
-	//read the users data for blacklist and weightedrandom
-	data := p.ReadFromStorage()
+// GetGroupForUserID returns up to groupSize-1 users that are found in the given channel and that are not bots, picked by the match strategy of the channel.
+// The returned users do not include the triggering user. The excluded users will not be picked.
+// If a maximum number of channel members is configured, only that many members are considered.
+func (p *Plugin) GetGroupForUserID(channelID string, userID string, groupSize int, excludedUserIDs []string) ([]*model.User, *model.AppError) {
+	config := p.getConfiguration()
+	cache := NewUserCache(p.API)
 
-	weightedUsers := []weightedrand.Choice{} //list of users, sorted by weight
-	for _, user := range users {
-		//is this the triggering user?
-		if user.Id == userID {
-			continue
-		}
-		//is this a bot?
-		if user.IsBot {
-			continue
+	settings := p.GetChannelSettings(channelID)
+	ctx := &MatchContext{
+		Config:    config,
+		ChannelID: channelID,
+		Now:       time.Now(),
+		Rand:      GlobalRand(),
+	}
+	pipeline := &CandidatePipeline{
+		//read the users data for blacklist and weightedrandom, including the data of the triggering user
+		Source: &ChannelMemberSource{Cache: cache, MaxMembers: config.MaxChannelMembers, Store: p.store, UserIDs: []string{userID}},
+		Filters: []CandidateFilter{
+			//the triggering user and users that have been excluded, e.g. because they already declined the invitation
+			ExcludedUsersFilter(append([]string{userID}, excludedUserIDs...)),
+			BotFilter,
+			PairedFilter,
+			InvitationFilter,
+			ParticipationFilter,
+			p.RoleFilter(settings.EligibleRoles),
+			BlacklistFilter(userID),
+			p.NewAvailabilityFilter(cache),
+		},
+	}
+	candidates, appErr := pipeline.GetCandidates(ctx)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	departmentUsers := candidates
+	if triggeringUser, ok := cache.LookupUser(userID); ok {
+		departmentUsers = append([]*model.User{triggeringUser}, candidates...)
+	}
+	ctx.Departments = p.GetDepartments(departmentUsers)
+
+	pickedUsers := NewMatcher(GetMatchStrategy(settings.MatchStrategy)).FillGroup(ctx, []string{userID}, candidates, groupSize)
+	if len(pickedUsers) > 0 {
+		return pickedUsers, nil
+	}
+
+	return nil, &model.AppError{
+		Message: "Cannot find a user to pair with in this channel...",
+	}
+}
+
+// IsBlacklisted returns true if one of the given users has blacklisted the other one
+func IsBlacklisted(data *LunchbotData, userID string, otherUserID string) bool {
+	if data.Blacklists == nil {
+		return false
+	}
+	if blacklist, ok := data.Blacklists[userID]; ok {
+		if _, ok := blacklist[otherUserID]; ok {
+			return true
 		}
-		//is the user already paired?
-		if _, ok := data.ActivePairings[user.Id]; ok {
-			continue
+	}
+	if blacklist, ok := data.Blacklists[otherUserID]; ok {
+		if _, ok := blacklist[userID]; ok {
+			return true
 		}
-		//is this user offline?
-		status, err := p.API.GetUserStatus(user.Id)
-		if (err != nil) || (status.Status == "offline") {
-			continue
+	}
+	return false
+}
+
+// GetPairingWeight returns how much the given user should be preferred as partner for a user with the given recent partners, the most recent partner is the last one.
+// Users that have been paired with the user recently get a lower weight.
+func GetPairingWeight(config *configuration, lastPartners []string, otherUserID string) uint {
+	//check if the user has already been paired lately. Add him with a weight according to how recent the pairing has been
+	//by iterating in reverse we make sure that users that appear multiple times in the list will not mess up the weights
+	for index := len(lastPartners) - 1; index >= 0; index-- {
+		if lastPartners[index] == otherUserID {
+			return uint(math.Abs(float64(index - len(lastPartners))))
 		}
-		//is this user on a blacklist? Is the triggering user on the users blacklist?
-		if data.Blacklists != nil {
-			if blacklist, ok := data.Blacklists[userID]; ok {
-				if _, ok := blacklist[user.Id]; ok {
-					continue
-				}
-			}
-			if blacklist, ok := data.Blacklists[user.Id]; ok {
-				if _, ok := blacklist[userID]; ok {
-					continue
-				}
+	}
+
+	//Finally... this is a brand-new user that has never paired with our triggering user. Add him with a very high weight, so he'll be chosen with a high possibility
+	return uint(config.NewUserWeight)
+}
+
+// GetPairedUserIDs returns the IDs of all users that are in the same pairing as the given user, including the user himself
+func GetPairedUserIDs(data *LunchbotData, userID string) []string {
+	pairingID, ok := data.ActivePairings[userID]
+	if !ok {
+		return []string{}
+	}
+	pairing, ok := data.Pairings[pairingID]
+	if !ok {
+		return []string{}
+	}
+	return pairing.UserIDs
+}
+
+// storePairing stores the given pairing and marks its members as paired.
+// Fails without changing anything if one of the members has been paired by someone else in the meantime.
+func (p *Plugin) storePairing(pairing *Pairing) error {
+	if err := p.store.CreatePairing(pairing); err != nil {
+		return err
+	}
+	pairedUserIDs := []string{}
+	for _, userID := range pairing.UserIDs {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			if len(userData.ActivePairingID) > 0 && userData.ActivePairingID != pairing.ID {
+				return errAlreadyPaired
 			}
+			userData.ActivePairingID = pairing.ID
+			return nil
+		})
+		if err != nil {
+			p.releasePairing(pairing.ID, pairedUserIDs)
+			return err
 		}
+		pairedUserIDs = append(pairedUserIDs, userID)
+	}
+	return nil
+}
 
-		//check if the user has already been paired lately. Add him with a weight according to how recent the pairing has been
-		//by iterating in reverse we make sure that users that appear multiple times in the list will not mess up the weights
-		isNewUser := true
-		if data.LastPairings != nil {
-			for index := len(data.LastPairings[userID]) - 1; index >= 0; index-- {
-				currentUserID := data.LastPairings[userID][index]
-				if currentUserID == user.Id {
-					userWeight := uint(math.Abs(float64(index - len(data.LastPairings[userID]))))
-					weightedUsers = append(weightedUsers, weightedrand.Choice{Weight: userWeight, Item: user})
-					isNewUser = false
-					break
-				}
+// releasePairing deletes the given pairing and marks the given users as not paired anymore. Returns the deleted pairing,
+// nil if it has already been deleted by someone else.
+func (p *Plugin) releasePairing(pairingID string, userIDs []string) *Pairing {
+	pairing, err := p.store.DeletePairing(pairingID)
+	if err != nil {
+		p.API.LogError("Failed to delete pairing", "pairing_id", pairingID, "err", err.Error())
+	}
+	for _, userID := range userIDs {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			if userData.ActivePairingID == pairingID {
+				userData.ActivePairingID = ""
 			}
-			if !isNewUser { //if the user has been found within our recentpairing we can continue the loop
-				continue
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to release user from pairing", "user_id", userID, "err", err.Error())
+		}
+	}
+	return pairing
+}
+
+// markPaired records in the participation of the members of the given pairing that they got paired: they are no longer queued
+// in the channel of the pairing and stop waiting for a pairing
+func (p *Plugin) markPaired(pairing *Pairing) {
+	for _, userID := range pairing.UserIDs {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			if userData.Participation != nil {
+				delete(userData.Participation.QueuedChannels, pairing.ChannelID)
+				userData.Participation.LastPairedAt = pairing.CreatedAt
+				userData.Participation.SkippedRounds = 0
 			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to record the pairing of user", "user_id", userID, "err", err.Error())
 		}
+	}
+}
+
+// StartPairing stores the pairing of the given users, sends them a group message and advertises the pairing in the given channel.
+// If the users cannot be notified, the pairing is released again, so it does not keep them from getting paired.
+func (p *Plugin) StartPairing(channelID string, pairedUsers []*model.User) *model.CommandResponse {
+	pairing := &Pairing{
+		ID:        model.NewId(),
+		ChannelID: channelID,
+		CreatedAt: model.GetMillis(),
+	}
+	for _, user := range pairedUsers {
+		pairing.UserIDs = append(pairing.UserIDs, user.Id)
+	}
+	users := pairing.UserIDs
 
-		//Finally... this is a brand-new user that has never paired with our triggering user. Add him with a very high weight, so he'll be chosen with a high possibility
-		weightedUsers = append(weightedUsers, weightedrand.Choice{Weight: 1000, Item: user})
+	//the questions are remembered with the pairing, so the users do not get them again in later pairings
+	questions, err := p.PickQuestionsForUsers(users)
+	if err != nil {
+		p.API.LogError("Failed to pick icebreaker questions", "err", err.Error())
+	}
+	for _, question := range questions {
+		pairing.QuestionIDs = append(pairing.QuestionIDs, question.ID)
 	}
 
-	if len(weightedUsers) > 0 {
-		chooser := weightedrand.NewChooser(weightedUsers...)
-		user, ok := chooser.Pick().(*model.User)
-		if ok {
-			return user, nil
+	if err := p.storePairing(pairing); err != nil {
+		p.API.LogError("Failed to store pairing", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Error: Cannot store the pairing: %s", err.Error()),
 		}
 	}
 
-	return nil, &model.AppError{
-		Message: "Cannot find a user to pair with in this channel...",
+	if resp := p.notifyPairing(pairing, pairedUsers, questions); resp != nil {
+		p.releasePairing(pairing.ID, pairing.UserIDs)
+		return resp
 	}
+	p.markPaired(pairing)
+	return nil
+}
+
+// notifyPairing sends the group messages of the given pairing to its members and advertises it in its channel
+func (p *Plugin) notifyPairing(pairing *Pairing, pairedUsers []*model.User, questions []*Question) *model.CommandResponse {
+	channelID, users := pairing.ChannelID, pairing.UserIDs
+	names := []string{}
+	for _, user := range pairedUsers {
+		names = append(names, "@"+user.GetDisplayName(""))
+	}
+	settings := p.GetChannelSettings(channelID)
+	greeting := "Hey! I think both of you should meet for lunch soon!"
+	if len(users) > 2 {
+		greeting = "Hey! I think all of you should meet for lunch soon!"
+	}
+	if len(settings.WelcomeMessage) > 0 {
+		greeting = settings.WelcomeMessage
+	}
+	resp := p.SendGroupMessage(greeting, users)
+	if resp != nil {
+		return resp
+	}
+
+	if reason := GetCrossDepartmentMsg(pairedUsers, p.GetDepartments(pairedUsers)); len(reason) > 0 {
+		resp = p.SendGroupMessage(reason, users)
+		if resp != nil {
+			return resp
+		}
+	}
+
+	if topics := p.GetRandomTopicsMsg(users); len(topics) > 0 {
+		resp = p.SendGroupMessage(topics, users)
+		if resp != nil {
+			return resp
+		}
+	}
+
+	if questionsMsg := GetQuestionsMsg(questions); len(questionsMsg) > 0 {
+		resp = p.SendGroupMessage(questionsMsg, users)
+		if resp != nil {
+			return resp
+		}
+	}
+
+	resp = p.SendGroupMessage("You can finish this pairing by entering `/lunchbot finish`. Have fun!", users)
+	if resp != nil {
+		return resp
+	}
+
+	if !settings.PostAnnouncement {
+		return nil
+	}
+
+	//advertise the lunchbot a bit :)
+	message := fmt.Sprintf("Yeah! %s and %s are going to lunch together! I am lunchbot, and you can trigger me by entering `/lunchbot` :sunglasses::point_right::point_right:",
+		strings.Join(names[:len(names)-1], ", "),
+		names[len(names)-1])
+	post := &model.Post{
+		ChannelId: channelID,
+		UserId:    p.botID,
+		Message:   message,
+	}
+	if _, err := p.API.CreatePost(post); err != nil {
+		const errorMessage = "Error: Failed to create post"
+		p.API.LogError(errorMessage, "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         errorMessage,
+		}
+	}
+
+	return nil
+}
+
+// ParseGroupSize parses the given group size and makes sure that it is within the allowed range
+func ParseGroupSize(groupSizeStr string) (int, error) {
+	groupSize, err := strconv.Atoi(groupSizeStr)
+	if err != nil || groupSize < MinGroupSize || groupSize > MaxGroupSize {
+		return 0, errors.Errorf("'%s' is not a valid group size, please enter a number between %d and %d", groupSizeStr, MinGroupSize, MaxGroupSize)
+	}
+	return groupSize, nil
+}
+
+// ContainsString returns true if the given list contains the given value
+func ContainsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsInt returns true if the given list contains the given value
+func ContainsInt(list []int, value int) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// IsChannelAdmin returns true if the given user is allowed to manage the given channel. System admins are always allowed.
+func (p *Plugin) IsChannelAdmin(userID string, channelID string) bool {
+	return p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_MANAGE_CHANNEL_ROLES)
+}
+
+// IsSystemAdmin returns true if the given user is allowed to manage the whole system
+func (p *Plugin) IsSystemAdmin(userID string) bool {
+	return p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM)
 }
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"math/rand"
 	"testing"
 
@@ -12,11 +10,31 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// getJoinedParticipations returns participations for the given users that joined the pairings of every channel
+func getJoinedParticipations(userIDs ...string) map[string]*Participation {
+	participations := map[string]*Participation{}
+	for _, userID := range userIDs {
+		participations[userID] = &Participation{Joined: true}
+	}
+	return participations
+}
+
+// getStatuses returns a function that returns the given status for every given user, as expected by GetUserStatusesByIds
+func getStatuses(status string) func(userIDs []string) []*model.Status {
+	return func(userIDs []string) []*model.Status {
+		statuses := []*model.Status{}
+		for _, userID := range userIDs {
+			statuses = append(statuses, &model.Status{UserId: userID, Status: status})
+		}
+		return statuses
+	}
+}
+
 func TestGetPairingForUserID(t *testing.T) {
 	t.Run("Empty channel, empty data", func(t *testing.T) {
-		lunchbotData := &LunchbotData{}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
+		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1"),
+		}
 
 		users := []*model.User{
 			&model.User{
@@ -27,8 +45,8 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		_, err := plugin.GetPairingForUserID("", "1337")
@@ -36,9 +54,9 @@ func TestGetPairingForUserID(t *testing.T) {
 	})
 
 	t.Run("Some users, empty data", func(t *testing.T) {
-		lunchbotData := &LunchbotData{}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
+		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1"),
+		}
 
 		users := []*model.User{
 			&model.User{
@@ -52,8 +70,8 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		user, _ := plugin.GetPairingForUserID("", "1337")
@@ -61,9 +79,9 @@ func TestGetPairingForUserID(t *testing.T) {
 	})
 
 	t.Run("Bot user", func(t *testing.T) {
-		lunchbotData := &LunchbotData{}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
+		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1"),
+		}
 
 		users := []*model.User{
 			&model.User{
@@ -78,8 +96,8 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		_, err := plugin.GetPairingForUserID("", "1337")
@@ -87,9 +105,9 @@ func TestGetPairingForUserID(t *testing.T) {
 	})
 
 	t.Run("Offline user", func(t *testing.T) {
-		lunchbotData := &LunchbotData{}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
+		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1"),
+		}
 
 		users := []*model.User{
 			&model.User{
@@ -103,8 +121,34 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "offline"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("offline"), nil)
+		plugin.SetAPI(api)
+
+		_, err := plugin.GetPairingForUserID("", "1337")
+		assert.Equal(t, "Cannot find a user to pair with in this channel...", err.Message)
+	})
+
+	t.Run("User outside of the set availability", func(t *testing.T) {
+		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1"),
+		}
+		lunchbotData.Participations["1"].Availability = &Availability{}
+
+		users := []*model.User{
+			&model.User{
+				Id: "1",
+			},
+			&model.User{
+				Id: "1337",
+			},
+		}
+
+		plugin := &Plugin{}
+		api := &plugintest.API{}
+		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		_, err := plugin.GetPairingForUserID("", "1337")
@@ -113,14 +157,13 @@ func TestGetPairingForUserID(t *testing.T) {
 
 	t.Run("Blacklisted user", func(t *testing.T) {
 		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1", "1337"),
 			Blacklists: map[string]map[string]struct{}{
 				"1337": map[string]struct{}{
 					"1": struct{}{},
 				},
 			},
 		}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
 
 		users := []*model.User{
 			&model.User{
@@ -134,24 +177,57 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		_, err := plugin.GetPairingForUserID("", "1337")
 		assert.Equal(t, "Cannot find a user to pair with in this channel...", err.Message)
 	})
 
+	t.Run("User did not join", func(t *testing.T) {
+		lunchbotData := &LunchbotData{
+			Participations: map[string]*Participation{
+				"1": &Participation{Joined: true, Channels: map[string]bool{"channel": false}},
+				"2": &Participation{Joined: true, PausedUntil: model.GetMillis() + 60000},
+			},
+		}
+
+		users := []*model.User{
+			&model.User{
+				Id: "1",
+			},
+			&model.User{
+				Id: "2",
+			},
+			&model.User{
+				Id: "3",
+			},
+			&model.User{
+				Id: "1337",
+			},
+		}
+
+		plugin := &Plugin{}
+		api := &plugintest.API{}
+		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
+		plugin.SetAPI(api)
+
+		_, err := plugin.GetPairingForUserID("channel", "1337")
+		assert.Equal(t, "Cannot find a user to pair with in this channel...", err.Message)
+	})
+
 	t.Run("Triggering user is blacklisted", func(t *testing.T) {
 		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("1", "1337"),
 			Blacklists: map[string]map[string]struct{}{
 				"1": map[string]struct{}{
 					"1337": struct{}{},
 				},
 			},
 		}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
 
 		users := []*model.User{
 			&model.User{
@@ -165,8 +241,8 @@ func TestGetPairingForUserID(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		_, err := plugin.GetPairingForUserID("", "1337")
@@ -176,6 +252,7 @@ func TestGetPairingForUserID(t *testing.T) {
 func TestGetPairingForUserID_weightedTests(t *testing.T) {
 	t.Run("Many users, checking weighted choice", func(t *testing.T) {
 		lunchbotData := &LunchbotData{
+			Participations: getJoinedParticipations("SomeTimeAgo", "MediumRecent", "MostRecent", "NeverPairedWith"),
 			LastPairings: map[string][]string{
 				"1337": []string{
 					"SomeTimeAgo",
@@ -184,8 +261,6 @@ func TestGetPairingForUserID_weightedTests(t *testing.T) {
 				},
 			},
 		}
-		reqBodyBytes := new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
 
 		users := []*model.User{
 			&model.User{
@@ -208,8 +283,8 @@ func TestGetPairingForUserID_weightedTests(t *testing.T) {
 		plugin := &Plugin{}
 		api := &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		rand.Seed(1337) //initing rand for this test to be deterministic
@@ -237,6 +312,7 @@ func TestGetPairingForUserID_weightedTests(t *testing.T) {
 
 		//add "NeverPairedWith" as most recent pairing and see what happens
 		lunchbotData = &LunchbotData{
+			Participations: getJoinedParticipations("SomeTimeAgo", "MediumRecent", "MostRecent", "NeverPairedWith"),
 			LastPairings: map[string][]string{
 				"1337": []string{
 					"SomeTimeAgo",
@@ -246,12 +322,10 @@ func TestGetPairingForUserID_weightedTests(t *testing.T) {
 				},
 			},
 		}
-		reqBodyBytes = new(bytes.Buffer)
-		json.NewEncoder(reqBodyBytes).Encode(lunchbotData)
 		api = &plugintest.API{}
 		api.On("GetUsersInChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(users, nil)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(reqBodyBytes.Bytes(), nil)
-		api.On("GetUserStatus", mock.AnythingOfType("string")).Return(&model.Status{Status: "online"}, nil)
+		plugin.store = newMemoryStore(lunchbotData)
+		api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses("online"), nil)
 		plugin.SetAPI(api)
 
 		user, _ = plugin.GetPairingForUserID("", "1337")
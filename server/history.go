@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//OutcomeFinished means that the users finished their pairing
+	OutcomeFinished = "finished"
+	//OutcomeDeclined means that one of the invited users declined the invitation
+	OutcomeDeclined = "declined"
+	//OutcomeExpired means that the users did not answer or finish in time
+	OutcomeExpired = "expired"
+	//OutcomeCancelled means that the pairing has been stopped before the users finished it
+	OutcomeCancelled = "cancelled"
+
+	//DefaultHistoryCount is the number of history entries that are shown when the user does not ask for a specific number
+	DefaultHistoryCount = 10
+	//pairingLogMonthLayout is the layout of the months the pairing log is split into
+	pairingLogMonthLayout = "2006-01"
+)
+
+// HistoryEntry records a pairing or invitation of a user once it is over
+type HistoryEntry struct {
+	PairingID  string   `json:"PairingID"`  //ID of the pairing, or of the invitation if the users never got paired
+	ChannelID  string   `json:"ChannelID"`  //Channel the pairing has been triggered in
+	UserIDs    []string `json:"UserIDs"`    //Members of the pairing, including the user himself
+	CreatedAt  int64    `json:"CreatedAt"`  //Unix timestamp in milliseconds
+	FinishedAt int64    `json:"FinishedAt"` //Unix timestamp in milliseconds
+	Outcome    string   `json:"Outcome"`    //How the pairing ended, one of the Outcome constants
+	Invitation bool     `json:"Invitation"` //True if the users never got paired because the invitation was not accepted
+
+	AcceptedUserIDs []string `json:"AcceptedUserIDs"` //Users that accepted the invitation including the requester, only set for invitations
+	QuestionIDs     []string `json:"QuestionIDs"`     //Icebreaker questions that have been suggested to the members, only set for pairings
+}
+
+// IsPairing returns true if the users of the entry actually got paired with each other
+func (e *HistoryEntry) IsPairing() bool {
+	return !e.Invitation
+}
+
+// NewPairingHistoryEntry returns the history entry of the given pairing that ended with the given outcome
+func NewPairingHistoryEntry(pairing *Pairing, outcome string) *HistoryEntry {
+	return &HistoryEntry{
+		PairingID:  pairing.ID,
+		ChannelID:  pairing.ChannelID,
+		UserIDs:    pairing.UserIDs,
+		CreatedAt:  pairing.CreatedAt,
+		FinishedAt: model.GetMillis(),
+		Outcome:    outcome,
+
+		QuestionIDs: pairing.QuestionIDs,
+	}
+}
+
+// NewInvitationHistoryEntry returns the history entry of the given invitation that has not been accepted
+func NewInvitationHistoryEntry(invitation *Invitation, outcome string) *HistoryEntry {
+	return &HistoryEntry{
+		PairingID:  invitation.ID,
+		ChannelID:  invitation.ChannelID,
+		UserIDs:    getInvitationUserIDs(invitation),
+		CreatedAt:  invitation.CreatedAt,
+		FinishedAt: model.GetMillis(),
+		Outcome:    outcome,
+		Invitation: true,
+
+		AcceptedUserIDs: append([]string{invitation.RequesterID}, invitation.AcceptedUserIDs...),
+	}
+}
+
+// GetLastPartners returns the users that the user of the given history has been paired with, the most recent partner is the last one
+func GetLastPartners(history []*HistoryEntry, userID string) []string {
+	partners := []string{}
+	for _, entry := range history {
+		if !entry.IsPairing() {
+			continue
+		}
+		for _, partnerID := range entry.UserIDs {
+			if partnerID != userID {
+				partners = append(partners, partnerID)
+			}
+		}
+	}
+	return partners
+}
+
+// GetPairingLogMonth returns the month of the pairing log that the given entry belongs to, which is the month it ended in
+func GetPairingLogMonth(entry *HistoryEntry) string {
+	return time.Unix(0, entry.FinishedAt*int64(time.Millisecond)).UTC().Format(pairingLogMonthLayout)
+}
+
+// GetPairingLogMonths returns the months of the pairing log that overlap the given range, the end of the range is excluded
+func GetPairingLogMonths(from time.Time, to time.Time) []string {
+	months := []string{}
+	from = from.UTC()
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(to); month = month.AddDate(0, 1, 0) {
+		months = append(months, month.Format(pairingLogMonthLayout))
+	}
+	return months
+}
+
+// ContainsHistoryEntry returns true if the given entries already contain the given entry
+func ContainsHistoryEntry(entries []*HistoryEntry, entry *HistoryEntry) bool {
+	for _, existing := range entries {
+		if existing.PairingID == entry.PairingID && existing.FinishedAt == entry.FinishedAt && existing.Outcome == entry.Outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateUserData moves the LastPairings of older versions of the plugin into the history of the user
+func MigrateUserData(userID string, userData *UserData) {
+	if len(userData.LastPairings) == 0 {
+		return
+	}
+	//the old entries do not know anything but the partner, they are older than every entry of the history
+	history := []*HistoryEntry{}
+	for _, partnerID := range userData.LastPairings {
+		history = append(history, &HistoryEntry{
+			UserIDs: []string{userID, partnerID},
+			Outcome: OutcomeFinished,
+		})
+	}
+	userData.History = append(history, userData.History...)
+	userData.LastPairings = nil
+}
+
+// TrimHistory removes the oldest entries of the given history, so that it contains at most the given number of pairings and the given number of invitations.
+// Pairings and invitations are counted separately, so declined invitations do not push pairings out of the history.
+func TrimHistory(history []*HistoryEntry, numHistoryEntries int) []*HistoryEntry {
+	numPairings, numInvitations := 0, 0
+	trimmed := []*HistoryEntry{}
+	for index := len(history) - 1; index >= 0; index-- {
+		count := &numPairings
+		if !history[index].IsPairing() {
+			count = &numInvitations
+		}
+		if *count < numHistoryEntries {
+			*count++
+			trimmed = append(trimmed, history[index])
+		}
+	}
+	//the entries have been collected from the most recent one
+	for i, j := 0, len(trimmed)-1; i < j; i, j = i+1, j-1 {
+		trimmed[i], trimmed[j] = trimmed[j], trimmed[i]
+	}
+	return trimmed
+}
+
+// recordHistory adds the given entry to the pairing log and to the history of all of its users.
+// Only the configured number of pairings and invitations is kept per user, the complete log is used for reports.
+func (p *Plugin) recordHistory(entry *HistoryEntry) {
+	if err := p.store.AppendPairingLog(entry); err != nil {
+		p.API.LogError("Failed to log the pairing", "pairing_id", entry.PairingID, "err", err.Error())
+	}
+	numHistoryEntries := p.getConfiguration().NumHistoryEntries
+	for _, userID := range entry.UserIDs {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			userData.History = TrimHistory(append(userData.History, entry), numHistoryEntries)
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to store the pairing history", "user_id", userID, "err", err.Error())
+		}
+	}
+}
+
+// CountDistinctPartners returns the number of different users that the user of the given history has been paired with
+func CountDistinctPartners(history []*HistoryEntry, userID string) int {
+	partners := map[string]struct{}{}
+	for _, partnerID := range GetLastPartners(history, userID) {
+		partners[partnerID] = struct{}{}
+	}
+	return len(partners)
+}
+
+// GetHistoryMsg returns a human readable description of the last count history entries of the given user
+func (p *Plugin) GetHistoryMsg(userID string, count int) (string, error) {
+	userData, err := p.store.GetUserData(userID)
+	if err != nil {
+		return "", err
+	}
+	if len(userData.History) <= 0 {
+		return fmt.Sprintf("You have not been paired with anyone yet. Use `/%s` to get paired.", commandLunchbotGo), nil
+	}
+
+	entries := userData.History
+	if len(entries) > count {
+		entries = entries[len(entries)-count:]
+	}
+
+	cache := NewUserCache(p.API)
+	message := "Your recent pairings:\n"
+	//show the most recent entry first
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := entries[index]
+
+		date := "unknown date"
+		timestamp := entry.FinishedAt
+		if timestamp <= 0 {
+			timestamp = entry.CreatedAt
+		}
+		if timestamp > 0 {
+			date = time.Unix(0, timestamp*int64(time.Millisecond)).UTC().Format("2006-01-02")
+		}
+
+		names := []string{}
+		for _, otherUserID := range entry.UserIDs {
+			if otherUserID == userID {
+				continue
+			}
+			if otherUser, err := cache.GetUser(otherUserID); err == nil {
+				names = append(names, "@"+otherUser.GetDisplayName(""))
+			} else {
+				names = append(names, "unknown user")
+			}
+		}
+
+		kind := ""
+		if entry.Invitation {
+			kind = "invitation with "
+		}
+		channel := ""
+		if len(entry.ChannelID) > 0 {
+			if ch, err := p.API.GetChannel(entry.ChannelID); err == nil {
+				channel = fmt.Sprintf(" in ~%s", ch.Name)
+			}
+		}
+		message += fmt.Sprintf("  - %s: %s%s%s (%s)\n", date, kind, strings.Join(names, ", "), channel, entry.Outcome)
+	}
+	message += fmt.Sprintf("You have met %d different colleagues through lunchbot.", CountDistinctPartners(userData.History, userID))
+	return message, nil
+}
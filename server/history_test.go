@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLastPartners(t *testing.T) {
+	history := []*HistoryEntry{
+		&HistoryEntry{UserIDs: []string{"1", "2"}, Outcome: OutcomeFinished},
+		&HistoryEntry{UserIDs: []string{"1", "3"}, Outcome: OutcomeDeclined, Invitation: true},
+		&HistoryEntry{UserIDs: []string{"4", "1", "5"}, Outcome: OutcomeExpired},
+	}
+	assert.Equal(t, []string{"2", "4", "5"}, GetLastPartners(history, "1"))
+	assert.Empty(t, GetLastPartners(nil, "1"))
+}
+
+func TestMigrateUserData(t *testing.T) {
+	userData := &UserData{
+		LastPairings: []string{"2", "3"},
+		History:      []*HistoryEntry{&HistoryEntry{PairingID: "A", UserIDs: []string{"1", "4"}, Outcome: OutcomeFinished}},
+	}
+	MigrateUserData("1", userData)
+
+	assert.Nil(t, userData.LastPairings)
+	assert.Len(t, userData.History, 3)
+	assert.Equal(t, []string{"2", "3", "4"}, GetLastPartners(userData.History, "1"))
+}
+
+func TestRecordHistory(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.setConfiguration(&configuration{NumHistoryEntries: 2})
+	plugin.store = newMemoryStore(&LunchbotData{})
+
+	plugin.recordHistory(NewPairingHistoryEntry(&Pairing{ID: "A", ChannelID: "channel", UserIDs: []string{"1", "2"}}, OutcomeFinished))
+	plugin.recordHistory(NewInvitationHistoryEntry(&Invitation{ID: "B", RequesterID: "1", UserIDs: []string{"3"}}, OutcomeDeclined))
+	plugin.recordHistory(NewPairingHistoryEntry(&Pairing{ID: "C", UserIDs: []string{"1", "4"}}, OutcomeCancelled))
+
+	plugin.recordHistory(NewPairingHistoryEntry(&Pairing{ID: "D", UserIDs: []string{"1", "5"}}, OutcomeFinished))
+
+	//invitations do not push pairings out of the history
+	userData, _ := plugin.store.GetUserData("1")
+	assert.Len(t, userData.History, 3)
+	assert.Equal(t, "B", userData.History[0].PairingID)
+	assert.True(t, userData.History[0].Invitation)
+	assert.Equal(t, []string{"1", "3"}, userData.History[0].UserIDs)
+	assert.Equal(t, OutcomeCancelled, userData.History[1].Outcome)
+	assert.NotZero(t, userData.History[1].FinishedAt)
+	assert.Equal(t, []string{"4", "5"}, GetLastPartners(userData.History, "1"))
+
+	plugin.recordHistory(NewInvitationHistoryEntry(&Invitation{ID: "E", RequesterID: "1", UserIDs: []string{"6"}}, OutcomeExpired))
+	plugin.recordHistory(NewInvitationHistoryEntry(&Invitation{ID: "F", RequesterID: "1", UserIDs: []string{"7"}}, OutcomeDeclined))
+	userData, _ = plugin.store.GetUserData("1")
+	assert.Len(t, userData.History, 4)
+	assert.Equal(t, []string{"C", "D", "E", "F"}, []string{userData.History[0].PairingID, userData.History[1].PairingID, userData.History[2].PairingID, userData.History[3].PairingID})
+
+	userData, _ = plugin.store.GetUserData("2")
+	assert.Len(t, userData.History, 1)
+	assert.Equal(t, "channel", userData.History[0].ChannelID)
+
+	//the log keeps every entry once, no matter how many users it has
+	now := time.Now()
+	log, _ := plugin.store.GetPairingLog(now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	assert.Len(t, log, 6)
+}
+
+func TestGetPairingLogMonths(t *testing.T) {
+	from := time.Date(2020, time.November, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"2020-11", "2020-12", "2021-01"}, GetPairingLogMonths(from, time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, []string{"2020-11"}, GetPairingLogMonths(from, time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC)))
+
+	entry := &HistoryEntry{FinishedAt: time.Date(2020, time.December, 31, 23, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)}
+	assert.Equal(t, "2020-12", GetPairingLogMonth(entry))
+}
+
+func TestGetHistoryMsg(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetUser", "2").Return(&model.User{Id: "2", Username: "john"}, nil)
+	api.On("GetUser", "3").Return(&model.User{Id: "3", Username: "mike"}, nil)
+	api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", Name: "town-square"}, nil)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{})
+
+	message, err := plugin.GetHistoryMsg("1", DefaultHistoryCount)
+	assert.Nil(t, err)
+	assert.Contains(t, message, "You have not been paired with anyone yet.")
+
+	finishedAt := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	plugin.store = newMemoryStore(&LunchbotData{
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{
+				&HistoryEntry{UserIDs: []string{"1", "3"}, Outcome: OutcomeFinished},
+				&HistoryEntry{UserIDs: []string{"1", "2"}, ChannelID: "channel", FinishedAt: finishedAt, Outcome: OutcomeFinished},
+				&HistoryEntry{UserIDs: []string{"1", "3"}, ChannelID: "channel", FinishedAt: finishedAt, Outcome: OutcomeDeclined, Invitation: true},
+			},
+		},
+	})
+
+	message, err = plugin.GetHistoryMsg("1", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Your recent pairings:\n"+
+		"  - 2020-06-01: invitation with @mike in ~town-square (declined)\n"+
+		"  - 2020-06-01: @john in ~town-square (finished)\n"+
+		"You have met 2 different colleagues through lunchbot.", message)
+
+	message, err = plugin.GetHistoryMsg("1", DefaultHistoryCount)
+	assert.Nil(t, err)
+	assert.Contains(t, message, "  - unknown date: @mike (finished)\n")
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Invitation is a pairing that has been proposed to the chosen users but that has not been accepted by all of them yet
+type Invitation struct {
+	ID              string            `json:"ID"`
+	ChannelID       string            `json:"ChannelID"`       //Channel the pairing has been triggered in
+	RequesterID     string            `json:"RequesterID"`     //User that triggered the pairing
+	GroupSize       int               `json:"GroupSize"`       //Number of users the requester asked for, including himself
+	UserIDs         []string          `json:"UserIDs"`         //Users that have been invited
+	AcceptedUserIDs []string          `json:"AcceptedUserIDs"` //Users that accepted the invitation
+	ExcludedUserIDs []string          `json:"ExcludedUserIDs"` //Users that declined earlier invitations of the requester and will not be invited again
+	PostIDs         map[string]string `json:"PostIDs"`         //Key: UserID, Value: ID of the post the user got invited with
+	CreatedAt       int64             `json:"CreatedAt"`       //Unix timestamp in milliseconds
+}
+
+// IsExpired returns true if the invited users did not answer within the given timeout
+func (i *Invitation) IsExpired(now time.Time, timeout time.Duration) bool {
+	return now.Sub(time.Unix(0, i.CreatedAt*int64(time.Millisecond))) > timeout
+}
+
+// GetInvitationActionURL returns the URL the interactive buttons of an invitation post send their requests to
+func GetInvitationActionURL(action string) string {
+	return fmt.Sprintf("/plugins/%s/api/v1/invitations/%s", manifest.Id, action)
+}
+
+// InviteGroupForUserID picks a group for the given user and sends an invitation to each of the picked users.
+// The pairing is only started after all invited users accepted.
+func (p *Plugin) InviteGroupForUserID(channelID string, requesterID string, groupSize int, excludedUserIDs []string) (*Invitation, error) {
+	requester, appErr := p.API.GetUser(requesterID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the requester")
+	}
+	invitedUsers, appErr := p.GetGroupForUserID(channelID, requesterID, groupSize, excludedUserIDs)
+	if appErr != nil {
+		return nil, errors.New(appErr.Message)
+	}
+
+	invitation := &Invitation{
+		ID:              model.NewId(),
+		ChannelID:       channelID,
+		RequesterID:     requesterID,
+		GroupSize:       groupSize,
+		UserIDs:         []string{},
+		AcceptedUserIDs: []string{},
+		ExcludedUserIDs: excludedUserIDs,
+		PostIDs:         map[string]string{},
+		CreatedAt:       model.GetMillis(),
+	}
+	for _, user := range invitedUsers {
+		invitation.UserIDs = append(invitation.UserIDs, user.Id)
+	}
+	if err := p.storeInvitation(invitation); err != nil {
+		return nil, err
+	}
+
+	for _, user := range invitedUsers {
+		post, err := p.sendInvitationPost(invitation, requester, user.Id)
+		if err != nil {
+			p.API.LogError("Failed to send invitation", "user_id", user.Id, "err", err.Error())
+			continue
+		}
+		invitation.PostIDs[user.Id] = post.Id
+	}
+	//the invited users might already have answered, so only the posts are updated
+	_, err := p.store.UpdateInvitation(invitation.ID, func(storedInvitation *Invitation) error {
+		storedInvitation.PostIDs = invitation.PostIDs
+		return nil
+	})
+	if err != nil {
+		p.API.LogError("Failed to store invitation posts", "invitation_id", invitation.ID, "err", err.Error())
+	}
+
+	return invitation, nil
+}
+
+// sendInvitationPost sends a direct message with Accept and Decline buttons to the given user
+func (p *Plugin) sendInvitationPost(invitation *Invitation, requester *model.User, userID string) (*model.Post, error) {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the direct channel")
+	}
+
+	message := fmt.Sprintf("Hey! @%s would like to have lunch with you. Are you in?", requester.GetDisplayName(""))
+	if len(invitation.UserIDs) > 1 {
+		message = fmt.Sprintf("Hey! @%s would like to have lunch with you and %d others. Are you in?", requester.GetDisplayName(""), len(invitation.UserIDs)-1)
+	}
+	post := &model.Post{
+		ChannelId: channel.Id,
+		UserId:    p.botID,
+	}
+	context := map[string]interface{}{"invitation_id": invitation.ID}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: message,
+		Actions: []*model.PostAction{
+			{
+				Id:          "accept",
+				Name:        "Accept",
+				Type:        model.POST_ACTION_TYPE_BUTTON,
+				Style:       "primary",
+				Integration: &model.PostActionIntegration{URL: GetInvitationActionURL("accept"), Context: context},
+			},
+			{
+				Id:          "decline",
+				Name:        "Decline",
+				Type:        model.POST_ACTION_TYPE_BUTTON,
+				Integration: &model.PostActionIntegration{URL: GetInvitationActionURL("decline"), Context: context},
+			},
+		},
+	}})
+
+	createdPost, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to create post")
+	}
+	return createdPost, nil
+}
+
+// storeInvitation writes the given invitation to the storage and marks all of its users as pending.
+// Fails without changing anything if one of the users has been invited or paired by someone else in the meantime.
+func (p *Plugin) storeInvitation(invitation *Invitation) error {
+	if err := p.store.CreateInvitation(invitation); err != nil {
+		return err
+	}
+	pendingUserIDs := []string{}
+	for _, userID := range append([]string{invitation.RequesterID}, invitation.UserIDs...) {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			if len(userData.ActivePairingID) > 0 {
+				return errAlreadyPaired
+			}
+			if len(userData.PendingInvitationID) > 0 && userData.PendingInvitationID != invitation.ID {
+				return errAlreadyInvited
+			}
+			userData.PendingInvitationID = invitation.ID
+			return nil
+		})
+		if err != nil {
+			p.removeInvitation(invitation.ID, pendingUserIDs)
+			return err
+		}
+		pendingUserIDs = append(pendingUserIDs, userID)
+	}
+	return nil
+}
+
+// removeInvitation deletes the invitation with the given ID, the given users are not pending anymore.
+// Returns the deleted invitation, nil if it has already been removed by someone else.
+func (p *Plugin) removeInvitation(invitationID string, userIDs []string) *Invitation {
+	invitation, err := p.store.DeleteInvitation(invitationID)
+	if err != nil {
+		p.API.LogError("Failed to delete invitation", "invitation_id", invitationID, "err", err.Error())
+	}
+	for _, userID := range userIDs {
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			if userData.PendingInvitationID == invitationID {
+				userData.PendingInvitationID = ""
+			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to release user from invitation", "user_id", userID, "err", err.Error())
+		}
+	}
+	return invitation
+}
+
+// getInvitationUserIDs returns the requester and all invited users of the given invitation
+func getInvitationUserIDs(invitation *Invitation) []string {
+	return append([]string{invitation.RequesterID}, invitation.UserIDs...)
+}
+
+// AcceptInvitation marks the invitation as accepted by the given user. Once every invited user accepted, the pairing is started.
+// Returns the message that replaces the invitation post of the user.
+func (p *Plugin) AcceptInvitation(invitationID string, userID string) (string, error) {
+	invitation, err := p.store.UpdateInvitation(invitationID, func(invitation *Invitation) error {
+		if !ContainsString(invitation.UserIDs, userID) {
+			return errors.New("you have not been invited")
+		}
+		if !ContainsString(invitation.AcceptedUserIDs, userID) {
+			invitation.AcceptedUserIDs = append(invitation.AcceptedUserIDs, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if invitation == nil {
+		return "", errors.New("this invitation is not valid anymore")
+	}
+	if len(invitation.AcceptedUserIDs) < len(invitation.UserIDs) {
+		return "You accepted the invitation. I will let you know once everyone else accepted, too.", nil
+	}
+
+	//only one of the users that accept at the same time gets to remove the invitation and start the pairing
+	if p.removeInvitation(invitation.ID, getInvitationUserIDs(invitation)) == nil {
+		return "You accepted the invitation. Have fun!", nil
+	}
+
+	const failedMessage = "You accepted the invitation, but I could not start the lunch. The invitation has been withdrawn."
+	users := []*model.User{}
+	for _, pairedUserID := range append([]string{invitation.RequesterID}, invitation.UserIDs...) {
+		user, appErr := p.API.GetUser(pairedUserID)
+		if appErr != nil {
+			p.API.LogError("Failed to get user of invitation", "invitation_id", invitation.ID, "user_id", pairedUserID, "err", appErr.Error())
+			p.abortInvitation(invitation, userID)
+			return failedMessage, nil
+		}
+		users = append(users, user)
+	}
+	if resp := p.StartPairing(invitation.ChannelID, users); resp != nil {
+		p.API.LogError("Failed to start the pairing of invitation", "invitation_id", invitation.ID, "err", resp.Text)
+		p.abortInvitation(invitation, userID)
+		return failedMessage, nil
+	}
+	p.closeInvitationPosts(invitation, "Everyone accepted the invitation. Have fun!", userID)
+
+	return "You accepted the invitation. Have fun!", nil
+}
+
+// DeclineInvitation cancels the invitation and looks for other users to pair the requester with.
+// Returns the message that replaces the invitation post of the user.
+func (p *Plugin) DeclineInvitation(invitationID string, userID string) (string, error) {
+	invitation, err := p.store.GetInvitation(invitationID)
+	if err != nil {
+		return "", err
+	}
+	if invitation == nil {
+		return "", errors.New("this invitation is not valid anymore")
+	}
+	if !ContainsString(invitation.UserIDs, userID) {
+		return "", errors.New("you have not been invited")
+	}
+
+	invitation = p.removeInvitation(invitation.ID, getInvitationUserIDs(invitation))
+	if invitation == nil {
+		return "", errors.New("this invitation is not valid anymore")
+	}
+
+	p.recordHistory(NewInvitationHistoryEntry(invitation, OutcomeDeclined))
+	p.closeInvitationPosts(invitation, "This invitation has been withdrawn.", userID)
+	p.rematchRequester(invitation, []string{userID})
+
+	return "You declined the invitation.", nil
+}
+
+// expireInvitations cancels all invitations of the given snapshot that have not been answered in time and looks for other users to pair the requesters with
+func (p *Plugin) expireInvitations(data *LunchbotData, now time.Time) {
+	timeout := p.getConfiguration().GetInvitationTimeout()
+	expiredInvitations := []*Invitation{}
+	for _, invitation := range data.Invitations {
+		if !invitation.IsExpired(now, timeout) {
+			continue
+		}
+		//the invitation might have been answered in the meantime
+		if invitation = p.removeInvitation(invitation.ID, getInvitationUserIDs(invitation)); invitation != nil {
+			expiredInvitations = append(expiredInvitations, invitation)
+		}
+	}
+
+	for _, invitation := range expiredInvitations {
+		p.recordHistory(NewInvitationHistoryEntry(invitation, OutcomeExpired))
+		p.closeInvitationPosts(invitation, "This invitation has expired.", "")
+
+		//users that did not answer in time will not be invited again
+		unansweredUserIDs := []string{}
+		for _, userID := range invitation.UserIDs {
+			if !ContainsString(invitation.AcceptedUserIDs, userID) {
+				unansweredUserIDs = append(unansweredUserIDs, userID)
+			}
+		}
+		p.rematchRequester(invitation, unansweredUserIDs)
+	}
+}
+
+// abortInvitation withdraws the given invitation, whose pairing could not be started although everyone accepted it. The post of the given user is skipped.
+// Other users are invited for the requester, unless the requester has been paired in the meantime.
+func (p *Plugin) abortInvitation(invitation *Invitation, skippedUserID string) {
+	p.closeInvitationPosts(invitation, "This invitation has been withdrawn, because the lunch could not be started.", skippedUserID)
+	userData, err := p.store.GetUserData(invitation.RequesterID)
+	if err != nil {
+		p.API.LogError("Failed to read user data", "user_id", invitation.RequesterID, "err", err.Error())
+		return
+	}
+	if len(userData.ActivePairingID) > 0 {
+		return
+	}
+	p.rematchRequester(invitation, invitation.UserIDs)
+}
+
+// rematchRequester invites other users for the requester of the given invitation. The given users will not be invited again.
+// The requester only gets notified if there is nobody left to invite.
+func (p *Plugin) rematchRequester(invitation *Invitation, excludedUserIDs []string) {
+	excludedUserIDs = append(excludedUserIDs, invitation.ExcludedUserIDs...)
+	if _, err := p.InviteGroupForUserID(invitation.ChannelID, invitation.RequesterID, invitation.GroupSize, excludedUserIDs); err != nil {
+		if err := p.SendDirectMessage("Sorry, I could not find anyone to have lunch with you this time. Please try again later!", invitation.RequesterID); err != nil {
+			p.API.LogError("Failed to notify requester", "user_id", invitation.RequesterID, "err", err.Error())
+		}
+	}
+}
+
+// closeInvitationPosts replaces the buttons of the invitation posts with the given message. The post of the given user is skipped.
+func (p *Plugin) closeInvitationPosts(invitation *Invitation, message string, skippedUserID string) {
+	for userID, postID := range invitation.PostIDs {
+		if userID == skippedUserID {
+			continue
+		}
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			continue
+		}
+		post.Message = message
+		post.Props = model.StringInterface{}
+		if _, appErr := p.API.UpdatePost(post); appErr != nil {
+			p.API.LogError("Failed to update invitation post", "post_id", postID, "err", appErr.Error())
+		}
+	}
+}
+
+// GetInvitationStatusMsg returns a message that describes the pending invitation of the given user
+func (p *Plugin) GetInvitationStatusMsg(invitation *Invitation, userID string) string {
+	names := []string{}
+	for _, invitedUserID := range invitation.UserIDs {
+		if invitedUserID == userID {
+			continue
+		}
+		if user, appErr := p.API.GetUser(invitedUserID); appErr == nil {
+			names = append(names, "@"+user.GetDisplayName(""))
+		}
+	}
+	if invitation.RequesterID == userID {
+		return fmt.Sprintf("I asked %s to have lunch with you. I will let you know once they accepted.", strings.Join(names, ", "))
+	}
+	return "You have been invited to a lunch. Please accept or decline the invitation I sent you."
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInvitationIsExpired(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+	invitation := &Invitation{CreatedAt: now.UnixNano() / int64(time.Millisecond)}
+
+	assert.False(t, invitation.IsExpired(now.Add(30*time.Minute), time.Hour))
+	assert.True(t, invitation.IsExpired(now.Add(61*time.Minute), time.Hour))
+}
+
+func TestRemoveInvitation(t *testing.T) {
+	invitation := &Invitation{ID: "A", RequesterID: "1", UserIDs: []string{"2"}}
+	data := &LunchbotData{
+		Invitations: map[string]*Invitation{
+			"A": invitation,
+		},
+		PendingInvitations: map[string]string{
+			"1": "A",
+			"2": "B",
+		},
+	}
+
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(data)
+
+	assert.Equal(t, invitation, plugin.removeInvitation("A", []string{"1", "2"}))
+	storedData, _ := plugin.store.ReadAll()
+	assert.Empty(t, storedData.Invitations)
+	assert.Equal(t, map[string]string{"2": "B"}, storedData.PendingInvitations)
+
+	//the invitation has already been removed
+	assert.Nil(t, plugin.removeInvitation("A", []string{"1", "2"}))
+}
+
+func TestServeHTTPInvitations(t *testing.T) {
+	t.Run("Unauthorized request", func(t *testing.T) {
+		plugin := &Plugin{}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/invitations/accept", nil)
+		plugin.ServeHTTP(nil, w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("Accepting an unknown invitation", func(t *testing.T) {
+
+		plugin := &Plugin{}
+		plugin.store = newMemoryStore(&LunchbotData{})
+
+		request := &model.PostActionIntegrationRequest{
+			UserId:  "1",
+			Context: map[string]interface{}{"invitation_id": "unknown"},
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/invitations/accept", bytes.NewReader(request.ToJson()))
+		r.Header.Set("Mattermost-User-Id", "1")
+		plugin.ServeHTTP(nil, w, r)
+
+		response := &model.PostActionIntegrationResponse{}
+		json.NewDecoder(w.Result().Body).Decode(response)
+		assert.Equal(t, "Error: this invitation is not valid anymore", response.EphemeralText)
+		assert.Nil(t, response.Update)
+	})
+}
+
+func TestAcceptInvitation_requesterPaired(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetUser", mock.AnythingOfType("string")).Return(func(userID string) *model.User { return &model.User{Id: userID, Username: "user" + userID} }, nil)
+	api.On("GetPost", "post2").Return(&model.Post{Id: "post2"}, nil)
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil)
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Return()
+	plugin.SetAPI(api)
+	//the requester got paired by someone else before 3 accepted
+	plugin.store = newMemoryStore(&LunchbotData{
+		Pairings:       map[string]*Pairing{"X": &Pairing{ID: "X", UserIDs: []string{"1", "4"}}},
+		ActivePairings: map[string]string{"1": "X", "4": "X"},
+		Invitations: map[string]*Invitation{
+			"A": &Invitation{ID: "A", RequesterID: "1", UserIDs: []string{"2", "3"}, AcceptedUserIDs: []string{"2"}, PostIDs: map[string]string{"2": "post2", "3": "post3"}},
+		},
+		PendingInvitations: map[string]string{"1": "A", "2": "A", "3": "A"},
+	})
+
+	message, err := plugin.AcceptInvitation("A", "3")
+	assert.Nil(t, err)
+	assert.Equal(t, "You accepted the invitation, but I could not start the lunch. The invitation has been withdrawn.", message)
+
+	//nobody is left with a stale pairing or invitation, and the requester keeps the other pairing without getting invited again
+	data, _ := plugin.store.ReadAll()
+	assert.Empty(t, data.Invitations)
+	assert.Empty(t, data.PendingInvitations)
+	assert.Equal(t, map[string]string{"1": "X", "4": "X"}, data.ActivePairings)
+	assert.Len(t, data.Pairings, 1)
+	api.AssertCalled(t, "UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Id == "post2" && post.Message == "This invitation has been withdrawn, because the lunch could not be started."
+	}))
+}
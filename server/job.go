@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//schedulerInterval is the interval in which the background job checks for due pairing rounds
+	schedulerInterval = time.Minute
+	//schedulerLockKey is the KV key used to make sure that only a single server node runs the background job
+	schedulerLockKey = "LunchbotSchedulerLock"
+)
+
+// startScheduler starts the background job that runs the scheduled pairing rounds
+func (p *Plugin) startScheduler() {
+	p.schedulerStop = make(chan struct{})
+	p.schedulerDone = make(chan struct{})
+
+	go func() {
+		defer close(p.schedulerDone)
+
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.runBackgroundJob(time.Now())
+			case <-p.schedulerStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopScheduler stops the background job and waits for it to finish
+func (p *Plugin) stopScheduler() {
+	if p.schedulerStop == nil {
+		return
+	}
+	close(p.schedulerStop)
+	<-p.schedulerDone
+	p.schedulerStop = nil
+}
+
+// runBackgroundJob runs all periodic tasks of the plugin.
+// A lock in the KVStore makes sure that only one server node of a cluster runs the tasks within a scheduler interval.
+func (p *Plugin) runBackgroundJob(now time.Time) {
+	locked, appErr := p.API.KVSetWithOptions(schedulerLockKey, []byte("locked"), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(schedulerInterval.Seconds()),
+	})
+	if appErr != nil || !locked {
+		return
+	}
+	//the lock is not released but expires on its own, so no other node runs the same tick after this one is done
+
+	//all tasks work on the same snapshot, the data they change is updated atomically and checked again before
+	data, err := p.store.ReadAll()
+	if err != nil {
+		p.API.LogError("Failed to read the stored data", "err", err.Error())
+		return
+	}
+	p.resumePausedUsers(&data, now)
+	p.expireInvitations(&data, now)
+	p.expirePairings(&data, now)
+	p.runScheduledRounds(&data, now)
+}
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	//KVKEY is the key the whole LunchbotData used to be stored with, it is only read to migrate old data
+	KVKEY = "LunchbotData"
+	//KVKEYUserPrefix is the prefix of the keys the data of each user is stored with, followed by the UserID
+	KVKEYUserPrefix = "LunchbotUser_"
+	//KVKEYPairingPrefix is the prefix of the keys the active pairings are stored with, followed by the PairingID
+	KVKEYPairingPrefix = "LunchbotPairing_"
+	//KVKEYInvitationPrefix is the prefix of the keys the pending invitations are stored with, followed by the InvitationID
+	KVKEYInvitationPrefix = "LunchbotInvitation_"
+	//KVKEYSchedulePrefix is the prefix of the keys the schedules are stored with, followed by the ChannelID
+	KVKEYSchedulePrefix = "LunchbotSchedule_"
+	//KVKEYChannelConfigPrefix is the prefix of the keys the channel configurations are stored with, followed by the ChannelID
+	KVKEYChannelConfigPrefix = "LunchbotChannelConfig_"
+	//KVKEYTopicCatalogue is the key the organisation-wide topic catalogue is stored with
+	KVKEYTopicCatalogue = "LunchbotTopicCatalogue"
+	//KVKEYQuestions is the key the icebreaker questions that have been added by admins are stored with
+	KVKEYQuestions = "LunchbotQuestions"
+	//KVKEYRoundPrefix is the prefix of the keys the recorded pairing rounds are stored with, followed by the RoundID
+	KVKEYRoundPrefix = "LunchbotRound_"
+	//KVKEYPairingLogPrefix is the prefix of the keys the log of ended pairings and invitations is stored with, followed by the month, e.g. 2020-06
+	KVKEYPairingLogPrefix = "LunchbotPairingLog_"
+
+	//maxUpdateAttempts is how often an update is retried if the value has been changed concurrently
+	maxUpdateAttempts = 10
+	//kvListPageSize is the number of keys fetched at once when listing keys
+	kvListPageSize = 1000
+)
+
+// kvStore is the Store that keeps the data in the KVStore of the Mattermost server.
+// Every user, pairing, invitation, schedule, channel configuration and pairing round is stored under its own key, the topic catalogue and the questions are stored under a single key each.
+// The pairing log is stored under one key per month.
+type kvStore struct {
+	api plugin.API
+}
+
+// newKVStore returns a Store that uses the KVStore of the given API
+func newKVStore(api plugin.API) Store {
+	return &kvStore{api: api}
+}
+
+// ReadAll reads a snapshot of all data from the KVStore
+func (s *kvStore) ReadAll() (LunchbotData, error) {
+	data := newLunchbotData()
+
+	keys, err := s.listKeys()
+	if err != nil {
+		return data, err
+	}
+	for _, key := range keys {
+		switch {
+		case strings.HasPrefix(key, KVKEYUserPrefix):
+			userID := strings.TrimPrefix(key, KVKEYUserPrefix)
+			userData, err := s.GetUserData(userID)
+			if err != nil {
+				return data, err
+			}
+			addUserData(&data, userID, userData)
+		case strings.HasPrefix(key, KVKEYPairingPrefix):
+			pairing := &Pairing{}
+			if _, err := s.getJSON(key, pairing); err != nil {
+				return data, err
+			}
+			data.Pairings[pairing.ID] = pairing
+		case strings.HasPrefix(key, KVKEYInvitationPrefix):
+			invitation := &Invitation{}
+			if _, err := s.getJSON(key, invitation); err != nil {
+				return data, err
+			}
+			data.Invitations[invitation.ID] = invitation
+		case strings.HasPrefix(key, KVKEYSchedulePrefix):
+			schedule := &Schedule{}
+			if _, err := s.getJSON(key, schedule); err != nil {
+				return data, err
+			}
+			data.Schedules[schedule.ChannelID] = schedule
+		case strings.HasPrefix(key, KVKEYChannelConfigPrefix):
+			channelConfig := &ChannelConfig{}
+			if _, err := s.getJSON(key, channelConfig); err != nil {
+				return data, err
+			}
+			data.ChannelConfigs[strings.TrimPrefix(key, KVKEYChannelConfigPrefix)] = channelConfig
+		case key == KVKEYTopicCatalogue:
+			catalogue, err := s.GetTopicCatalogue()
+			if err != nil {
+				return data, err
+			}
+			data.TopicCatalogue = catalogue
+		case key == KVKEYQuestions:
+			questions, err := s.GetQuestions()
+			if err != nil {
+				return data, err
+			}
+			data.Questions = questions
+		}
+	}
+
+	return data, nil
+}
+
+// ReadUsers reads a snapshot of the data of the given users and of their active pairings from the KVStore
+func (s *kvStore) ReadUsers(userIDs []string) (LunchbotData, error) {
+	data := newLunchbotData()
+	readUserIDs := map[string]struct{}{}
+	for _, userID := range userIDs {
+		if _, ok := readUserIDs[userID]; ok {
+			continue
+		}
+		readUserIDs[userID] = struct{}{}
+		userData, err := s.GetUserData(userID)
+		if err != nil {
+			return data, err
+		}
+		addUserData(&data, userID, userData)
+		if _, ok := data.Pairings[userData.ActivePairingID]; len(userData.ActivePairingID) <= 0 || ok {
+			continue
+		}
+		pairing, err := s.GetPairing(userData.ActivePairingID)
+		if err != nil {
+			return data, err
+		}
+		if pairing != nil {
+			data.Pairings[pairing.ID] = pairing
+		}
+	}
+	return data, nil
+}
+
+// Migrate moves the data that older versions of the plugin stored as a single blob into the per entity keys.
+// The blob is deleted afterwards, so the migration only runs once. The pairing log is started with the histories of the users if it does not exist yet.
+func (s *kvStore) Migrate() error {
+	if err := s.migrateBlob(); err != nil {
+		return err
+	}
+	return s.startPairingLog()
+}
+
+// migrateBlob moves the data that older versions of the plugin stored as a single blob into the per entity keys
+func (s *kvStore) migrateBlob() error {
+	kvData, appErr := s.api.KVGet(KVKEY)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to read old data")
+	}
+	if kvData == nil {
+		return nil
+	}
+
+	data := LunchbotData{}
+	if err := json.Unmarshal(kvData, &data); err != nil {
+		return errors.Wrap(err, "failed to decode old data")
+	}
+	MigrateData(&data)
+
+	for userID, userData := range SplitData(&data) {
+		if err := s.setJSON(KVKEYUserPrefix+userID, userData); err != nil {
+			return err
+		}
+	}
+	for _, pairing := range data.Pairings {
+		if err := s.setJSON(KVKEYPairingPrefix+pairing.ID, pairing); err != nil {
+			return err
+		}
+	}
+	for _, invitation := range data.Invitations {
+		if err := s.setJSON(KVKEYInvitationPrefix+invitation.ID, invitation); err != nil {
+			return err
+		}
+	}
+	for _, schedule := range data.Schedules {
+		if err := s.setJSON(KVKEYSchedulePrefix+schedule.ChannelID, schedule); err != nil {
+			return err
+		}
+	}
+
+	//another server node might have migrated the data at the same time, only one of them deletes the blob
+	if _, appErr := s.api.KVCompareAndDelete(KVKEY, kvData); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete old data")
+	}
+	return nil
+}
+
+// startPairingLog fills the pairing log with the entries of the histories of all users, unless the log has already been started.
+// Entries of older versions of the plugin that do not know when they ended are skipped.
+func (s *kvStore) startPairingLog() error {
+	keys, err := s.listKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, KVKEYPairingLogPrefix) {
+			return nil
+		}
+	}
+
+	data, err := s.ReadAll()
+	if err != nil {
+		return err
+	}
+	months := map[string][]*HistoryEntry{}
+	for _, history := range data.History {
+		for _, entry := range history {
+			month := GetPairingLogMonth(entry)
+			if entry.FinishedAt > 0 && !ContainsHistoryEntry(months[month], entry) {
+				months[month] = append(months[month], entry)
+			}
+		}
+	}
+	for month, entries := range months {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].FinishedAt < entries[j].FinishedAt
+		})
+		if err := s.appendPairingLog(month, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserData returns the stored data of the given user. Returns empty data if nothing has been stored for the user yet.
+func (s *kvStore) GetUserData(userID string) (*UserData, error) {
+	userData := &UserData{}
+	if _, err := s.getJSON(KVKEYUserPrefix+userID, userData); err != nil {
+		return nil, err
+	}
+	MigrateUserData(userID, userData)
+	return userData, nil
+}
+
+// UpdateUserData atomically applies the given update to the data of the given user. The update is retried if the data changed in the meantime,
+// so it must not have any side effects. Returns the error of the update if it fails.
+func (s *kvStore) UpdateUserData(userID string, update func(userData *UserData) error) (*UserData, error) {
+	userData := &UserData{}
+	err := s.updateJSON(KVKEYUserPrefix+userID, func(oldValue []byte) (interface{}, error) {
+		userData = &UserData{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, userData); err != nil {
+				return nil, errors.Wrap(err, "failed to decode user data")
+			}
+			MigrateUserData(userID, userData)
+		}
+		if err := update(userData); err != nil {
+			return nil, err
+		}
+		return userData, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userData, nil
+}
+
+// GetPairing returns the active pairing with the given ID, nil if there is none
+func (s *kvStore) GetPairing(pairingID string) (*Pairing, error) {
+	pairing := &Pairing{}
+	found, err := s.getJSON(KVKEYPairingPrefix+pairingID, pairing)
+	if err != nil || !found {
+		return nil, err
+	}
+	return pairing, nil
+}
+
+// CreatePairing stores a new pairing. Fails if a pairing with the same ID already exists.
+func (s *kvStore) CreatePairing(pairing *Pairing) error {
+	return s.createJSON(KVKEYPairingPrefix+pairing.ID, pairing)
+}
+
+// UpdatePairing atomically applies the given update to the given pairing. Returns nil if the pairing does not exist anymore.
+func (s *kvStore) UpdatePairing(pairingID string, update func(pairing *Pairing) error) (*Pairing, error) {
+	var pairing *Pairing
+	err := s.updateJSON(KVKEYPairingPrefix+pairingID, func(oldValue []byte) (interface{}, error) {
+		pairing = nil
+		if oldValue == nil {
+			return nil, nil
+		}
+		pairing = &Pairing{}
+		if err := json.Unmarshal(oldValue, pairing); err != nil {
+			return nil, errors.Wrap(err, "failed to decode pairing")
+		}
+		if err := update(pairing); err != nil {
+			return nil, err
+		}
+		return pairing, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pairing, nil
+}
+
+// DeletePairing deletes the pairing with the given ID and returns it. Returns nil if the pairing has already been deleted by someone else.
+func (s *kvStore) DeletePairing(pairingID string) (*Pairing, error) {
+	pairing := &Pairing{}
+	deleted, err := s.deleteJSON(KVKEYPairingPrefix+pairingID, pairing)
+	if err != nil || !deleted {
+		return nil, err
+	}
+	return pairing, nil
+}
+
+// GetInvitation returns the pending invitation with the given ID, nil if there is none
+func (s *kvStore) GetInvitation(invitationID string) (*Invitation, error) {
+	invitation := &Invitation{}
+	found, err := s.getJSON(KVKEYInvitationPrefix+invitationID, invitation)
+	if err != nil || !found {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// CreateInvitation stores a new invitation. Fails if an invitation with the same ID already exists.
+func (s *kvStore) CreateInvitation(invitation *Invitation) error {
+	return s.createJSON(KVKEYInvitationPrefix+invitation.ID, invitation)
+}
+
+// UpdateInvitation atomically applies the given update to the given invitation. Returns nil if the invitation does not exist anymore.
+func (s *kvStore) UpdateInvitation(invitationID string, update func(invitation *Invitation) error) (*Invitation, error) {
+	var invitation *Invitation
+	err := s.updateJSON(KVKEYInvitationPrefix+invitationID, func(oldValue []byte) (interface{}, error) {
+		invitation = nil
+		if oldValue == nil {
+			return nil, nil
+		}
+		invitation = &Invitation{}
+		if err := json.Unmarshal(oldValue, invitation); err != nil {
+			return nil, errors.Wrap(err, "failed to decode invitation")
+		}
+		if err := update(invitation); err != nil {
+			return nil, err
+		}
+		return invitation, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// DeleteInvitation deletes the invitation with the given ID and returns it. Returns nil if the invitation has already been deleted by someone else.
+func (s *kvStore) DeleteInvitation(invitationID string) (*Invitation, error) {
+	invitation := &Invitation{}
+	deleted, err := s.deleteJSON(KVKEYInvitationPrefix+invitationID, invitation)
+	if err != nil || !deleted {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// GetSchedule returns the schedule of the given channel, nil if there is none
+func (s *kvStore) GetSchedule(channelID string) (*Schedule, error) {
+	schedule := &Schedule{}
+	found, err := s.getJSON(KVKEYSchedulePrefix+channelID, schedule)
+	if err != nil || !found {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// SaveSchedule stores the schedule of its channel, an existing schedule gets replaced
+func (s *kvStore) SaveSchedule(schedule *Schedule) error {
+	return s.setJSON(KVKEYSchedulePrefix+schedule.ChannelID, schedule)
+}
+
+// UpdateSchedule atomically applies the given update to the schedule of the given channel. Returns nil if the channel has no schedule.
+func (s *kvStore) UpdateSchedule(channelID string, update func(schedule *Schedule) error) (*Schedule, error) {
+	var schedule *Schedule
+	err := s.updateJSON(KVKEYSchedulePrefix+channelID, func(oldValue []byte) (interface{}, error) {
+		schedule = nil
+		if oldValue == nil {
+			return nil, nil
+		}
+		schedule = &Schedule{}
+		if err := json.Unmarshal(oldValue, schedule); err != nil {
+			return nil, errors.Wrap(err, "failed to decode schedule")
+		}
+		if err := update(schedule); err != nil {
+			return nil, err
+		}
+		return schedule, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule deletes the schedule of the given channel
+func (s *kvStore) DeleteSchedule(channelID string) error {
+	if appErr := s.api.KVDelete(KVKEYSchedulePrefix + channelID); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete schedule")
+	}
+	return nil
+}
+
+// GetChannelConfig returns the configuration of the given channel. Returns an empty configuration if the channel has none.
+func (s *kvStore) GetChannelConfig(channelID string) (*ChannelConfig, error) {
+	channelConfig := &ChannelConfig{}
+	if _, err := s.getJSON(KVKEYChannelConfigPrefix+channelID, channelConfig); err != nil {
+		return nil, err
+	}
+	return channelConfig, nil
+}
+
+// SaveChannelConfig stores the configuration of the given channel
+func (s *kvStore) SaveChannelConfig(channelID string, channelConfig *ChannelConfig) error {
+	return s.setJSON(KVKEYChannelConfigPrefix+channelID, channelConfig)
+}
+
+// UpdateChannelConfig atomically applies the given update to the configuration of the given channel. The update is retried if the configuration changed in the meantime.
+// Returns the error of the update if it fails.
+func (s *kvStore) UpdateChannelConfig(channelID string, update func(channelConfig *ChannelConfig) error) (*ChannelConfig, error) {
+	channelConfig := &ChannelConfig{}
+	err := s.updateJSON(KVKEYChannelConfigPrefix+channelID, func(oldValue []byte) (interface{}, error) {
+		channelConfig = &ChannelConfig{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, channelConfig); err != nil {
+				return nil, errors.Wrap(err, "failed to decode channel configuration")
+			}
+		}
+		if err := update(channelConfig); err != nil {
+			return nil, err
+		}
+		return channelConfig, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return channelConfig, nil
+}
+
+// GetTopicCatalogue returns the topics of the topic catalogue. Returns an empty catalogue if it does not exist yet.
+func (s *kvStore) GetTopicCatalogue() (map[string]*CatalogueTopic, error) {
+	catalogue := map[string]*CatalogueTopic{}
+	if _, err := s.getJSON(KVKEYTopicCatalogue, &catalogue); err != nil {
+		return nil, err
+	}
+	return catalogue, nil
+}
+
+// UpdateTopicCatalogue atomically applies the given update to the topic catalogue
+func (s *kvStore) UpdateTopicCatalogue(update func(catalogue map[string]*CatalogueTopic) error) (map[string]*CatalogueTopic, error) {
+	var catalogue map[string]*CatalogueTopic
+	err := s.updateJSON(KVKEYTopicCatalogue, func(oldValue []byte) (interface{}, error) {
+		catalogue = map[string]*CatalogueTopic{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &catalogue); err != nil {
+				return nil, errors.Wrap(err, "failed to decode the topic catalogue")
+			}
+		}
+		if err := update(catalogue); err != nil {
+			return nil, err
+		}
+		return catalogue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return catalogue, nil
+}
+
+// GetQuestions returns the questions that have been added by admins
+func (s *kvStore) GetQuestions() (map[string]*Question, error) {
+	questions := map[string]*Question{}
+	if _, err := s.getJSON(KVKEYQuestions, &questions); err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// UpdateQuestions atomically applies the given update to the questions that have been added by admins
+func (s *kvStore) UpdateQuestions(update func(questions map[string]*Question) error) (map[string]*Question, error) {
+	var questions map[string]*Question
+	err := s.updateJSON(KVKEYQuestions, func(oldValue []byte) (interface{}, error) {
+		questions = map[string]*Question{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &questions); err != nil {
+				return nil, errors.Wrap(err, "failed to decode the questions")
+			}
+		}
+		if err := update(questions); err != nil {
+			return nil, err
+		}
+		return questions, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// GetRound returns the recorded round with the given ID. Returns nil if the round does not exist.
+func (s *kvStore) GetRound(roundID string) (*Round, error) {
+	round := &Round{}
+	found, err := s.getJSON(KVKEYRoundPrefix+roundID, round)
+	if err != nil || !found {
+		return nil, err
+	}
+	return round, nil
+}
+
+// GetRounds returns the recorded rounds of the given channel
+func (s *kvStore) GetRounds(channelID string) ([]*Round, error) {
+	keys, err := s.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	rounds := []*Round{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, KVKEYRoundPrefix) {
+			continue
+		}
+		round, err := s.GetRound(strings.TrimPrefix(key, KVKEYRoundPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if round != nil && round.ChannelID == channelID {
+			rounds = append(rounds, round)
+		}
+	}
+	return rounds, nil
+}
+
+// SaveRound stores the given round, it expires after the retention period of rounds
+func (s *kvStore) SaveRound(round *Round) error {
+	key := KVKEYRoundPrefix + round.ID
+	newValue, err := json.Marshal(round)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s", key)
+	}
+	if appErr := s.api.KVSetWithExpiry(key, newValue, int64(roundRetention/time.Second)); appErr != nil {
+		return errors.Wrapf(appErr, "failed to store %s", key)
+	}
+	return nil
+}
+
+// AppendPairingLog atomically adds the given entry to the log of the month it ended in
+func (s *kvStore) AppendPairingLog(entry *HistoryEntry) error {
+	return s.appendPairingLog(GetPairingLogMonth(entry), []*HistoryEntry{entry})
+}
+
+// appendPairingLog atomically adds the given entries to the log of the given month, entries that have already been logged are skipped
+func (s *kvStore) appendPairingLog(month string, entries []*HistoryEntry) error {
+	return s.updateJSON(KVKEYPairingLogPrefix+month, func(oldValue []byte) (interface{}, error) {
+		log := []*HistoryEntry{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &log); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode the pairing log of %s", month)
+			}
+		}
+		numLogged := len(log)
+		for _, entry := range entries {
+			if !ContainsHistoryEntry(log, entry) {
+				log = append(log, entry)
+			}
+		}
+		if len(log) == numLogged {
+			return nil, nil
+		}
+		return log, nil
+	})
+}
+
+// GetPairingLog returns the logged entries of the months that overlap the given range
+func (s *kvStore) GetPairingLog(from time.Time, to time.Time) ([]*HistoryEntry, error) {
+	entries := []*HistoryEntry{}
+	for _, month := range GetPairingLogMonths(from, to) {
+		log := []*HistoryEntry{}
+		if _, err := s.getJSON(KVKEYPairingLogPrefix+month, &log); err != nil {
+			return nil, err
+		}
+		entries = append(entries, log...)
+	}
+	return entries, nil
+}
+
+// Clear removes all stored data from the KVStore
+func (s *kvStore) Clear() error {
+	if appErr := s.api.KVDeleteAll(); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete all data")
+	}
+	return nil
+}
+
+// listKeys returns all keys that are stored in the KVStore
+func (s *kvStore) listKeys() ([]string, error) {
+	keys := []string{}
+	for page := 0; ; page++ {
+		pageKeys, appErr := s.api.KVList(page, kvListPageSize)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list keys")
+		}
+		keys = append(keys, pageKeys...)
+		if len(pageKeys) < kvListPageSize {
+			return keys, nil
+		}
+	}
+}
+
+// getJSON reads the value of the given key into the given struct. Returns false if the key does not exist.
+func (s *kvStore) getJSON(key string, value interface{}) (bool, error) {
+	kvData, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to read %s", key)
+	}
+	if kvData == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(kvData, value); err != nil {
+		return false, errors.Wrapf(err, "failed to decode %s", key)
+	}
+	return true, nil
+}
+
+// setJSON stores the given value under the given key, an existing value gets replaced
+func (s *kvStore) setJSON(key string, value interface{}) error {
+	newValue, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s", key)
+	}
+	if appErr := s.api.KVSet(key, newValue); appErr != nil {
+		return errors.Wrapf(appErr, "failed to store %s", key)
+	}
+	return nil
+}
+
+// createJSON stores the given value under the given key. Fails if the key already exists.
+func (s *kvStore) createJSON(key string, value interface{}) error {
+	newValue, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s", key)
+	}
+	created, appErr := s.api.KVCompareAndSet(key, nil, newValue)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to store %s", key)
+	}
+	if !created {
+		return errConflict
+	}
+	return nil
+}
+
+// deleteJSON deletes the given key and reads its last value into the given struct.
+// Returns false if the key does not exist or if someone else deleted it concurrently.
+func (s *kvStore) deleteJSON(key string, value interface{}) (bool, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		oldValue, appErr := s.api.KVGet(key)
+		if appErr != nil {
+			return false, errors.Wrapf(appErr, "failed to read %s", key)
+		}
+		if oldValue == nil {
+			return false, nil
+		}
+		deleted, appErr := s.api.KVCompareAndDelete(key, oldValue)
+		if appErr != nil {
+			return false, errors.Wrapf(appErr, "failed to delete %s", key)
+		}
+		if deleted {
+			if err := json.Unmarshal(oldValue, value); err != nil {
+				return false, errors.Wrapf(err, "failed to decode %s", key)
+			}
+			return true, nil
+		}
+	}
+	return false, errConflict
+}
+
+// updateJSON atomically replaces the value of the given key with the value returned by the given update.
+// The update gets the current value, nil if the key does not exist. If the update returns nil, nothing is changed.
+// If the value has been changed concurrently, the update is retried with the new value.
+func (s *kvStore) updateJSON(key string, update func(oldValue []byte) (interface{}, error)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		oldValue, appErr := s.api.KVGet(key)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to read %s", key)
+		}
+		value, err := update(oldValue)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return nil
+		}
+		newValue, err := json.Marshal(value)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode %s", key)
+		}
+		updated, appErr := s.api.KVCompareAndSet(key, oldValue, newValue)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to store %s", key)
+		}
+		if updated {
+			return nil
+		}
+	}
+	return errConflict
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// getKVValues returns the given data in the per entity layout of the KVStore
+func getKVValues(data *LunchbotData) map[string][]byte {
+	values := map[string][]byte{}
+	mockKey := func(key string, value interface{}) {
+		values[key], _ = json.Marshal(value)
+	}
+	for userID, userData := range SplitData(data) {
+		mockKey(KVKEYUserPrefix+userID, userData)
+	}
+	for _, pairing := range data.Pairings {
+		mockKey(KVKEYPairingPrefix+pairing.ID, pairing)
+	}
+	for _, invitation := range data.Invitations {
+		mockKey(KVKEYInvitationPrefix+invitation.ID, invitation)
+	}
+	for _, schedule := range data.Schedules {
+		mockKey(KVKEYSchedulePrefix+schedule.ChannelID, schedule)
+	}
+	for channelID, channelConfig := range data.ChannelConfigs {
+		mockKey(KVKEYChannelConfigPrefix+channelID, channelConfig)
+	}
+	if len(data.TopicCatalogue) > 0 {
+		mockKey(KVKEYTopicCatalogue, data.TopicCatalogue)
+	}
+	if len(data.Questions) > 0 {
+		mockKey(KVKEYQuestions, data.Questions)
+	}
+	return values
+}
+
+// mockKVStore lets the given API return the given data in the per entity layout of the KVStore
+func mockKVStore(api *plugintest.API, data *LunchbotData) {
+	keys := []string{}
+	for key, value := range getKVValues(data) {
+		keys = append(keys, key)
+		api.On("KVGet", key).Return(value, nil)
+	}
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("KVList", 0, kvListPageSize).Return(keys, nil)
+}
+
+// fakeKVAPI is a plugin API that keeps the given data in an in-memory KVStore, all other calls go to the embedded mock.
+// Unlike a mocked KVStore, reading a key does not get slower with the number of keys, so it is used to benchmark large channels.
+type fakeKVAPI struct {
+	*plugintest.API
+	values map[string][]byte
+}
+
+// newFakeKVAPI returns a fakeKVAPI whose KVStore contains the given data in the per entity layout
+func newFakeKVAPI(api *plugintest.API, data *LunchbotData) *fakeKVAPI {
+	return &fakeKVAPI{API: api, values: getKVValues(data)}
+}
+
+func (a *fakeKVAPI) KVGet(key string) ([]byte, *model.AppError) {
+	return a.values[key], nil
+}
+
+func (a *fakeKVAPI) KVList(page, perPage int) ([]string, *model.AppError) {
+	keys := []string{}
+	for key := range a.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if page*perPage >= len(keys) {
+		return []string{}, nil
+	}
+	if (page+1)*perPage < len(keys) {
+		return keys[page*perPage : (page+1)*perPage], nil
+	}
+	return keys[page*perPage:], nil
+}
+
+func TestReadFromStorage(t *testing.T) {
+	data := &LunchbotData{
+		Pairings: map[string]*Pairing{
+			"A": &Pairing{ID: "A", UserIDs: []string{"1", "2"}},
+		},
+		ActivePairings: map[string]string{"1": "A", "2": "A"},
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{&HistoryEntry{PairingID: "C", UserIDs: []string{"1", "3"}, Outcome: OutcomeFinished}},
+		},
+		UserTopics: map[string]map[string]struct{}{"3": map[string]struct{}{"Go": struct{}{}}},
+		Blacklists: map[string]map[string]struct{}{"2": map[string]struct{}{"3": struct{}{}}},
+		Schedules: map[string]*Schedule{
+			"channel": &Schedule{ChannelID: "channel", Weekday: time.Monday},
+		},
+		Participations: getJoinedParticipations("1", "2", "3"),
+		ChannelConfigs: map[string]*ChannelConfig{
+			"channel": &ChannelConfig{GroupSize: 3},
+		},
+		TopicCatalogue: map[string]*CatalogueTopic{
+			"go": &CatalogueTopic{Name: "Go", Curated: true},
+		},
+		Questions: map[string]*Question{
+			"Q": &Question{ID: "Q", Category: "food", Text: "Pizza or pasta?"},
+		},
+		Invitations: map[string]*Invitation{
+			"B": &Invitation{ID: "B", RequesterID: "3", UserIDs: []string{"4"}},
+		},
+		PendingInvitations: map[string]string{"3": "B", "4": "B"},
+	}
+
+	api := &plugintest.API{}
+	mockKVStore(api, data)
+	store := newKVStore(api)
+
+	readData, err := store.ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, data.Pairings, readData.Pairings)
+	assert.Equal(t, data.ActivePairings, readData.ActivePairings)
+	assert.Equal(t, data.History, readData.History)
+	assert.Equal(t, data.UserTopics, readData.UserTopics)
+	assert.Equal(t, data.Blacklists, readData.Blacklists)
+	assert.Equal(t, data.Schedules, readData.Schedules)
+	assert.Equal(t, data.Participations, readData.Participations)
+	assert.Equal(t, data.ChannelConfigs, readData.ChannelConfigs)
+	assert.Equal(t, data.TopicCatalogue, readData.TopicCatalogue)
+	assert.Equal(t, data.Questions, readData.Questions)
+	assert.Equal(t, data.Invitations, readData.Invitations)
+	assert.Equal(t, data.PendingInvitations, readData.PendingInvitations)
+}
+
+func TestReadUsersFromStorage(t *testing.T) {
+	data := &LunchbotData{
+		Pairings: map[string]*Pairing{
+			"A": &Pairing{ID: "A", UserIDs: []string{"1", "2"}},
+			"B": &Pairing{ID: "B", UserIDs: []string{"3", "4"}},
+		},
+		ActivePairings: map[string]string{"1": "A", "2": "A", "3": "B", "4": "B"},
+		Blacklists:     map[string]map[string]struct{}{"2": map[string]struct{}{"3": struct{}{}}},
+		Participations: getJoinedParticipations("1", "2", "3", "4"),
+	}
+
+	api := &plugintest.API{}
+	mockKVStore(api, data)
+	store := newKVStore(api)
+
+	readData, err := store.ReadUsers([]string{"1", "2", "2", "5"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]*Pairing{"A": data.Pairings["A"]}, readData.Pairings)
+	assert.Equal(t, map[string]string{"1": "A", "2": "A"}, readData.ActivePairings)
+	assert.Equal(t, data.Blacklists, readData.Blacklists)
+	assert.Len(t, readData.Participations, 2)
+	//neither the keys nor the data of other users are read
+	api.AssertNotCalled(t, "KVList", mock.Anything, mock.Anything)
+	api.AssertNotCalled(t, "KVGet", KVKEYUserPrefix+"3")
+	api.AssertNumberOfCalls(t, "KVGet", 4)
+}
+
+func TestUpdateUserData(t *testing.T) {
+	t.Run("Retries on concurrent changes", func(t *testing.T) {
+		oldValue, _ := json.Marshal(&UserData{Topics: map[string]struct{}{"Go": struct{}{}}})
+		newValue, _ := json.Marshal(&UserData{Topics: map[string]struct{}{"Go": struct{}{}, "Rust": struct{}{}}})
+
+		api := &plugintest.API{}
+		api.On("KVGet", KVKEYUserPrefix+"1").Return(oldValue, nil)
+		api.On("KVCompareAndSet", KVKEYUserPrefix+"1", oldValue, newValue).Return(false, nil).Once()
+		api.On("KVCompareAndSet", KVKEYUserPrefix+"1", oldValue, newValue).Return(true, nil).Once()
+		store := newKVStore(api)
+
+		userData, err := store.UpdateUserData("1", func(userData *UserData) error {
+			userData.Topics["Rust"] = struct{}{}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Len(t, userData.Topics, 2)
+		api.AssertNumberOfCalls(t, "KVCompareAndSet", 2)
+	})
+
+	t.Run("Gives up after too many conflicts", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", KVKEYUserPrefix+"1").Return(nil, nil)
+		api.On("KVCompareAndSet", KVKEYUserPrefix+"1", []byte(nil), mock.Anything).Return(false, nil)
+		store := newKVStore(api)
+
+		_, err := store.UpdateUserData("1", func(userData *UserData) error {
+			return nil
+		})
+		assert.Equal(t, errConflict, err)
+		api.AssertNumberOfCalls(t, "KVCompareAndSet", maxUpdateAttempts)
+	})
+}
+
+func TestUpdateChannelConfig(t *testing.T) {
+	//another admin changed the group size in the meantime, the change is kept
+	oldValue, _ := json.Marshal(&ChannelConfig{})
+	changedValue, _ := json.Marshal(&ChannelConfig{GroupSize: 3})
+	newValue, _ := json.Marshal(&ChannelConfig{GroupSize: 3, WelcomeMessage: "Hi"})
+
+	api := &plugintest.API{}
+	api.On("KVGet", KVKEYChannelConfigPrefix+"channel").Return(oldValue, nil).Once()
+	api.On("KVGet", KVKEYChannelConfigPrefix+"channel").Return(changedValue, nil).Once()
+	api.On("KVCompareAndSet", KVKEYChannelConfigPrefix+"channel", oldValue, mock.Anything).Return(false, nil).Once()
+	api.On("KVCompareAndSet", KVKEYChannelConfigPrefix+"channel", changedValue, newValue).Return(true, nil).Once()
+	store := newKVStore(api)
+
+	channelConfig, err := store.UpdateChannelConfig("channel", func(channelConfig *ChannelConfig) error {
+		channelConfig.WelcomeMessage = "Hi"
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &ChannelConfig{GroupSize: 3, WelcomeMessage: "Hi"}, channelConfig)
+	api.AssertNumberOfCalls(t, "KVCompareAndSet", 2)
+}
+
+func TestSplitData(t *testing.T) {
+	data := &LunchbotData{
+		ActivePairings: map[string]string{"1": "A"},
+		LastPairings:   map[string][]string{"1": []string{"2"}},
+		Blacklists:     map[string]map[string]struct{}{"2": map[string]struct{}{"1": struct{}{}}},
+		Participations: getJoinedParticipations("3"),
+	}
+
+	users := SplitData(data)
+	assert.Len(t, users, 3)
+	assert.Equal(t, &UserData{
+		ActivePairingID: "A",
+		History:         []*HistoryEntry{&HistoryEntry{UserIDs: []string{"1", "2"}, Outcome: OutcomeFinished}},
+	}, users["1"])
+	assert.Equal(t, &UserData{Blacklist: map[string]struct{}{"1": struct{}{}}}, users["2"])
+	assert.Equal(t, &UserData{Participation: &Participation{Joined: true}}, users["3"])
+}
+
+func TestMigrateStorage(t *testing.T) {
+	t.Run("Nothing to migrate", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", KVKEY).Return(nil, nil)
+		api.On("KVList", 0, kvListPageSize).Return([]string{KVKEYUserPrefix + "1", KVKEYPairingLogPrefix + "2020-06"}, nil)
+		store := newKVStore(api)
+
+		assert.Nil(t, store.Migrate())
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "KVCompareAndSet", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Old data is split up", func(t *testing.T) {
+		oldData, _ := json.Marshal(&LunchbotData{
+			ActivePairings: map[string]string{"1": "2", "2": "1"},
+			UserTopics:     map[string]map[string]struct{}{"3": map[string]struct{}{"Go": struct{}{}}},
+		})
+		topicsValue, _ := json.Marshal(&UserData{Topics: map[string]struct{}{"Go": struct{}{}}})
+
+		api := &plugintest.API{}
+		api.On("KVGet", KVKEY).Return(oldData, nil)
+		api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+		api.On("KVCompareAndDelete", KVKEY, oldData).Return(true, nil)
+		api.On("KVList", 0, kvListPageSize).Return([]string{}, nil)
+		store := newKVStore(api)
+
+		assert.Nil(t, store.Migrate())
+		api.AssertCalled(t, "KVSet", KVKEYUserPrefix+"3", topicsValue)
+		api.AssertCalled(t, "KVSet", KVKEYUserPrefix+"1", mock.Anything)
+		api.AssertCalled(t, "KVSet", KVKEYUserPrefix+"2", mock.Anything)
+		api.AssertNumberOfCalls(t, "KVSet", 4) //three users and one pairing
+		api.AssertCalled(t, "KVCompareAndDelete", KVKEY, oldData)
+	})
+
+	t.Run("Pairing log is started with the histories", func(t *testing.T) {
+		june := time.Date(2020, time.June, 10, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+		july := time.Date(2020, time.July, 10, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+		shared := &HistoryEntry{PairingID: "A", UserIDs: []string{"1", "2"}, FinishedAt: june, Outcome: OutcomeFinished}
+		data := &LunchbotData{
+			History: map[string][]*HistoryEntry{
+				"1": []*HistoryEntry{
+					&HistoryEntry{UserIDs: []string{"1", "3"}, Outcome: OutcomeFinished},
+					shared,
+					&HistoryEntry{PairingID: "B", UserIDs: []string{"1", "4"}, FinishedAt: july, Outcome: OutcomeExpired},
+				},
+				"2": []*HistoryEntry{shared},
+			},
+		}
+		juneValue, _ := json.Marshal([]*HistoryEntry{shared})
+
+		api := &plugintest.API{}
+		api.On("KVGet", KVKEY).Return(nil, nil)
+		mockKVStore(api, data)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil)
+		store := newKVStore(api)
+
+		assert.Nil(t, store.Migrate())
+		//the entry of both users is logged once, the entry without an end is skipped
+		api.AssertCalled(t, "KVCompareAndSet", KVKEYPairingLogPrefix+"2020-06", []byte(nil), juneValue)
+		api.AssertCalled(t, "KVCompareAndSet", KVKEYPairingLogPrefix+"2020-07", []byte(nil), mock.Anything)
+		api.AssertNumberOfCalls(t, "KVCompareAndSet", 2)
+	})
+}
+
+func TestPairingLog(t *testing.T) {
+	day := func(month time.Month, d int) int64 {
+		return time.Date(2020, month, d, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	}
+	june := []*HistoryEntry{&HistoryEntry{PairingID: "A", FinishedAt: day(time.June, 30), Outcome: OutcomeFinished}}
+	juneValue, _ := json.Marshal(june)
+	entry := &HistoryEntry{PairingID: "B", FinishedAt: day(time.June, 30), Outcome: OutcomeDeclined, Invitation: true}
+	newJuneValue, _ := json.Marshal(append(june, entry))
+
+	api := &plugintest.API{}
+	api.On("KVGet", KVKEYPairingLogPrefix+"2020-06").Return(juneValue, nil).Once()
+	api.On("KVCompareAndSet", KVKEYPairingLogPrefix+"2020-06", juneValue, newJuneValue).Return(true, nil)
+	store := newKVStore(api)
+	assert.Nil(t, store.AppendPairingLog(entry))
+
+	//an entry that has already been logged is not added again
+	api.On("KVGet", KVKEYPairingLogPrefix+"2020-06").Return(newJuneValue, nil)
+	assert.Nil(t, store.AppendPairingLog(entry))
+	api.AssertNumberOfCalls(t, "KVCompareAndSet", 1)
+
+	api.On("KVGet", KVKEYPairingLogPrefix+"2020-07").Return(nil, nil)
+	log, err := store.GetPairingLog(time.Date(2020, time.June, 15, 0, 0, 0, 0, time.UTC), time.Date(2020, time.July, 15, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, []*HistoryEntry{june[0], entry}, log)
+}
@@ -27,6 +27,178 @@ const manifestStr = `
       "windows-amd64": "server/dist/plugin-windows-amd64.exe"
     },
     "executable": ""
+  },
+  "settings_schema": {
+    "header": "Configure how lunchbot pairs your users.",
+    "footer": "",
+    "settings": [
+      {
+        "key": "DefaultGroupSize",
+        "display_name": "Default group size:",
+        "type": "number",
+        "help_text": "The number of people having lunch together when no group size is given. Must be between 2 and 6.",
+        "placeholder": "",
+        "default": 2
+      },
+      {
+        "key": "PostAnnouncement",
+        "display_name": "Announce pairings:",
+        "type": "bool",
+        "help_text": "When true, lunchbot posts a message into the channel whenever users got paired.",
+        "placeholder": "",
+        "default": true
+      },
+      {
+        "key": "EligibleStatuses",
+        "display_name": "Eligible statuses:",
+        "type": "text",
+        "help_text": "Comma-separated list of the statuses users can get paired with: online, away, dnd and offline.",
+        "placeholder": "",
+        "default": "online,away,dnd"
+      },
+      {
+        "key": "UnavailableUserPolicy",
+        "display_name": "Unavailable users:",
+        "type": "dropdown",
+        "help_text": "What happens to users that are not available when a pairing round runs, because of their status or the availability they set.",
+        "placeholder": "",
+        "default": "skip",
+        "options": [
+          {
+            "display_name": "Skip them",
+            "value": "skip"
+          },
+          {
+            "display_name": "Let them go first in the next round of the channel",
+            "value": "queue"
+          }
+        ]
+      },
+      {
+        "key": "InvitationTimeout",
+        "display_name": "Invitation timeout:",
+        "type": "number",
+        "help_text": "The number of minutes invited users have to accept an invitation before lunchbot looks for someone else. Must be between 1 and 10080.",
+        "placeholder": "",
+        "default": 60
+      },
+      {
+        "key": "PairingTimeToLive",
+        "display_name": "Pairing duration:",
+        "type": "number",
+        "help_text": "The number of hours after which a pairing ends automatically if nobody finished it. Users can extend their pairing using /lunchbot extend. Must be between 1 and 8760.",
+        "placeholder": "",
+        "default": 168
+      },
+      {
+        "key": "PairingExpiryWarning",
+        "display_name": "Pairing expiry warning:",
+        "type": "number",
+        "help_text": "The number of hours before a pairing ends automatically that its members get notified. Must be shorter than the pairing duration.",
+        "placeholder": "",
+        "default": 24
+      },
+      {
+        "key": "MatchStrategy",
+        "display_name": "Match strategy:",
+        "type": "dropdown",
+        "help_text": "How partners are picked among the candidates. Channel admins can choose a different strategy for their channel.",
+        "placeholder": "",
+        "default": "weighted-random",
+        "options": [
+          {
+            "display_name": "Random, preferring new partners, shared topics and other departments",
+            "value": "weighted-random"
+          },
+          {
+            "display_name": "As many new connections as possible (approximated), without randomness",
+            "value": "new-connections"
+          }
+        ]
+      },
+      {
+        "key": "NumHistoryEntries",
+        "display_name": "History length:",
+        "type": "number",
+        "help_text": "The number of past pairings, and separately of past invitations, that are remembered per user. Recent partners are less likely to get paired again. Must be between 1 and 1000.",
+        "placeholder": "",
+        "default": 50
+      },
+      {
+        "key": "NewUserWeight",
+        "display_name": "Weight of new partners:",
+        "type": "number",
+        "help_text": "How much users that have never been paired with each other are preferred. Past partners have a weight between 1 and the history length. Must be between 1 and 100000.",
+        "placeholder": "",
+        "default": 1000
+      },
+      {
+        "key": "SharedTopicWeight",
+        "display_name": "Weight of shared topics:",
+        "type": "number",
+        "help_text": "The weight that gets added for every topic two users are both interested in. Must be between 0 and 100000.",
+        "placeholder": "",
+        "default": 100
+      },
+      {
+        "key": "DepartmentAttribute",
+        "display_name": "Department attribute:",
+        "type": "dropdown",
+        "help_text": "The attribute of a user that decides which department he belongs to. Users from different departments are preferred as partners.",
+        "placeholder": "",
+        "default": "none",
+        "options": [
+          {
+            "display_name": "Do not prefer other departments",
+            "value": "none"
+          },
+          {
+            "display_name": "Position of the user profile",
+            "value": "position"
+          },
+          {
+            "display_name": "Teams the user is member of",
+            "value": "teams"
+          },
+          {
+            "display_name": "Custom profile property",
+            "value": "custom"
+          }
+        ]
+      },
+      {
+        "key": "DepartmentProperty",
+        "display_name": "Department profile property:",
+        "type": "text",
+        "help_text": "The name of the custom profile property that contains the department of a user. Only used if the department attribute is a custom profile property.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "CrossDepartmentWeight",
+        "display_name": "Weight of other departments:",
+        "type": "number",
+        "help_text": "The weight that gets added for every group member from a different department. Must be between 0 and 100000.",
+        "placeholder": "",
+        "default": 500
+      },
+      {
+        "key": "MaxChannelMembers",
+        "display_name": "Maximum channel members:",
+        "type": "number",
+        "help_text": "The number of channel members that are considered when looking for a pairing. 0 considers every member of the channel.",
+        "placeholder": "",
+        "default": 0
+      },
+      {
+        "key": "BotDisplayName",
+        "display_name": "Bot display name:",
+        "type": "text",
+        "help_text": "The display name of the lunchbot.",
+        "placeholder": "",
+        "default": "LunchBot"
+      }
+    ]
   }
 }
 `
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// GetSharedTopics returns the topics that both given users are interested in, spelled like the first user spells them.
+// Topics are compared regardless of their case and whitespace.
+func GetSharedTopics(data *LunchbotData, userID string, otherUserID string) []string {
+	sharedTopics := []string{}
+	if data.UserTopics == nil {
+		return sharedTopics
+	}
+	for topic := range data.UserTopics[userID] {
+		if _, ok := FindTopic(data.UserTopics[otherUserID], topic); ok {
+			sharedTopics = append(sharedTopics, topic)
+		}
+	}
+	sort.Strings(sharedTopics)
+	return sharedTopics
+}
+
+// GetEligibleChannelMembers returns all members of the given channel that can take part in a pairing round,
+// as well as the members that would take part but are not available right now.
+// If a maximum number of channel members is configured, only that many members are considered.
+func (p *Plugin) GetEligibleChannelMembers(cache *UserCache, ctx *MatchContext) ([]*model.User, []*model.User, *model.AppError) {
+	availability := p.NewAvailabilityFilter(cache)
+	pipeline := &CandidatePipeline{
+		Source: &ChannelMemberSource{Cache: cache, MaxMembers: ctx.Config.MaxChannelMembers, Store: p.store},
+		Filters: []CandidateFilter{
+			BotFilter,
+			PairedFilter,
+			InvitationFilter,
+			ParticipationFilter,
+			p.RoleFilter(p.GetChannelSettings(ctx.ChannelID).EligibleRoles),
+			availability,
+		},
+	}
+	eligibleUsers, appErr := pipeline.GetCandidates(ctx)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	return eligibleUsers, availability.Unavailable, nil
+}
+
+// CanJoinGroup returns true if the given user has no blacklist conflicts with any of the group members
+func CanJoinGroup(data *LunchbotData, userID string, group []string) bool {
+	for _, memberID := range group {
+		if IsBlacklisted(data, userID, memberID) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortUsersForMatching returns the given users in the order they should get matched: the queued users first, then the users with the highest fairness priority,
+// then the users with the fewest possible partners, this avoids leaving them out in the end. Users with the same priority are shuffled using the random source of the context.
+func SortUsersForMatching(ctx *MatchContext, users []*model.User, queued map[string]struct{}) []*model.User {
+	//everyone can be paired with everyone else except for blacklist conflicts, so only the conflicts are counted
+	userIDs := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		userIDs[user.Id] = struct{}{}
+	}
+	conflicts := map[string]int{}
+	for _, user := range users {
+		for otherUserID := range ctx.Data.Blacklists[user.Id] {
+			if _, ok := userIDs[otherUserID]; !ok || otherUserID == user.Id {
+				continue
+			}
+			//users that blacklisted each other have a single conflict
+			if _, ok := ctx.Data.Blacklists[otherUserID][user.Id]; ok && otherUserID < user.Id {
+				continue
+			}
+			conflicts[user.Id]++
+			conflicts[otherUserID]++
+		}
+	}
+	sortedUsers := make([]*model.User, len(users))
+	copy(sortedUsers, users)
+	ctx.Rand.Shuffle(len(sortedUsers), func(i, j int) {
+		sortedUsers[i], sortedUsers[j] = sortedUsers[j], sortedUsers[i]
+	})
+	sort.SliceStable(sortedUsers, func(i, j int) bool {
+		_, iQueued := queued[sortedUsers[i].Id]
+		_, jQueued := queued[sortedUsers[j].Id]
+		if iQueued != jQueued {
+			return iQueued
+		}
+		iPriority, jPriority := ctx.Priorities[sortedUsers[i].Id], ctx.Priorities[sortedUsers[j].Id]
+		if iPriority != jPriority {
+			return iPriority > jPriority
+		}
+		return conflicts[sortedUsers[i].Id] > conflicts[sortedUsers[j].Id]
+	})
+	return sortedUsers
+}
+
+// MatchUsers splits the given users into groups of the given size. Blacklists are respected, recent partners are avoided and
+// users with shared topics or from different departments are preferred. Users that are left over get added to the other groups instead of being left out,
+// which means that for pairs an odd number of users results in one group of three. The queued users get matched first.
+// The members of the groups are picked by the given matcher, unless its strategy matches all users at once. All random choices are taken from the source of the context,
+// so the same source and input always result in the same groups.
+// Returns the matched groups and the users that could not be matched with anyone.
+func MatchUsers(ctx *MatchContext, matcher *Matcher, users []*model.User, groupSize int, queued map[string]struct{}) ([][]*model.User, []*model.User) {
+	if batch, ok := matcher.Strategy.(BatchStrategy); ok {
+		return batch.MatchGroups(ctx, matcher, users, groupSize, queued)
+	}
+
+	sortedUsers := SortUsersForMatching(ctx, users, queued)
+	//every pair is scored once up front, instead of scoring the remaining candidates again for every group
+	graph := NewCompatibilityGraph(ctx, matcher, sortedUsers)
+
+	groups := [][]int{}
+	matched := make([]bool, len(sortedUsers))
+	availableUsers := []int{}
+	buildGroups := func(candidates []int, groupSize int) []int {
+		for _, user := range candidates {
+			if matched[user] {
+				continue
+			}
+
+			matched[user] = true
+			availableUsers = availableUsers[:0]
+			for _, candidate := range candidates {
+				if !matched[candidate] {
+					availableUsers = append(availableUsers, candidate)
+				}
+			}
+			group := append([]int{user}, graph.FillGroup(ctx, matcher.Strategy, []int{user}, availableUsers, groupSize)...)
+			for _, member := range group {
+				matched[member] = true
+			}
+
+			if len(group) < groupSize {
+				//the group cannot be filled, its members are left over
+				for _, member := range group {
+					matched[member] = false
+				}
+				continue
+			}
+			groups = append(groups, group)
+		}
+
+		remainingUsers := []int{}
+		for _, user := range candidates {
+			if !matched[user] {
+				remainingUsers = append(remainingUsers, user)
+			}
+		}
+		return remainingUsers
+	}
+
+	allUsers := make([]int, len(sortedUsers))
+	for index := range allUsers {
+		allUsers[index] = index
+	}
+	leftovers := buildGroups(allUsers, groupSize)
+
+	//if there are enough users left over they get a smaller group of their own
+	if len(leftovers) >= MinGroupSize && len(leftovers) >= groupSize/2 {
+		leftovers = buildGroups(leftovers, len(leftovers))
+	}
+
+	//instead of leaving someone out, add him to a group that he can join
+	unmatched := []*model.User{}
+	for _, user := range leftovers {
+		joinedGroup := false
+		for index, group := range groups {
+			if len(group) > groupSize {
+				continue
+			}
+			if _, ok := graph.GetJoinWeight(group, user, -1); !ok {
+				continue
+			}
+			groups[index] = append(group, user)
+			joinedGroup = true
+			break
+		}
+		if !joinedGroup {
+			unmatched = append(unmatched, sortedUsers[user])
+		}
+	}
+
+	userGroups := [][]*model.User{}
+	for _, group := range groups {
+		userGroup := []*model.User{}
+		for _, member := range group {
+			userGroup = append(userGroup, sortedUsers[member])
+		}
+		userGroups = append(userGroups, userGroup)
+	}
+	return userGroups, unmatched
+}
+
+// MatchResult is the outcome of matching the members of a channel
+type MatchResult struct {
+	Round       *Round          //Record of the round that allows to replay it
+	Groups      [][]*model.User //Groups that have been matched
+	Unmatched   []*model.User   //Users that could not be matched with anyone
+	Unavailable []*model.User   //Users that would have taken part but were not available
+}
+
+// MatchChannel splits all eligible members of the given channel into groups of the given size. Users that have been queued for the channel get matched first,
+// followed by the users that have been waiting the longest for a pairing.
+// The random choices are made with the given seed, which is recorded together with the input of the matching in the round of the result.
+func (p *Plugin) MatchChannel(channelID string, groupSize int, seed int64) (*MatchResult, error) {
+	ctx := &MatchContext{
+		Config:    p.getConfiguration(),
+		ChannelID: channelID,
+		Now:       time.Now(),
+		Rand:      NewRand(seed),
+	}
+	users, unavailable, appErr := p.GetEligibleChannelMembers(NewUserCache(p.API), ctx)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get the channel members")
+	}
+
+	ctx.Departments = p.GetDepartments(users)
+	ctx.Priorities = GetFairnessPriorities(ctx.Data, users, ctx.Now)
+	strategy := p.GetChannelSettings(channelID).MatchStrategy
+	queued := GetQueuedUserIDs(ctx.Data, channelID)
+	groups, unmatched := MatchUsers(ctx, NewMatcher(GetMatchStrategy(strategy)), users, groupSize, queued)
+	round := &Round{
+		ID:        model.NewId(),
+		ChannelID: channelID,
+		CreatedAt: model.GetMillis(),
+		Seed:      seed,
+		GroupSize: groupSize,
+		Input:     NewRoundInput(ctx, strategy, users, queued),
+		Groups:    GetGroupUserIDs(groups),
+		Unmatched: GetUserIDList(unmatched),
+	}
+	return &MatchResult{Round: round, Groups: groups, Unmatched: unmatched, Unavailable: unavailable}, nil
+}
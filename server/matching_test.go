@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMatchUsers(t *testing.T) {
+	t.Run("Even number of users", func(t *testing.T) {
+		users := []*model.User{
+			&model.User{Id: "1"},
+			&model.User{Id: "2"},
+			&model.User{Id: "3"},
+			&model.User{Id: "4"},
+		}
+
+		groups, unmatched := MatchUsers(newTestMatchContext(&LunchbotData{}, nil, 1), NewMatcher(WeightedRandomStrategy{}), users, 2, nil)
+		assert.Len(t, groups, 2)
+		assert.Empty(t, unmatched)
+		for _, group := range groups {
+			assert.Len(t, group, 2)
+		}
+	})
+
+	t.Run("Odd number of users", func(t *testing.T) {
+		users := []*model.User{
+			&model.User{Id: "1"},
+			&model.User{Id: "2"},
+			&model.User{Id: "3"},
+			&model.User{Id: "4"},
+			&model.User{Id: "5"},
+		}
+
+		groups, unmatched := MatchUsers(newTestMatchContext(&LunchbotData{}, nil, 1), NewMatcher(WeightedRandomStrategy{}), users, 2, nil)
+		assert.Len(t, groups, 2)
+		assert.Empty(t, unmatched)
+		assert.Equal(t, 5, len(groups[0])+len(groups[1]))
+	})
+
+	t.Run("Blacklists are respected", func(t *testing.T) {
+		data := &LunchbotData{
+			Blacklists: map[string]map[string]struct{}{
+				"1": map[string]struct{}{
+					"2": struct{}{},
+				},
+			},
+		}
+		users := []*model.User{
+			&model.User{Id: "1"},
+			&model.User{Id: "2"},
+			&model.User{Id: "3"},
+			&model.User{Id: "4"},
+		}
+
+		for i := 0; i < 20; i++ {
+			groups, unmatched := MatchUsers(newTestMatchContext(data, nil, 1), NewMatcher(WeightedRandomStrategy{}), users, 2, nil)
+			assert.Len(t, groups, 2)
+			assert.Empty(t, unmatched)
+			for _, group := range groups {
+				ids := []string{group[0].Id, group[1].Id}
+				assert.False(t, assert.ObjectsAreEqual([]string{"1", "2"}, ids) || assert.ObjectsAreEqual([]string{"2", "1"}, ids))
+			}
+		}
+	})
+
+	t.Run("Nobody to pair with", func(t *testing.T) {
+		data := &LunchbotData{
+			Blacklists: map[string]map[string]struct{}{
+				"1": map[string]struct{}{
+					"2": struct{}{},
+				},
+			},
+		}
+		users := []*model.User{
+			&model.User{Id: "1"},
+			&model.User{Id: "2"},
+		}
+
+		groups, unmatched := MatchUsers(newTestMatchContext(data, nil, 1), NewMatcher(WeightedRandomStrategy{}), users, 2, nil)
+		assert.Empty(t, groups)
+		assert.Len(t, unmatched, 2)
+	})
+}
+
+func TestMatchUsers_groupSizes(t *testing.T) {
+	users := []*model.User{}
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"} {
+		users = append(users, &model.User{Id: id})
+	}
+
+	t.Run("Groups of four", func(t *testing.T) {
+		groups, unmatched := MatchUsers(newTestMatchContext(&LunchbotData{}, nil, 1), NewMatcher(WeightedRandomStrategy{}), users[:8], 4, nil)
+		assert.Len(t, groups, 2)
+		assert.Empty(t, unmatched)
+		assert.Len(t, groups[0], 4)
+		assert.Len(t, groups[1], 4)
+	})
+
+	t.Run("Single leftover joins a group", func(t *testing.T) {
+		groups, unmatched := MatchUsers(newTestMatchContext(&LunchbotData{}, nil, 1), NewMatcher(WeightedRandomStrategy{}), users[:9], 4, nil)
+		assert.Len(t, groups, 2)
+		assert.Empty(t, unmatched)
+		assert.Equal(t, 9, len(groups[0])+len(groups[1]))
+	})
+
+	t.Run("Many leftovers get their own group", func(t *testing.T) {
+		groups, unmatched := MatchUsers(newTestMatchContext(&LunchbotData{}, nil, 1), NewMatcher(WeightedRandomStrategy{}), users, 6, nil)
+		assert.Len(t, groups, 2)
+		assert.Empty(t, unmatched)
+		assert.ElementsMatch(t, []int{5, 6}, []int{len(groups[0]), len(groups[1])})
+	})
+}
+
+func TestMatchUsers_queued(t *testing.T) {
+	users := []*model.User{&model.User{Id: "A"}, &model.User{Id: "B"}, &model.User{Id: "Q"}}
+	//Q and B can only be paired with A, the queued user Q goes first
+	data := &LunchbotData{
+		Blacklists: map[string]map[string]struct{}{
+			"B": map[string]struct{}{"Q": struct{}{}},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		groups, unmatched := MatchUsers(newTestMatchContext(data, nil, int64(i)), NewMatcher(WeightedRandomStrategy{}), users, 2, map[string]struct{}{"Q": struct{}{}})
+		assert.Len(t, groups, 1)
+		assert.ElementsMatch(t, []string{"A", "Q"}, []string{groups[0][0].Id, groups[0][1].Id})
+		assert.Len(t, unmatched, 1)
+		assert.Equal(t, "B", unmatched[0].Id)
+	}
+}
+
+func TestGetPairedUserIDs(t *testing.T) {
+	data := &LunchbotData{
+		Pairings: map[string]*Pairing{
+			"A": &Pairing{ID: "A", UserIDs: []string{"1", "2", "3"}},
+			"B": &Pairing{ID: "B", UserIDs: []string{"4", "5"}},
+		},
+		ActivePairings: map[string]string{
+			"1": "A",
+			"2": "A",
+			"3": "A",
+			"4": "B",
+			"5": "B",
+		},
+	}
+
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, GetPairedUserIDs(data, "2"))
+	assert.ElementsMatch(t, []string{"4", "5"}, GetPairedUserIDs(data, "4"))
+	assert.Empty(t, GetPairedUserIDs(data, "6"))
+}
+
+func TestMigrateData(t *testing.T) {
+	data := &LunchbotData{
+		ActivePairings: map[string]string{
+			"1": "2",
+			"2": "3",
+			"3": "1",
+			"4": "5",
+			"5": "4",
+		},
+		LastPairings: map[string][]string{
+			"1": []string{"4"},
+		},
+	}
+	MigrateData(data)
+
+	assert.Equal(t, DataVersion, data.Version)
+	assert.Len(t, data.Pairings, 2)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, GetPairedUserIDs(data, "2"))
+	assert.ElementsMatch(t, []string{"4", "5"}, GetPairedUserIDs(data, "5"))
+	assert.Equal(t, []string{"4"}, data.LastPairings["1"])
+}
+
+func BenchmarkMatchChannel(b *testing.B) {
+	for _, count := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("%d members", count), func(b *testing.B) {
+			//every member has a history and topics, and the data is read from the KVStore like on a real server
+			users, data, _ := getLargeMatchingData(count)
+			data.Participations = getJoinedParticipations(GetUserIDList(users)...)
+			plugin := &Plugin{}
+			api := &plugintest.API{}
+			api.On("GetUsersInChannel", "channel", "username", mock.AnythingOfType("int"), channelMembersPerPage).Return(getChannelMembers(count), nil)
+			api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses(model.STATUS_ONLINE), nil)
+			plugin.SetAPI(api)
+			plugin.store = newKVStore(newFakeKVAPI(api, data))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := plugin.MatchChannel("channel", 2, int64(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
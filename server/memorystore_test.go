@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store that keeps all data in memory, it is used to test the plugin without mocking the KVStore
+type memoryStore struct {
+	lock           sync.Mutex
+	users          map[string]*UserData
+	pairings       map[string]*Pairing
+	invitations    map[string]*Invitation
+	schedules      map[string]*Schedule
+	channelConfigs map[string]*ChannelConfig
+	catalogue      map[string]*CatalogueTopic
+	questions      map[string]*Question
+	rounds         map[string]*Round
+	pairingLog     map[string][]*HistoryEntry
+}
+
+// newMemoryStore returns a memoryStore that contains the given data
+func newMemoryStore(data *LunchbotData) *memoryStore {
+	s := &memoryStore{
+		users:          map[string]*UserData{},
+		pairings:       map[string]*Pairing{},
+		invitations:    map[string]*Invitation{},
+		schedules:      map[string]*Schedule{},
+		channelConfigs: map[string]*ChannelConfig{},
+		catalogue:      map[string]*CatalogueTopic{},
+		questions:      map[string]*Question{},
+		rounds:         map[string]*Round{},
+		pairingLog:     map[string][]*HistoryEntry{},
+	}
+	for userID, userData := range SplitData(data) {
+		s.users[userID] = &UserData{}
+		copyValue(userData, s.users[userID])
+	}
+	for id, pairing := range data.Pairings {
+		s.pairings[id] = &Pairing{}
+		copyValue(pairing, s.pairings[id])
+	}
+	for id, invitation := range data.Invitations {
+		s.invitations[id] = &Invitation{}
+		copyValue(invitation, s.invitations[id])
+	}
+	for channelID, schedule := range data.Schedules {
+		s.schedules[channelID] = &Schedule{}
+		copyValue(schedule, s.schedules[channelID])
+	}
+	for channelID, channelConfig := range data.ChannelConfigs {
+		s.channelConfigs[channelID] = &ChannelConfig{}
+		copyValue(channelConfig, s.channelConfigs[channelID])
+	}
+	if data.TopicCatalogue != nil {
+		copyValue(data.TopicCatalogue, &s.catalogue)
+	}
+	if data.Questions != nil {
+		copyValue(data.Questions, &s.questions)
+	}
+	return s
+}
+
+// copyValue deep copies the given value into the given target, so callers cannot change the stored data without updating it
+func copyValue(value interface{}, target interface{}) {
+	data, _ := json.Marshal(value)
+	json.Unmarshal(data, target)
+}
+
+func (s *memoryStore) ReadAll() (LunchbotData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data := newLunchbotData()
+	for userID, userData := range s.users {
+		userDataCopy := &UserData{}
+		copyValue(userData, userDataCopy)
+		addUserData(&data, userID, userDataCopy)
+	}
+	for id, pairing := range s.pairings {
+		data.Pairings[id] = &Pairing{}
+		copyValue(pairing, data.Pairings[id])
+	}
+	for id, invitation := range s.invitations {
+		data.Invitations[id] = &Invitation{}
+		copyValue(invitation, data.Invitations[id])
+	}
+	for channelID, schedule := range s.schedules {
+		data.Schedules[channelID] = &Schedule{}
+		copyValue(schedule, data.Schedules[channelID])
+	}
+	for channelID, channelConfig := range s.channelConfigs {
+		data.ChannelConfigs[channelID] = &ChannelConfig{}
+		copyValue(channelConfig, data.ChannelConfigs[channelID])
+	}
+	copyValue(s.catalogue, &data.TopicCatalogue)
+	copyValue(s.questions, &data.Questions)
+	return data, nil
+}
+
+func (s *memoryStore) ReadUsers(userIDs []string) (LunchbotData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data := newLunchbotData()
+	for _, userID := range userIDs {
+		userData, ok := s.users[userID]
+		if !ok {
+			continue
+		}
+		userDataCopy := &UserData{}
+		copyValue(userData, userDataCopy)
+		addUserData(&data, userID, userDataCopy)
+		if pairing, ok := s.pairings[userData.ActivePairingID]; ok {
+			data.Pairings[pairing.ID] = &Pairing{}
+			copyValue(pairing, data.Pairings[pairing.ID])
+		}
+	}
+	return data, nil
+}
+
+func (s *memoryStore) Migrate() error {
+	return nil
+}
+
+func (s *memoryStore) Clear() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users = map[string]*UserData{}
+	s.pairings = map[string]*Pairing{}
+	s.invitations = map[string]*Invitation{}
+	s.schedules = map[string]*Schedule{}
+	s.channelConfigs = map[string]*ChannelConfig{}
+	s.catalogue = map[string]*CatalogueTopic{}
+	s.questions = map[string]*Question{}
+	s.rounds = map[string]*Round{}
+	s.pairingLog = map[string][]*HistoryEntry{}
+	return nil
+}
+
+func (s *memoryStore) GetUserData(userID string) (*UserData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	userData := &UserData{}
+	if storedUserData, ok := s.users[userID]; ok {
+		copyValue(storedUserData, userData)
+	}
+	return userData, nil
+}
+
+func (s *memoryStore) UpdateUserData(userID string, update func(userData *UserData) error) (*UserData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	userData := &UserData{}
+	if storedUserData, ok := s.users[userID]; ok {
+		copyValue(storedUserData, userData)
+	}
+	if err := update(userData); err != nil {
+		return nil, err
+	}
+	s.users[userID] = &UserData{}
+	copyValue(userData, s.users[userID])
+	return userData, nil
+}
+
+func (s *memoryStore) GetPairing(pairingID string) (*Pairing, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedPairing, ok := s.pairings[pairingID]
+	if !ok {
+		return nil, nil
+	}
+	pairing := &Pairing{}
+	copyValue(storedPairing, pairing)
+	return pairing, nil
+}
+
+func (s *memoryStore) CreatePairing(pairing *Pairing) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.pairings[pairing.ID]; ok {
+		return errConflict
+	}
+	s.pairings[pairing.ID] = &Pairing{}
+	copyValue(pairing, s.pairings[pairing.ID])
+	return nil
+}
+
+func (s *memoryStore) UpdatePairing(pairingID string, update func(pairing *Pairing) error) (*Pairing, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedPairing, ok := s.pairings[pairingID]
+	if !ok {
+		return nil, nil
+	}
+	pairing := &Pairing{}
+	copyValue(storedPairing, pairing)
+	if err := update(pairing); err != nil {
+		return nil, err
+	}
+	s.pairings[pairingID] = &Pairing{}
+	copyValue(pairing, s.pairings[pairingID])
+	return pairing, nil
+}
+
+func (s *memoryStore) DeletePairing(pairingID string) (*Pairing, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pairing, ok := s.pairings[pairingID]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.pairings, pairingID)
+	return pairing, nil
+}
+
+func (s *memoryStore) GetInvitation(invitationID string) (*Invitation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedInvitation, ok := s.invitations[invitationID]
+	if !ok {
+		return nil, nil
+	}
+	invitation := &Invitation{}
+	copyValue(storedInvitation, invitation)
+	return invitation, nil
+}
+
+func (s *memoryStore) CreateInvitation(invitation *Invitation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.invitations[invitation.ID]; ok {
+		return errConflict
+	}
+	s.invitations[invitation.ID] = &Invitation{}
+	copyValue(invitation, s.invitations[invitation.ID])
+	return nil
+}
+
+func (s *memoryStore) UpdateInvitation(invitationID string, update func(invitation *Invitation) error) (*Invitation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedInvitation, ok := s.invitations[invitationID]
+	if !ok {
+		return nil, nil
+	}
+	invitation := &Invitation{}
+	copyValue(storedInvitation, invitation)
+	if err := update(invitation); err != nil {
+		return nil, err
+	}
+	s.invitations[invitationID] = &Invitation{}
+	copyValue(invitation, s.invitations[invitationID])
+	return invitation, nil
+}
+
+func (s *memoryStore) DeleteInvitation(invitationID string) (*Invitation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	invitation, ok := s.invitations[invitationID]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.invitations, invitationID)
+	return invitation, nil
+}
+
+func (s *memoryStore) GetSchedule(channelID string) (*Schedule, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedSchedule, ok := s.schedules[channelID]
+	if !ok {
+		return nil, nil
+	}
+	schedule := &Schedule{}
+	copyValue(storedSchedule, schedule)
+	return schedule, nil
+}
+
+func (s *memoryStore) SaveSchedule(schedule *Schedule) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.schedules[schedule.ChannelID] = &Schedule{}
+	copyValue(schedule, s.schedules[schedule.ChannelID])
+	return nil
+}
+
+func (s *memoryStore) UpdateSchedule(channelID string, update func(schedule *Schedule) error) (*Schedule, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	storedSchedule, ok := s.schedules[channelID]
+	if !ok {
+		return nil, nil
+	}
+	schedule := &Schedule{}
+	copyValue(storedSchedule, schedule)
+	if err := update(schedule); err != nil {
+		return nil, err
+	}
+	s.schedules[channelID] = &Schedule{}
+	copyValue(schedule, s.schedules[channelID])
+	return schedule, nil
+}
+
+func (s *memoryStore) DeleteSchedule(channelID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.schedules, channelID)
+	return nil
+}
+
+func (s *memoryStore) GetChannelConfig(channelID string) (*ChannelConfig, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	channelConfig := &ChannelConfig{}
+	if storedChannelConfig, ok := s.channelConfigs[channelID]; ok {
+		copyValue(storedChannelConfig, channelConfig)
+	}
+	return channelConfig, nil
+}
+
+func (s *memoryStore) SaveChannelConfig(channelID string, channelConfig *ChannelConfig) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.channelConfigs[channelID] = &ChannelConfig{}
+	copyValue(channelConfig, s.channelConfigs[channelID])
+	return nil
+}
+
+func (s *memoryStore) UpdateChannelConfig(channelID string, update func(channelConfig *ChannelConfig) error) (*ChannelConfig, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	channelConfig := &ChannelConfig{}
+	if storedChannelConfig, ok := s.channelConfigs[channelID]; ok {
+		copyValue(storedChannelConfig, channelConfig)
+	}
+	if err := update(channelConfig); err != nil {
+		return nil, err
+	}
+	s.channelConfigs[channelID] = &ChannelConfig{}
+	copyValue(channelConfig, s.channelConfigs[channelID])
+	return channelConfig, nil
+}
+
+func (s *memoryStore) GetTopicCatalogue() (map[string]*CatalogueTopic, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	catalogue := map[string]*CatalogueTopic{}
+	copyValue(s.catalogue, &catalogue)
+	return catalogue, nil
+}
+
+func (s *memoryStore) UpdateTopicCatalogue(update func(catalogue map[string]*CatalogueTopic) error) (map[string]*CatalogueTopic, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	catalogue := map[string]*CatalogueTopic{}
+	copyValue(s.catalogue, &catalogue)
+	if err := update(catalogue); err != nil {
+		return nil, err
+	}
+	s.catalogue = map[string]*CatalogueTopic{}
+	copyValue(catalogue, &s.catalogue)
+	return catalogue, nil
+}
+
+func (s *memoryStore) GetQuestions() (map[string]*Question, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	questions := map[string]*Question{}
+	copyValue(s.questions, &questions)
+	return questions, nil
+}
+
+func (s *memoryStore) UpdateQuestions(update func(questions map[string]*Question) error) (map[string]*Question, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	questions := map[string]*Question{}
+	copyValue(s.questions, &questions)
+	if err := update(questions); err != nil {
+		return nil, err
+	}
+	s.questions = map[string]*Question{}
+	copyValue(questions, &s.questions)
+	return questions, nil
+}
+
+func (s *memoryStore) GetRound(roundID string) (*Round, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	round, ok := s.rounds[roundID]
+	if !ok {
+		return nil, nil
+	}
+	result := &Round{}
+	copyValue(round, result)
+	return result, nil
+}
+
+func (s *memoryStore) GetRounds(channelID string) ([]*Round, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rounds := []*Round{}
+	for _, round := range s.rounds {
+		if round.ChannelID == channelID {
+			result := &Round{}
+			copyValue(round, result)
+			rounds = append(rounds, result)
+		}
+	}
+	return rounds, nil
+}
+
+func (s *memoryStore) SaveRound(round *Round) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rounds[round.ID] = &Round{}
+	copyValue(round, s.rounds[round.ID])
+	return nil
+}
+
+func (s *memoryStore) AppendPairingLog(entry *HistoryEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	month := GetPairingLogMonth(entry)
+	if !ContainsHistoryEntry(s.pairingLog[month], entry) {
+		entryCopy := &HistoryEntry{}
+		copyValue(entry, entryCopy)
+		s.pairingLog[month] = append(s.pairingLog[month], entryCopy)
+	}
+	return nil
+}
+
+func (s *memoryStore) GetPairingLog(from time.Time, to time.Time) ([]*HistoryEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := []*HistoryEntry{}
+	for _, month := range GetPairingLogMonths(from, to) {
+		for _, entry := range s.pairingLog[month] {
+			entryCopy := &HistoryEntry{}
+			copyValue(entry, entryCopy)
+			entries = append(entries, entryCopy)
+		}
+	}
+	return entries, nil
+}
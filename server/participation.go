@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Participation describes whether a user wants to be paired with others
+type Participation struct {
+	Joined      bool            `json:"Joined"`      //User takes part in every channel that he has not left explicitly
+	Channels    map[string]bool `json:"Channels"`    //Key: ChannelID, Value: true if the user joined, false if the user left the channel
+	PausedUntil int64           `json:"PausedUntil"` //Unix timestamp in milliseconds until the user does not want to get paired
+	//Availability limits the days and hours the user can get paired, the user can always get paired if it is nil
+	Availability *Availability `json:"Availability,omitempty"`
+	//QueuedChannels contains the channels whose next round the user goes first in, because the user was not available in the last one.
+	//Key: ChannelID, Value: Unix timestamp in milliseconds of the round the user missed
+	QueuedChannels map[string]int64 `json:"QueuedChannels,omitempty"`
+	JoinedAt       int64            `json:"JoinedAt,omitempty"`      //Unix timestamp in milliseconds of the first time the user joined
+	LastPairedAt   int64            `json:"LastPairedAt,omitempty"`  //Unix timestamp in milliseconds of the last pairing of the user
+	SkippedRounds  int              `json:"SkippedRounds,omitempty"` //Number of pairing rounds in a row the user has been left out of
+}
+
+// IsPaused returns true if the user paused his participation at the given time
+func (pa *Participation) IsPaused(now time.Time) bool {
+	return pa.PausedUntil > now.UnixNano()/int64(time.Millisecond)
+}
+
+// IsParticipating returns true if the user can get picked in the given channel at the given time
+func (pa *Participation) IsParticipating(channelID string, now time.Time) bool {
+	if pa.IsPaused(now) {
+		return false
+	}
+	if joined, ok := pa.Channels[channelID]; ok {
+		return joined
+	}
+	return pa.Joined
+}
+
+// IsParticipating returns true if the given user can get picked in the given channel at the given time
+func IsParticipating(data *LunchbotData, userID string, channelID string, now time.Time) bool {
+	participation, ok := data.Participations[userID]
+	if !ok {
+		return false
+	}
+	return participation.IsParticipating(channelID, now)
+}
+
+// GetParticipation returns the participation of the user, it gets created if the user does not have one yet
+func (u *UserData) GetParticipation() *Participation {
+	if u.Participation == nil {
+		u.Participation = &Participation{}
+	}
+	if u.Participation.Channels == nil {
+		u.Participation.Channels = map[string]bool{}
+	}
+	return u.Participation
+}
+
+// ParseDuration parses durations like `90m`, `12h`, `3d` or `2w`
+func ParseDuration(durationStr string) (time.Duration, error) {
+	durationStr = strings.TrimSpace(durationStr)
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for unit, unitDuration := range units {
+		if strings.HasSuffix(durationStr, unit) {
+			value, err := strconv.Atoi(strings.TrimSuffix(durationStr, unit))
+			if err != nil || value <= 0 {
+				return 0, errors.Errorf("'%s' is not a valid duration", durationStr)
+			}
+			return time.Duration(value) * unitDuration, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("'%s' is not a valid duration", durationStr)
+	}
+	return duration, nil
+}
+
+// resumePausedUsers resumes the participation of all users of the given snapshot whose pause ended and lets them know about it
+func (p *Plugin) resumePausedUsers(data *LunchbotData, now time.Time) {
+	resumedUsers := []string{}
+	for userID, participation := range data.Participations {
+		if participation.PausedUntil == 0 || participation.IsPaused(now) {
+			continue
+		}
+		resumed := false
+		_, err := p.store.UpdateUserData(userID, func(userData *UserData) error {
+			//the user might have changed his pause in the meantime
+			resumed = userData.Participation != nil && userData.Participation.PausedUntil != 0 && !userData.Participation.IsPaused(now)
+			if resumed {
+				userData.Participation.PausedUntil = 0
+			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to resume paused user", "user_id", userID, "err", err.Error())
+			continue
+		}
+		if resumed {
+			resumedUsers = append(resumedUsers, userID)
+		}
+	}
+
+	for _, userID := range resumedUsers {
+		if err := p.SendDirectMessage("Welcome back! Your pause is over, you can get paired for lunch again :sunglasses:", userID); err != nil {
+			p.API.LogError("Failed to notify user about the end of his pause", "user_id", userID, "err", err.Error())
+		}
+	}
+}
+
+// GetParticipationStatusMsg returns a human readable description of the participation of the given user in the given channel
+func GetParticipationStatusMsg(userData *UserData, channelID string, now time.Time) string {
+	participation := userData.Participation
+	if participation == nil {
+		return fmt.Sprintf("You have not joined lunchbot yet. Use `/%s` to join.", commandLunchbotJoin)
+	}
+
+	message := ""
+	if participation.Joined {
+		message += "You take part in pairings in every channel.\n"
+	} else {
+		message += "You do not take part in pairings in general.\n"
+	}
+	if joined, ok := participation.Channels[channelID]; ok {
+		if joined {
+			message += "You joined the pairings of this channel.\n"
+		} else {
+			message += "You left the pairings of this channel.\n"
+		}
+	}
+	if participation.IsPaused(now) {
+		pausedUntil := time.Unix(0, participation.PausedUntil*int64(time.Millisecond))
+		message += fmt.Sprintf("Your participation is paused until %s.\n", pausedUntil.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if participation.Availability != nil {
+		message += fmt.Sprintf("You can get paired on %s in your timezone.\n", participation.Availability.String())
+	}
+	if participation.IsQueued(channelID) {
+		message += "You missed the last round of this channel and go first in its next round.\n"
+	}
+	if participation.IsParticipating(channelID, now) {
+		message += "You can currently get paired in this channel."
+	} else {
+		message += "You currently cannot get paired in this channel."
+	}
+	if len(userData.ActivePairingID) > 0 {
+		message += fmt.Sprintf("\nYou are in an active pairing, use `/%s` to finish it.", commandLunchbotFinish)
+	}
+	return message
+}
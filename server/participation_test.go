@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	duration, err := ParseDuration("3d")
+	assert.Nil(t, err)
+	assert.Equal(t, 3*24*time.Hour, duration)
+
+	duration, err = ParseDuration("2w")
+	assert.Nil(t, err)
+	assert.Equal(t, 14*24*time.Hour, duration)
+
+	duration, err = ParseDuration("90m")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Minute, duration)
+
+	_, err = ParseDuration("forever")
+	assert.NotNil(t, err)
+	_, err = ParseDuration("-1d")
+	assert.NotNil(t, err)
+}
+
+func TestIsParticipating(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+	data := &LunchbotData{
+		Participations: map[string]*Participation{
+			"global":      &Participation{Joined: true},
+			"leftChannel": &Participation{Joined: true, Channels: map[string]bool{"channel": false}},
+			"oneChannel":  &Participation{Channels: map[string]bool{"channel": true}},
+			"paused":      &Participation{Joined: true, PausedUntil: now.Add(time.Hour).UnixNano() / int64(time.Millisecond)},
+			"pauseEnded":  &Participation{Joined: true, PausedUntil: now.Add(-time.Hour).UnixNano() / int64(time.Millisecond)},
+		},
+	}
+
+	assert.True(t, IsParticipating(data, "global", "channel", now))
+	assert.False(t, IsParticipating(data, "leftChannel", "channel", now))
+	assert.True(t, IsParticipating(data, "leftChannel", "otherChannel", now))
+	assert.True(t, IsParticipating(data, "oneChannel", "channel", now))
+	assert.False(t, IsParticipating(data, "oneChannel", "otherChannel", now))
+	assert.False(t, IsParticipating(data, "paused", "channel", now))
+	assert.True(t, IsParticipating(data, "pauseEnded", "channel", now))
+	assert.False(t, IsParticipating(data, "unknown", "channel", now))
+}
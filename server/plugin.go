@@ -22,36 +22,92 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// store persists the data of the plugin
+	store Store
+
+	// schedulerStop and schedulerDone are used to stop the background job that runs scheduled pairing rounds
+	schedulerStop chan struct{}
+	schedulerDone chan struct{}
 }
 
-//LunchbotData contains all data necessary to be stored for the Lunchbot Plugin
+//LunchbotData is a snapshot of all data stored by the Lunchbot Plugin. It is read at once for matching users,
+//changes are written to the single entities, see UserData, Pairing, Invitation, Schedule, ChannelConfig, CatalogueTopic and Question.
 type LunchbotData struct {
-	ActivePairings map[string]string              `json:"ActivePairings"` //Key: UserID, Value: UserID of the other paired user
-	LastPairings   map[string][]string            `json:"LastPairings"`   //Key: UserID, Value: Ordered list of users that this user has been paired with, most recent user is the latest pairing
+	Version        int                            `json:"Version"`        //Version of the data layout, used to migrate older data
+	Pairings       map[string]*Pairing            `json:"Pairings"`       //Key: PairingID, Value: The active pairing
+	ActivePairings map[string]string              `json:"ActivePairings"` //Key: UserID, Value: PairingID of the pairing the user is part of
+	LastPairings   map[string][]string            `json:"LastPairings"`   //Deprecated: replaced by History, only read to migrate old data
+	History        map[string][]*HistoryEntry     `json:"History"`        //Key: UserID, Value: Pairings and invitations of the user that are over, the most recent entry is the last one
 	UserTopics     map[string]map[string]struct{} `json:"UserTopics"`     //Key: UserID, Value: Set of topics a user is interested in
 	Blacklists     map[string]map[string]struct{} `json:"Blacklists"`     //Key: UserID, Value: Set of users that this user has blacklisted
+	Schedules      map[string]*Schedule           `json:"Schedules"`      //Key: ChannelID, Value: Schedule of the recurring pairing rounds in that channel
+	Participations map[string]*Participation      `json:"Participations"` //Key: UserID, Value: Whether and where the user wants to get paired
+	ChannelConfigs map[string]*ChannelConfig      `json:"ChannelConfigs"` //Key: ChannelID, Value: Lunchbot settings of that channel
+	TopicCatalogue map[string]*CatalogueTopic     `json:"TopicCatalogue"` //Key: Normalized topic, Value: Topic of the organisation-wide topic catalogue
+	Questions      map[string]*Question           `json:"Questions"`      //Key: QuestionID, Value: Icebreaker question added by an admin
+
+	Invitations        map[string]*Invitation `json:"Invitations"`        //Key: InvitationID, Value: Pairing that waits for the invited users to accept it
+	PendingInvitations map[string]string      `json:"PendingInvitations"` //Key: UserID, Value: InvitationID of the invitation the user is part of
+}
+
+// UserData contains all data that is stored for a single user
+type UserData struct {
+	ActivePairingID     string              `json:"ActivePairingID"`     //ID of the pairing the user is part of, empty if the user is not paired
+	PendingInvitationID string              `json:"PendingInvitationID"` //ID of the invitation the user is part of, empty if there is none
+	LastPairings        []string            `json:"LastPairings"`        //Deprecated: replaced by History, only read to migrate old data
+	History             []*HistoryEntry     `json:"History"`             //Pairings and invitations of the user that are over, the most recent entry is the last one
+	Topics              map[string]struct{} `json:"Topics"`              //Set of topics the user is interested in
+	Blacklist           map[string]struct{} `json:"Blacklist"`           //Set of users that this user has blacklisted
+	Participation       *Participation      `json:"Participation"`       //Whether and where the user wants to get paired, nil if the user never joined
+}
+
+// Pairing is a group of users that have been paired to get some lunch together
+type Pairing struct {
+	ID          string   `json:"ID"`
+	ChannelID   string   `json:"ChannelID"`   //Channel the pairing has been triggered in
+	UserIDs     []string `json:"UserIDs"`     //Members of the pairing
+	CreatedAt   int64    `json:"CreatedAt"`   //Unix timestamp in milliseconds
+	ExtendedAt  int64    `json:"ExtendedAt"`  //Unix timestamp in milliseconds of the last time a member extended the pairing, 0 if it has never been extended
+	WarningSent bool     `json:"WarningSent"` //True if the members have been notified that the pairing is about to expire
+	QuestionIDs []string `json:"QuestionIDs"` //Icebreaker questions that have been suggested to the members
 }
 
-//NumHistoryEntries is the number of last pairings per user that get stored in order to avoid pairing with the same users again and again
-const NumHistoryEntries int = 50
+const (
+	//DataVersion is the current version of the LunchbotData layout
+	DataVersion int = 1
+	//DefaultGroupSize is the number of users that get paired with each other when no group size is given
+	DefaultGroupSize int = 2
+	//MinGroupSize is the smallest allowed group size
+	MinGroupSize int = 2
+	//MaxGroupSize is the largest allowed group size
+	MaxGroupSize int = 6
+)
 
 // OnActivate is invoked when the plugin is activated.
 //
 // This demo implementation logs a message to the demo channel whenever the plugin is activated.
 // It also creates a demo bot account
 func (p *Plugin) OnActivate() error {
-	//init the rand
-	rand.Seed(1337)
+	//init the rand, rounds that have to be replayed use their own sources
+	rand.Seed(NewSeed())
 
 	//register all our commands
 	if err := p.registerCommands(); err != nil {
 		return errors.Wrap(err, "failed to register commands")
 	}
 
+	p.store = newKVStore(p.API)
+
+	//move data of older versions into the current storage layout
+	if err := p.store.Migrate(); err != nil {
+		return errors.Wrap(err, "failed to migrate data")
+	}
+
 	//make sure the bot exists
 	botID, ensureBotError := p.Helpers.EnsureBot(&model.Bot{
 		Username:    "lunchbot",
-		DisplayName: "LunchBot",
+		DisplayName: p.getConfiguration().BotDisplayName,
 		Description: "A bot to find random people to lunch with",
 	}, plugin.ProfileImagePath("/assets/together.png"))
 	if ensureBotError != nil {
@@ -59,6 +115,15 @@ func (p *Plugin) OnActivate() error {
 	}
 	p.botID = botID
 
+	//start the background job for the scheduled pairing rounds
+	p.startScheduler()
+
+	return nil
+}
+
+// OnDeactivate is invoked when the plugin is deactivated.
+func (p *Plugin) OnDeactivate() error {
+	p.stopScheduler()
 	return nil
 }
 
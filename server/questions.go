@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//numIcebreakerQuestions is the number of questions that get suggested to every new pairing
+	numIcebreakerQuestions = 2
+	//builtinQuestionPrefix is the prefix of the IDs of the built-in questions
+	builtinQuestionPrefix = "builtin-"
+)
+
+// Question is a conversation starter that gets suggested to paired users
+type Question struct {
+	ID        string `json:"ID"`
+	Category  string `json:"Category"`  //Category the question belongs to, e.g. food or travel
+	Text      string `json:"Text"`      //The question itself
+	CreatedAt int64  `json:"CreatedAt"` //Unix timestamp in milliseconds, 0 for built-in questions
+}
+
+// builtinQuestions are the questions that are always available, grouped by category
+var builtinQuestions = map[string][]string{
+	"food": {
+		"What is the best meal you have ever had?",
+		"Which dish could you eat every day?",
+		"What is your favourite place for lunch around here?",
+		"Do you like to cook? What is your signature dish?",
+		"Sweet or savoury breakfast?",
+	},
+	"hobbies": {
+		"What do you like to do on weekends?",
+		"Which hobby would you pick up if you had the time?",
+		"What is the last book you really enjoyed?",
+		"Which series or movie would you recommend to everyone?",
+		"Are you into any sports?",
+	},
+	"travel": {
+		"What is the most interesting place you have visited?",
+		"Where would you go if you could travel anywhere tomorrow?",
+		"Beach, mountains or city trip?",
+		"What is your favourite holiday memory?",
+		"Which place would you recommend to a first-time visitor of your hometown?",
+	},
+	"work": {
+		"What does a typical day at work look like for you?",
+		"What are you working on right now that you are excited about?",
+		"What was your first job?",
+		"Which skill would you like to learn next?",
+		"Who in the company has helped you the most?",
+	},
+	"fun": {
+		"If you could have any superpower, what would it be?",
+		"What is a fun fact about you that few people know?",
+		"Which fictional character would you like to meet for lunch?",
+		"What is the best piece of advice you have ever received?",
+		"Cats or dogs?",
+	},
+}
+
+// GetBuiltinQuestions returns the questions that are always available
+func GetBuiltinQuestions() []*Question {
+	questions := []*Question{}
+	for category, texts := range builtinQuestions {
+		for index, text := range texts {
+			questions = append(questions, &Question{
+				ID:       fmt.Sprintf("%s%s-%d", builtinQuestionPrefix, category, index+1),
+				Category: category,
+				Text:     text,
+			})
+		}
+	}
+	SortQuestions(questions)
+	return questions
+}
+
+// SortQuestions sorts the given questions by category, built-in questions come first within a category
+func SortQuestions(questions []*Question) {
+	sort.SliceStable(questions, func(i, j int) bool {
+		if questions[i].Category != questions[j].Category {
+			return questions[i].Category < questions[j].Category
+		}
+		if questions[i].CreatedAt != questions[j].CreatedAt {
+			return questions[i].CreatedAt < questions[j].CreatedAt
+		}
+		return questions[i].ID < questions[j].ID
+	})
+}
+
+// NormalizeCategory returns the given category in the form questions are stored with
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// PickQuestions returns up to count random questions. Questions that have been asked in the given histories less often are preferred,
+// so users do not get the same questions again until they have been asked all of them.
+func PickQuestions(questions []*Question, histories [][]*HistoryEntry, count int) []*Question {
+	askCounts := map[string]int{}
+	for _, history := range histories {
+		for _, entry := range history {
+			for _, questionID := range entry.QuestionIDs {
+				askCounts[questionID]++
+			}
+		}
+	}
+
+	candidates := make([]*Question, len(questions))
+	copy(candidates, questions)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return askCounts[candidates[i].ID] < askCounts[candidates[j].ID]
+	})
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	return candidates
+}
+
+// GetQuestionsMsg returns a message that suggests the given questions, nothing if there are no questions
+func GetQuestionsMsg(questions []*Question) string {
+	if len(questions) <= 0 {
+		return ""
+	}
+	message := "Need an icebreaker? You could start with:\n"
+	for _, question := range questions {
+		message += fmt.Sprintf("  - %s\n", question.Text)
+	}
+	return message
+}
+
+// GetQuestions returns the built-in questions and the questions added by admins
+func (p *Plugin) GetQuestions() ([]*Question, error) {
+	customQuestions, err := p.store.GetQuestions()
+	if err != nil {
+		return nil, err
+	}
+	questions := GetBuiltinQuestions()
+	for _, question := range customQuestions {
+		questions = append(questions, question)
+	}
+	SortQuestions(questions)
+	return questions, nil
+}
+
+// PickQuestionsForUsers returns random questions that the given users have not been asked in their earlier pairings
+func (p *Plugin) PickQuestionsForUsers(userIDs []string) ([]*Question, error) {
+	questions, err := p.GetQuestions()
+	if err != nil {
+		return nil, err
+	}
+	histories := [][]*HistoryEntry{}
+	for _, userID := range userIDs {
+		userData, err := p.store.GetUserData(userID)
+		if err != nil {
+			return nil, err
+		}
+		histories = append(histories, userData.History)
+	}
+	return PickQuestions(questions, histories, numIcebreakerQuestions), nil
+}
+
+// GetQuestionListMsg returns a message that lists all questions of the given category, or of every category if it is empty
+func (p *Plugin) GetQuestionListMsg(category string) (string, error) {
+	questions, err := p.GetQuestions()
+	if err != nil {
+		return "", err
+	}
+	category = NormalizeCategory(category)
+
+	message := ""
+	lastCategory := ""
+	for _, question := range questions {
+		if len(category) > 0 && question.Category != category {
+			continue
+		}
+		if question.Category != lastCategory {
+			message += fmt.Sprintf("%s:\n", strings.Title(question.Category))
+			lastCategory = question.Category
+		}
+		message += fmt.Sprintf("  - %s (`%s`)\n", question.Text, question.ID)
+	}
+	if len(message) <= 0 {
+		return "", errors.Errorf("there are no questions in the category '%s'", category)
+	}
+	return message, nil
+}
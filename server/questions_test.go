@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPickQuestions(t *testing.T) {
+	questions := GetBuiltinQuestions()
+	ids := map[string]struct{}{}
+	for _, question := range questions {
+		ids[question.ID] = struct{}{}
+	}
+	assert.Len(t, ids, len(questions))
+
+	questions = []*Question{{ID: "A"}, {ID: "B"}, {ID: "C"}}
+	histories := [][]*HistoryEntry{
+		{&HistoryEntry{QuestionIDs: []string{"A", "B"}}},
+		{&HistoryEntry{QuestionIDs: []string{"A"}}},
+	}
+	for i := 0; i < 20; i++ {
+		picked := PickQuestions(questions, histories, 2)
+		assert.Equal(t, []*Question{{ID: "C"}, {ID: "B"}}, picked)
+	}
+	assert.Len(t, PickQuestions(questions, nil, 5), 3)
+
+	assert.Empty(t, GetQuestionsMsg(nil))
+	assert.Equal(t, "Need an icebreaker? You could start with:\n  - Cats or dogs?\n", GetQuestionsMsg([]*Question{{Text: "Cats or dogs?"}}))
+}
+
+func TestExecuteCommandLunchbotAdminQuestions(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", mock.AnythingOfType("string"), model.PERMISSION_MANAGE_SYSTEM).Return(false)
+	plugin.SetAPI(api)
+	plugin.store = newMemoryStore(&LunchbotData{})
+	args := func(userID string, command string) *model.CommandArgs {
+		return &model.CommandArgs{UserId: userID, ChannelId: "channel", Command: "/" + command}
+	}
+
+	resp := plugin.executeCommandLunchbotAdminQuestionsAdd(args("1", commandLunchbotAdminQuestionsAdd+" food Pizza or pasta?"))
+	assert.Equal(t, "Error: Only system admins are allowed to manage the icebreaker questions", resp.Text)
+	resp = plugin.executeCommandLunchbotAdminQuestionsAdd(args("admin", commandLunchbotAdminQuestionsAdd+" Food"))
+	assert.Contains(t, resp.Text, "Please enter a category and a question")
+	resp = plugin.executeCommandLunchbotAdminQuestionsAdd(args("admin", commandLunchbotAdminQuestionsAdd+" Food Pizza or pasta?"))
+	assert.Equal(t, "Added the question 'Pizza or pasta?' to the category food", resp.Text)
+
+	questions, _ := plugin.store.GetQuestions()
+	assert.Len(t, questions, 1)
+	questionID := ""
+	for id := range questions {
+		questionID = id
+	}
+	resp = plugin.executeCommandLunchbotAdminQuestionsList(args("admin", commandLunchbotAdminQuestionsList+" food"))
+	assert.Contains(t, resp.Text, "Food:\n  - What is the best meal you have ever had? (`builtin-food-1`)\n")
+	assert.Contains(t, resp.Text, "  - Pizza or pasta? (`"+questionID+"`)\n")
+	resp = plugin.executeCommandLunchbotAdminQuestionsList(args("admin", commandLunchbotAdminQuestionsList+" gardening"))
+	assert.Equal(t, "Error: there are no questions in the category 'gardening'", resp.Text)
+
+	resp = plugin.executeCommandLunchbotAdminQuestionsRemove(args("admin", commandLunchbotAdminQuestionsRemove+" builtin-food-1"))
+	assert.Equal(t, "Error: Built-in questions cannot be removed", resp.Text)
+	resp = plugin.executeCommandLunchbotAdminQuestionsRemove(args("admin", commandLunchbotAdminQuestionsRemove+" "+questionID))
+	assert.Equal(t, "Removed the question 'Pizza or pasta?'", resp.Text)
+	questions, _ = plugin.store.GetQuestions()
+	assert.Empty(t, questions)
+}
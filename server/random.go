@@ -0,0 +1,83 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/mroth/weightedrand"
+)
+
+// NewSeed returns a random seed from the random source of the operating system
+func NewSeed() int64 {
+	var buffer [8]byte
+	if _, err := crand.Read(buffer[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(buffer[:]))
+}
+
+// NewRand returns a random source with the given seed. The same seed always results in the same sequence of random numbers.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// globalSource is a random source that draws from the global random source of math/rand, which gets seeded when the plugin is activated
+type globalSource struct{}
+
+func (globalSource) Int63() int64 {
+	return rand.Int63()
+}
+
+func (globalSource) Seed(seed int64) {
+	rand.Seed(seed)
+}
+
+// GlobalRand returns a random source that draws from the global one. It is used for choices that do not need to be replayed, like single pairings.
+func GlobalRand() *rand.Rand {
+	return rand.New(globalSource{})
+}
+
+// PickWeighted returns a random item of the given choices using the given random source, items with a higher weight are picked more likely.
+// If all weights are zero, every item is equally likely. The given choices must not be empty.
+func PickWeighted(rng *rand.Rand, choices []weightedrand.Choice) interface{} {
+	//the item is picked as if the choices were sorted stably by weight, so the same random source always picks the same item.
+	//Only the distinct weights are sorted, which is a lot faster for the many choices of large channels.
+	counts := map[uint]int{}
+	runningTotal := 0
+	for _, choice := range choices {
+		counts[choice.Weight]++
+		runningTotal += int(choice.Weight)
+	}
+	if runningTotal <= 0 {
+		return choices[rng.Intn(len(choices))].Item
+	}
+	weights := []uint{}
+	for weight := range counts {
+		weights = append(weights, weight)
+	}
+	sort.Slice(weights, func(i, j int) bool {
+		return weights[i] < weights[j]
+	})
+
+	target := rng.Intn(runningTotal) + 1
+	for _, weight := range weights {
+		if total := int(weight) * counts[weight]; target > total {
+			target -= total
+			continue
+		}
+		position := (target - 1) / int(weight)
+		for _, choice := range choices {
+			if choice.Weight != weight {
+				continue
+			}
+			if position <= 0 {
+				return choice.Item
+			}
+			position--
+		}
+	}
+	return choices[len(choices)-1].Item
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/mroth/weightedrand"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickWeighted(t *testing.T) {
+	choices := []weightedrand.Choice{
+		weightedrand.Choice{Item: "1", Weight: 1},
+		weightedrand.Choice{Item: "2", Weight: 0},
+		weightedrand.Choice{Item: "3", Weight: 100},
+	}
+
+	t.Run("Same seed picks the same items", func(t *testing.T) {
+		rng, otherRng := NewRand(42), NewRand(42)
+		for i := 0; i < 20; i++ {
+			assert.Equal(t, PickWeighted(rng, choices), PickWeighted(otherRng, choices))
+		}
+	})
+
+	t.Run("Items without weight are never picked", func(t *testing.T) {
+		rng := NewRand(1)
+		picked := map[interface{}]int{}
+		for i := 0; i < 1000; i++ {
+			picked[PickWeighted(rng, choices)]++
+		}
+		assert.Zero(t, picked["2"])
+		assert.Greater(t, picked["3"], picked["1"])
+	})
+
+	t.Run("All weights zero", func(t *testing.T) {
+		rng := NewRand(1)
+		picked := map[interface{}]int{}
+		for i := 0; i < 100; i++ {
+			picked[PickWeighted(rng, []weightedrand.Choice{{Item: "1"}, {Item: "2"}})]++
+		}
+		assert.Len(t, picked, 2)
+	})
+	t.Run("Picks the same items as sorting the choices stably", func(t *testing.T) {
+		//rounds that have been recorded before are replayed with the same picks
+		manyChoices := []weightedrand.Choice{}
+		for index := 0; index < 50; index++ {
+			manyChoices = append(manyChoices, weightedrand.Choice{Item: fmt.Sprint(index), Weight: uint((index * 7) % 5 * 10)})
+		}
+		pickSorted := func(rng *rand.Rand) interface{} {
+			sorted := make([]weightedrand.Choice, len(manyChoices))
+			copy(sorted, manyChoices)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return sorted[i].Weight < sorted[j].Weight
+			})
+			totals := make([]int, len(sorted))
+			runningTotal := 0
+			for index, choice := range sorted {
+				runningTotal += int(choice.Weight)
+				totals[index] = runningTotal
+			}
+			return sorted[sort.SearchInts(totals, rng.Intn(runningTotal)+1)].Item
+		}
+		rng, otherRng := NewRand(7), NewRand(7)
+		for i := 0; i < 1000; i++ {
+			assert.Equal(t, pickSorted(otherRng), PickWeighted(rng, manyChoices))
+		}
+	})
+}
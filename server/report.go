@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//defaultReportDays is the number of days a report covers when no date range is given
+	defaultReportDays = 30
+	//reportDateLayout is the layout of the dates of a report range
+	reportDateLayout = "2006-01-02"
+)
+
+// UserActivity summarizes the pairing activity of a single user
+type UserActivity struct {
+	UserID            string
+	Pairings          int //Number of pairings the user has been part of
+	DistinctPartners  int //Number of different users the user has been paired with
+	MissedInvitations int //Number of invitations the user did not accept
+}
+
+// AcceptanceRate returns the share of pairings the user took part in when he got picked, -1 if the user never got picked
+func (a *UserActivity) AcceptanceRate() float64 {
+	if a.Pairings+a.MissedInvitations <= 0 {
+		return -1
+	}
+	return float64(a.Pairings) / float64(a.Pairings+a.MissedInvitations)
+}
+
+// ParseReportRange parses the given dates (e.g. `2020-06-01`) into the range of a report. The end date is included in the range.
+// Without dates the range covers the last days up to today, a missing end date defaults to today.
+func ParseReportRange(params []string, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -defaultReportDays)
+	if len(params) > 2 {
+		return from, to, errors.New("please enter a start and an end date, e.g. 2020-06-01 2020-06-30")
+	}
+	if len(params) > 0 {
+		date, err := time.Parse(reportDateLayout, params[0])
+		if err != nil {
+			return from, to, errors.Errorf("'%s' is not a valid date, please use the format YYYY-MM-DD", params[0])
+		}
+		from = date
+	}
+	if len(params) > 1 {
+		date, err := time.Parse(reportDateLayout, params[1])
+		if err != nil {
+			return from, to, errors.Errorf("'%s' is not a valid date, please use the format YYYY-MM-DD", params[1])
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("the start date must be before the end date")
+	}
+	return from, to, nil
+}
+
+// CollectHistoryEntries returns the given logged entries that ended within the given range, ordered by the time they ended
+func CollectHistoryEntries(log []*HistoryEntry, from time.Time, to time.Time) []*HistoryEntry {
+	fromMillis := from.UnixNano() / int64(time.Millisecond)
+	toMillis := to.UnixNano() / int64(time.Millisecond)
+
+	entries := []*HistoryEntry{}
+	for _, entry := range log {
+		if entry.FinishedAt >= fromMillis && entry.FinishedAt < toMillis {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].FinishedAt == entries[j].FinishedAt {
+			return entries[i].PairingID < entries[j].PairingID
+		}
+		return entries[i].FinishedAt < entries[j].FinishedAt
+	})
+	return entries
+}
+
+// GetUserActivities summarizes the given history entries per user, ordered by user ID
+func GetUserActivities(entries []*HistoryEntry) []*UserActivity {
+	activities := map[string]*UserActivity{}
+	partners := map[string]map[string]struct{}{}
+	getActivity := func(userID string) *UserActivity {
+		if _, ok := activities[userID]; !ok {
+			activities[userID] = &UserActivity{UserID: userID}
+			partners[userID] = map[string]struct{}{}
+		}
+		return activities[userID]
+	}
+
+	for _, entry := range entries {
+		for _, userID := range entry.UserIDs {
+			activity := getActivity(userID)
+			if entry.Invitation {
+				if !ContainsString(entry.AcceptedUserIDs, userID) {
+					activity.MissedInvitations++
+				}
+				continue
+			}
+			activity.Pairings++
+			for _, partnerID := range entry.UserIDs {
+				if partnerID != userID {
+					partners[userID][partnerID] = struct{}{}
+				}
+			}
+		}
+	}
+
+	result := []*UserActivity{}
+	for userID, activity := range activities {
+		activity.DistinctPartners = len(partners[userID])
+		result = append(result, activity)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UserID < result[j].UserID
+	})
+	return result
+}
+
+// BuildPairingsCSV returns a CSV with a row for every given history entry. Users and channels are written with the names returned by the given functions.
+func BuildPairingsCSV(entries []*HistoryEntry, getUsername func(userID string) string, getChannelName func(channelID string) string) ([]byte, error) {
+	formatMillis := func(millis int64) string {
+		if millis <= 0 {
+			return ""
+		}
+		return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+	}
+
+	rows := [][]string{{"id", "type", "members", "channel", "created_at", "finished_at", "outcome"}}
+	for _, entry := range entries {
+		kind := "pairing"
+		if entry.Invitation {
+			kind = "invitation"
+		}
+		members := []string{}
+		for _, userID := range entry.UserIDs {
+			members = append(members, getUsername(userID))
+		}
+		rows = append(rows, []string{
+			entry.PairingID,
+			kind,
+			strings.Join(members, " "),
+			getChannelName(entry.ChannelID),
+			formatMillis(entry.CreatedAt),
+			formatMillis(entry.FinishedAt),
+			entry.Outcome,
+		})
+	}
+	return writeCSV(rows)
+}
+
+// BuildUserSummaryCSV returns a CSV with a row for the activity of every given user. Users are written with the names returned by the given function.
+func BuildUserSummaryCSV(activities []*UserActivity, getUsername func(userID string) string) ([]byte, error) {
+	rows := [][]string{{"user_id", "username", "pairings", "distinct_partners", "missed_invitations", "acceptance_rate"}}
+	for _, activity := range activities {
+		acceptanceRate := ""
+		if rate := activity.AcceptanceRate(); rate >= 0 {
+			acceptanceRate = strconv.FormatFloat(rate, 'f', 2, 64)
+		}
+		rows = append(rows, []string{
+			activity.UserID,
+			getUsername(activity.UserID),
+			strconv.Itoa(activity.Pairings),
+			strconv.Itoa(activity.DistinctPartners),
+			strconv.Itoa(activity.MissedInvitations),
+			acceptanceRate,
+		})
+	}
+	return writeCSV(rows)
+}
+
+// writeCSV encodes the given rows as CSV
+func writeCSV(rows [][]string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, errors.Wrap(err, "failed to write CSV")
+	}
+	return buffer.Bytes(), nil
+}
+
+// SendReport sends CSV reports of the pairing activity within the given range to the given user as file attachments of a direct message
+func (p *Plugin) SendReport(userID string, from time.Time, to time.Time) error {
+	log, err := p.store.GetPairingLog(from, to)
+	if err != nil {
+		return err
+	}
+	entries := CollectHistoryEntries(log, from, to)
+
+	usernames := map[string]string{}
+	getUsername := func(userID string) string {
+		if _, ok := usernames[userID]; !ok {
+			usernames[userID] = userID
+			if user, appErr := p.API.GetUser(userID); appErr == nil {
+				usernames[userID] = user.Username
+			}
+		}
+		return usernames[userID]
+	}
+	channelNames := map[string]string{}
+	getChannelName := func(channelID string) string {
+		if _, ok := channelNames[channelID]; !ok {
+			channelNames[channelID] = channelID
+			if len(channelID) > 0 {
+				if channel, appErr := p.API.GetChannel(channelID); appErr == nil {
+					channelNames[channelID] = channel.Name
+				}
+			}
+		}
+		return channelNames[channelID]
+	}
+
+	pairingsCSV, err := BuildPairingsCSV(entries, getUsername, getChannelName)
+	if err != nil {
+		return err
+	}
+	summaryCSV, err := BuildUserSummaryCSV(GetUserActivities(entries), getUsername)
+	if err != nil {
+		return err
+	}
+
+	lastDay := to.AddDate(0, 0, -1)
+	suffix := fmt.Sprintf("%s-%s.csv", from.Format(reportDateLayout), lastDay.Format(reportDateLayout))
+	message := fmt.Sprintf("Here is the lunchbot report from %s to %s with %d pairings and invitations.", from.Format(reportDateLayout), lastDay.Format(reportDateLayout), len(entries))
+	return p.SendDirectMessageWithFiles(message, userID, map[string][]byte{
+		"lunchbot-pairings-" + suffix: pairingsCSV,
+		"lunchbot-users-" + suffix:    summaryCSV,
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReportRange(t *testing.T) {
+	now := time.Date(2020, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	from, to, err := ParseReportRange(nil, now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.May, 17, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2020, time.June, 16, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = ParseReportRange([]string{"2020-06-01", "2020-06-30"}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = ParseReportRange([]string{"yesterday"}, now)
+	assert.NotNil(t, err)
+	_, _, err = ParseReportRange([]string{"2020-06-30", "2020-06-01"}, now)
+	assert.NotNil(t, err)
+}
+
+func TestReportCSVs(t *testing.T) {
+	day := func(d int) int64 {
+		return time.Date(2020, time.June, d, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	}
+	pairing := &HistoryEntry{PairingID: "A", ChannelID: "channel", UserIDs: []string{"1", "2"}, CreatedAt: day(1), FinishedAt: day(2), Outcome: OutcomeFinished}
+	invitation := &HistoryEntry{PairingID: "B", ChannelID: "channel", UserIDs: []string{"1", "3"}, CreatedAt: day(3), FinishedAt: day(3), Outcome: OutcomeDeclined, Invitation: true, AcceptedUserIDs: []string{"1"}}
+	log := []*HistoryEntry{
+		&HistoryEntry{PairingID: "C", UserIDs: []string{"1", "3"}, FinishedAt: day(20), Outcome: OutcomeFinished},
+		invitation,
+		pairing,
+	}
+
+	entries := CollectHistoryEntries(log, time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, time.June, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, []*HistoryEntry{pairing, invitation}, entries)
+
+	getName := func(id string) string {
+		return "name" + id
+	}
+	pairingsCSV, err := BuildPairingsCSV(entries, getName, getName)
+	assert.Nil(t, err)
+	assert.Equal(t, "id,type,members,channel,created_at,finished_at,outcome\n"+
+		"A,pairing,name1 name2,namechannel,2020-06-01T12:00:00Z,2020-06-02T12:00:00Z,finished\n"+
+		"B,invitation,name1 name3,namechannel,2020-06-03T12:00:00Z,2020-06-03T12:00:00Z,declined\n", string(pairingsCSV))
+
+	summaryCSV, err := BuildUserSummaryCSV(GetUserActivities(entries), getName)
+	assert.Nil(t, err)
+	assert.Equal(t, "user_id,username,pairings,distinct_partners,missed_invitations,acceptance_rate\n"+
+		"1,name1,1,1,0,1.00\n"+
+		"2,name2,1,1,0,1.00\n"+
+		"3,name3,0,0,1,0.00\n", string(summaryCSV))
+}
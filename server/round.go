@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	//roundRetention is how long the records of pairing rounds are kept
+	roundRetention = 90 * 24 * time.Hour
+	//numListedRounds is the number of recent rounds that are listed when no round is given to replay
+	numListedRounds = 10
+)
+
+// Round records a scheduled or batch pairing round of a channel, so it can be replayed when someone disputes its outcome
+type Round struct {
+	ID        string      `json:"ID"`
+	ChannelID string      `json:"ChannelID"`
+	CreatorID string      `json:"CreatorID"` //User that started the round, empty for scheduled rounds
+	CreatedAt int64       `json:"CreatedAt"` //Unix timestamp in milliseconds
+	Seed      int64       `json:"Seed"`      //Seed of the random source the groups have been chosen with
+	GroupSize int         `json:"GroupSize"`
+	Input     *RoundInput `json:"Input"`     //Everything the groups have been chosen from
+	Groups    [][]string  `json:"Groups"`    //User IDs of the matched groups
+	Unmatched []string    `json:"Unmatched"` //User IDs of the users that could not be matched with anyone
+}
+
+// RoundInput is a snapshot of the data that influenced the matching of a round. Only the data of the eligible users is contained.
+type RoundInput struct {
+	Strategy              string              `json:"Strategy"`             //Name of the match strategy, empty for the default strategy
+	UserIDs               []string            `json:"UserIDs"`              //Eligible users in the order they have been matched from
+	QueuedUserIDs         []string            `json:"QueuedUserIDs"`        //Users that went first because they missed the previous round
+	Priorities            map[string]int      `json:"Priorities,omitempty"` //Key: UserID, Value: fairness priority of users that have been waiting for a pairing
+	Departments           Departments         `json:"Departments"`
+	LastPartners          map[string][]string `json:"LastPartners"` //Key: UserID, Value: recent partners of the user, the oldest first
+	Topics                map[string][]string `json:"Topics"`
+	Blacklists            map[string][]string `json:"Blacklists"` //Only contains blacklisted users that have been eligible as well
+	NewUserWeight         int                 `json:"NewUserWeight"`
+	SharedTopicWeight     int                 `json:"SharedTopicWeight"`
+	CrossDepartmentWeight int                 `json:"CrossDepartmentWeight"`
+}
+
+// NewRoundInput takes a snapshot of everything that influences how the given users get matched with the given strategy
+func NewRoundInput(ctx *MatchContext, strategy string, users []*model.User, queued map[string]struct{}) *RoundInput {
+	config, data, departments := ctx.Config, ctx.Data, ctx.Departments
+	input := &RoundInput{
+		Strategy:              strategy,
+		UserIDs:               []string{},
+		QueuedUserIDs:         []string{},
+		Priorities:            map[string]int{},
+		Departments:           Departments{},
+		LastPartners:          map[string][]string{},
+		Topics:                map[string][]string{},
+		Blacklists:            map[string][]string{},
+		NewUserWeight:         config.NewUserWeight,
+		SharedTopicWeight:     config.SharedTopicWeight,
+		CrossDepartmentWeight: config.CrossDepartmentWeight,
+	}
+	eligible := map[string]struct{}{}
+	for _, user := range users {
+		eligible[user.Id] = struct{}{}
+	}
+	for _, user := range users {
+		input.UserIDs = append(input.UserIDs, user.Id)
+		if _, ok := queued[user.Id]; ok {
+			input.QueuedUserIDs = append(input.QueuedUserIDs, user.Id)
+		}
+		if priority, ok := ctx.Priorities[user.Id]; ok {
+			input.Priorities[user.Id] = priority
+		}
+		if userDepartments, ok := departments[user.Id]; ok {
+			input.Departments[user.Id] = userDepartments
+		}
+		if partners := GetLastPartners(data.History[user.Id], user.Id); len(partners) > 0 {
+			input.LastPartners[user.Id] = partners
+		}
+		for topic := range data.UserTopics[user.Id] {
+			input.Topics[user.Id] = append(input.Topics[user.Id], topic)
+		}
+		sort.Strings(input.Topics[user.Id])
+		for blacklistedID := range data.Blacklists[user.Id] {
+			if _, ok := eligible[blacklistedID]; ok {
+				input.Blacklists[user.Id] = append(input.Blacklists[user.Id], blacklistedID)
+			}
+		}
+		sort.Strings(input.Blacklists[user.Id])
+	}
+	return input
+}
+
+// Match matches the users of the input with its strategy and a random source of the given seed, exactly like MatchUsers did when the snapshot was taken
+func (i *RoundInput) Match(seed int64, groupSize int) ([][]string, []string) {
+	config := newConfiguration()
+	config.NewUserWeight = i.NewUserWeight
+	config.SharedTopicWeight = i.SharedTopicWeight
+	config.CrossDepartmentWeight = i.CrossDepartmentWeight
+
+	data := &LunchbotData{
+		History:    map[string][]*HistoryEntry{},
+		UserTopics: map[string]map[string]struct{}{},
+		Blacklists: map[string]map[string]struct{}{},
+	}
+	for userID, partners := range i.LastPartners {
+		for _, partnerID := range partners {
+			data.History[userID] = append(data.History[userID], &HistoryEntry{UserIDs: []string{userID, partnerID}, Outcome: OutcomeFinished})
+		}
+	}
+	for userID, topics := range i.Topics {
+		data.UserTopics[userID] = map[string]struct{}{}
+		for _, topic := range topics {
+			data.UserTopics[userID][topic] = struct{}{}
+		}
+	}
+	for userID, blacklist := range i.Blacklists {
+		data.Blacklists[userID] = map[string]struct{}{}
+		for _, blacklistedID := range blacklist {
+			data.Blacklists[userID][blacklistedID] = struct{}{}
+		}
+	}
+	users := []*model.User{}
+	for _, userID := range i.UserIDs {
+		users = append(users, &model.User{Id: userID})
+	}
+	queued := map[string]struct{}{}
+	for _, userID := range i.QueuedUserIDs {
+		queued[userID] = struct{}{}
+	}
+
+	ctx := &MatchContext{
+		Config:      config,
+		Data:        data,
+		Departments: i.Departments,
+		Rand:        NewRand(seed),
+		Priorities:  i.Priorities,
+	}
+	groups, unmatched := MatchUsers(ctx, NewMatcher(GetMatchStrategy(i.Strategy)), users, groupSize, queued)
+	return GetGroupUserIDs(groups), GetUserIDList(unmatched)
+}
+
+// GetUserIDList returns the IDs of the given users
+func GetUserIDList(users []*model.User) []string {
+	userIDs := []string{}
+	for _, user := range users {
+		userIDs = append(userIDs, user.Id)
+	}
+	return userIDs
+}
+
+// GetGroupUserIDs returns the IDs of the members of the given groups
+func GetGroupUserIDs(groups [][]*model.User) [][]string {
+	groupIDs := [][]string{}
+	for _, group := range groups {
+		groupIDs = append(groupIDs, GetUserIDList(group))
+	}
+	return groupIDs
+}
+
+// Replay matches the users of the round again with its recorded seed. Returns an error if the outcome differs from the recorded one.
+func (r *Round) Replay() ([][]string, []string, error) {
+	if r.Input == nil {
+		return nil, nil, errors.New("the round did not record its input")
+	}
+	groups, unmatched := r.Input.Match(r.Seed, r.GroupSize)
+	if fmt.Sprint(groups) != fmt.Sprint(r.Groups) || fmt.Sprint(unmatched) != fmt.Sprint(r.Unmatched) {
+		return groups, unmatched, errors.New("the replay resulted in different groups than the recorded ones")
+	}
+	return groups, unmatched, nil
+}
+
+// GetRoundsMsg returns a message that lists the given rounds, the most recent first
+func GetRoundsMsg(rounds []*Round) string {
+	if len(rounds) <= 0 {
+		return "There have not been any recorded pairing rounds in this channel yet."
+	}
+	sort.Slice(rounds, func(i, j int) bool {
+		return rounds[i].CreatedAt > rounds[j].CreatedAt
+	})
+	if len(rounds) > numListedRounds {
+		rounds = rounds[:numListedRounds]
+	}
+	message := fmt.Sprintf("Recent pairing rounds of this channel, use `/%s <round ID>` to replay one:\n", commandLunchbotAdminReplay)
+	for _, round := range rounds {
+		kind := "scheduled"
+		if len(round.CreatorID) > 0 {
+			kind = "manual"
+		}
+		createdAt := time.Unix(0, round.CreatedAt*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04 MST")
+		message += fmt.Sprintf("  - `%s`: %s, %s round with %d groups, seed %d\n", round.ID, createdAt, kind, len(round.Groups), round.Seed)
+	}
+	return message
+}
+
+// GetReplayMsg replays the given round and returns a message that explains how its groups have been chosen.
+// Users are written with the names returned by the given function.
+func GetReplayMsg(round *Round, getUsername func(userID string) string) string {
+	formatUsers := func(userIDs []string) string {
+		names := []string{}
+		for _, userID := range userIDs {
+			names = append(names, "@"+getUsername(userID))
+		}
+		return strings.Join(names, ", ")
+	}
+
+	groups, unmatched, err := round.Replay()
+	if groups == nil {
+		return fmt.Sprintf("Error: Cannot replay round `%s`: %s", round.ID, err.Error())
+	}
+
+	createdAt := time.Unix(0, round.CreatedAt*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04 MST")
+	message := fmt.Sprintf("Round `%s` from %s matched %d eligible users into groups of %d using seed %d.\n", round.ID, createdAt, len(round.Input.UserIDs), round.GroupSize, round.Seed)
+	if len(round.Input.QueuedUserIDs) > 0 {
+		message += fmt.Sprintf("These users went first because they missed the previous round: %s\n", formatUsers(round.Input.QueuedUserIDs))
+	}
+	if len(round.Input.Priorities) > 0 {
+		prioritized := []string{}
+		for _, userID := range round.Input.UserIDs {
+			if _, ok := round.Input.Priorities[userID]; ok {
+				prioritized = append(prioritized, userID)
+			}
+		}
+		message += fmt.Sprintf("These users were preferred because they have been waiting for a pairing: %s\n", formatUsers(prioritized))
+	}
+	if err != nil {
+		message += fmt.Sprintf("Warning: %s.\nRecorded groups:\n", err.Error())
+		for _, group := range round.Groups {
+			message += fmt.Sprintf("  - %s\n", formatUsers(group))
+		}
+		message += "Replayed groups:\n"
+	} else {
+		message += "Replaying the round with its seed results in the same groups:\n"
+	}
+	for _, group := range groups {
+		message += fmt.Sprintf("  - %s\n", formatUsers(group))
+	}
+	if len(unmatched) > 0 {
+		message += fmt.Sprintf("Could not find a partner for %s.\n", formatUsers(unmatched))
+	}
+	return message
+}
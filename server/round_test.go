@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// getRoundTestData returns users and data with history, topics, departments and blacklists, so every part of a round input is used
+func getRoundTestData() ([]*model.User, *LunchbotData, Departments) {
+	users := []*model.User{}
+	for _, userID := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+		users = append(users, &model.User{Id: userID, Username: "user" + userID})
+	}
+	data := &LunchbotData{
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"1", "2"}, Outcome: OutcomeFinished}},
+			"2": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"1", "2"}, Outcome: OutcomeFinished}},
+		},
+		UserTopics: map[string]map[string]struct{}{
+			"3": map[string]struct{}{"Cooking": struct{}{}},
+			"4": map[string]struct{}{"Cooking": struct{}{}, "Hiking": struct{}{}},
+		},
+		Blacklists: map[string]map[string]struct{}{
+			"5": map[string]struct{}{"6": struct{}{}, "someone else": struct{}{}},
+		},
+	}
+	departments := Departments{"1": []string{"Sales"}, "3": []string{"Finance"}}
+	return users, data, departments
+}
+
+func TestNewRoundInput(t *testing.T) {
+	users, data, departments := getRoundTestData()
+	input := NewRoundInput(newTestMatchContext(data, departments, 0), MatchStrategyWeightedRandom, users, map[string]struct{}{"7": struct{}{}})
+
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7"}, input.UserIDs)
+	assert.Equal(t, MatchStrategyWeightedRandom, input.Strategy)
+	assert.Equal(t, []string{"7"}, input.QueuedUserIDs)
+	assert.Equal(t, departments, input.Departments)
+	assert.Equal(t, map[string][]string{"1": []string{"2"}, "2": []string{"1"}}, input.LastPartners)
+	assert.Equal(t, map[string][]string{"3": []string{"Cooking"}, "4": []string{"Cooking", "Hiking"}}, input.Topics)
+	//users that have not been eligible do not influence the round
+	assert.Equal(t, map[string][]string{"5": []string{"6"}}, input.Blacklists)
+}
+
+func TestRoundInputMatch(t *testing.T) {
+	users, data, departments := getRoundTestData()
+	queued := map[string]struct{}{"7": struct{}{}}
+	priorities := map[string]int{"6": 2, "3": 1}
+
+	for _, strategy := range GetMatchStrategyNames() {
+		ctx := newTestMatchContext(data, departments, 0)
+		ctx.Priorities = priorities
+		input := NewRoundInput(ctx, strategy, users, queued)
+		assert.Equal(t, priorities, input.Priorities)
+		for seed := int64(0); seed < 20; seed++ {
+			ctx = newTestMatchContext(data, departments, seed)
+			ctx.Priorities = priorities
+			groups, unmatched := MatchUsers(ctx, NewMatcher(GetMatchStrategy(strategy)), users, 2, queued)
+			replayedGroups, replayedUnmatched := input.Match(seed, 2)
+			assert.Equal(t, GetGroupUserIDs(groups), replayedGroups)
+			assert.Equal(t, GetUserIDList(unmatched), replayedUnmatched)
+		}
+	}
+}
+
+func TestRoundReplay(t *testing.T) {
+	users, data, departments := getRoundTestData()
+	input := NewRoundInput(newTestMatchContext(data, departments, 0), MatchStrategyWeightedRandom, users, nil)
+	groups, unmatched := input.Match(1337, 2)
+	round := &Round{ID: "round", ChannelID: "channel", Seed: 1337, GroupSize: 2, Input: input, Groups: groups, Unmatched: unmatched}
+
+	replayedGroups, _, err := round.Replay()
+	assert.Nil(t, err)
+	assert.Equal(t, groups, replayedGroups)
+	message := GetReplayMsg(round, func(userID string) string { return "user" + userID })
+	assert.Contains(t, message, "using seed 1337")
+	assert.Contains(t, message, "results in the same groups")
+
+	round.Groups = [][]string{[]string{"1", "2"}}
+	_, _, err = round.Replay()
+	assert.NotNil(t, err)
+	message = GetReplayMsg(round, func(userID string) string { return "user" + userID })
+	assert.Contains(t, message, "Warning: the replay resulted in different groups")
+	assert.Contains(t, message, "@user1, @user2")
+
+	round.Input = nil
+	_, _, err = round.Replay()
+	assert.NotNil(t, err)
+	assert.Contains(t, GetReplayMsg(round, func(userID string) string { return userID }), "Error: Cannot replay round")
+}
+
+func TestGetRoundsMsg(t *testing.T) {
+	assert.Equal(t, "There have not been any recorded pairing rounds in this channel yet.", GetRoundsMsg(nil))
+
+	rounds := []*Round{
+		&Round{ID: "older", CreatedAt: 1000, Seed: 1, Groups: [][]string{[]string{"1", "2"}}},
+		&Round{ID: "newer", CreatorID: "admin", CreatedAt: 2000, Seed: 2},
+	}
+	message := GetRoundsMsg(rounds)
+	assert.Contains(t, message, "`older`: 1970-01-01 00:00 UTC, scheduled round with 1 groups, seed 1")
+	assert.Contains(t, message, "`newer`: 1970-01-01 00:00 UTC, manual round with 0 groups, seed 2")
+	assert.Less(t, strings.Index(message, "newer"), strings.Index(message, "older"))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Schedule describes a recurring pairing round of a channel
+type Schedule struct {
+	ChannelID string       `json:"ChannelID"`
+	CreatorID string       `json:"CreatorID"`
+	Weekday   time.Weekday `json:"Weekday"`
+	Hour      int          `json:"Hour"`
+	Minute    int          `json:"Minute"`
+	Timezone  string       `json:"Timezone"`  //IANA name of the timezone the schedule is defined in, e.g. `Europe/Berlin`
+	GroupSize int          `json:"GroupSize"` //Number of users per group, the default group size is used if this is not set
+	LastRun   int64        `json:"LastRun"`   //Unix timestamp in milliseconds of the last occurrence that has been run
+}
+
+// ParseWeekday parses a weekday like `monday` or `mon`
+func ParseWeekday(weekdayStr string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), weekdayStr) || strings.EqualFold(day.String()[:3], weekdayStr) {
+			return day, nil
+		}
+	}
+	return time.Sunday, errors.Errorf("'%s' is not a valid weekday", weekdayStr)
+}
+
+// ParseTimeOfDay parses a time of day like `10:00` into its hour and minute
+func ParseTimeOfDay(timeStr string) (int, int, error) {
+	timeParts := strings.Split(timeStr, ":")
+	if len(timeParts) != 2 {
+		return 0, 0, errors.Errorf("'%s' is not a valid time, please use the format HH:MM", timeStr)
+	}
+	hour, err := strconv.Atoi(timeParts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, errors.Errorf("'%s' is not a valid time, please use the format HH:MM", timeStr)
+	}
+	minute, err := strconv.Atoi(timeParts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, errors.Errorf("'%s' is not a valid time, please use the format HH:MM", timeStr)
+	}
+	return hour, minute, nil
+}
+
+// ParseSchedule creates a schedule from the given weekday (e.g. `monday`), time of day (e.g. `10:00`) and timezone
+func ParseSchedule(weekdayStr string, timeStr string, timezone string) (*Schedule, error) {
+	weekday, err := ParseWeekday(weekdayStr)
+	if err != nil {
+		return nil, err
+	}
+	hour, minute, err := ParseTimeOfDay(timeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, errors.Errorf("'%s' is not a valid timezone", timezone)
+	}
+
+	return &Schedule{
+		Weekday:  weekday,
+		Hour:     hour,
+		Minute:   minute,
+		Timezone: timezone,
+	}, nil
+}
+
+// LastOccurrence returns the most recent point in time before or at now at which the schedule should have been run
+func (s *Schedule) LastOccurrence(now time.Time) time.Time {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	now = now.In(location)
+
+	occurrence := time.Date(now.Year(), now.Month(), now.Day(), s.Hour, s.Minute, 0, 0, location)
+	daysSince := (int(now.Weekday()) - int(s.Weekday) + 7) % 7
+	occurrence = occurrence.AddDate(0, 0, -daysSince)
+	if occurrence.After(now) {
+		occurrence = occurrence.AddDate(0, 0, -7)
+	}
+	return occurrence
+}
+
+// IsDue returns true if there is an occurrence of the schedule that has not been run yet
+func (s *Schedule) IsDue(now time.Time) bool {
+	return s.LastOccurrence(now).UnixNano()/int64(time.Millisecond) > s.LastRun
+}
+
+// String returns a human readable description of the schedule
+func (s *Schedule) String() string {
+	return fmt.Sprintf("every %s at %02d:%02d (%s) in groups of %d", s.Weekday, s.Hour, s.Minute, s.Timezone, s.GroupSize)
+}
+
+// runScheduledRounds runs the pairing round of every channel of the given snapshot whose schedule is due
+func (p *Plugin) runScheduledRounds(data *LunchbotData, now time.Time) {
+	dueSchedules := []*Schedule{}
+	for channelID, schedule := range data.Schedules {
+		if !schedule.IsDue(now) {
+			continue
+		}
+		due := false
+		updatedSchedule, err := p.store.UpdateSchedule(channelID, func(schedule *Schedule) error {
+			//mark the schedule as run before actually running it, a failing round should not be retried every minute
+			due = schedule.IsDue(now)
+			if due {
+				schedule.LastRun = schedule.LastOccurrence(now).UnixNano() / int64(time.Millisecond)
+			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to update schedule", "channel_id", channelID, "err", err.Error())
+			continue
+		}
+		if due && updatedSchedule != nil {
+			dueSchedules = append(dueSchedules, updatedSchedule)
+		}
+	}
+
+	for _, schedule := range dueSchedules {
+		if _, err := p.RunPairingRound(schedule.ChannelID, schedule.GroupSize, ""); err != nil {
+			p.API.LogError("Failed to run scheduled pairing round", "channel_id", schedule.ChannelID, "err", err.Error())
+		}
+	}
+}
+
+// RunPairingRound splits every available member of the given channel into groups of the given size and notifies the groups via group messages.
+// Members that are not available get queued for the next round, if configured. Members that are left out gain priority for the next rounds. The round is recorded with the given creator, who is empty for scheduled rounds.
+// Returns the result of the matching. If some of the groups cannot be started, the other groups are started anyway and the result is returned together with an error.
+func (p *Plugin) RunPairingRound(channelID string, groupSize int, creatorID string) (*MatchResult, error) {
+	result, err := p.MatchChannel(channelID, groupSize, NewSeed())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to match the users of the channel")
+	}
+	result.Round.CreatorID = creatorID
+	if err := p.store.SaveRound(result.Round); err != nil {
+		p.API.LogError("Failed to record the pairing round", "channel_id", channelID, "err", err.Error())
+	}
+
+	//a group that cannot be started does not keep the other groups from getting started
+	failures := []string{}
+	for _, group := range result.Groups {
+		if resp := p.StartPairing(channelID, group); resp != nil {
+			p.API.LogError("Failed to start pairing of round", "channel_id", channelID, "round_id", result.Round.ID, "user_ids", strings.Join(GetUserIDList(group), ","), "err", resp.Text)
+			failures = append(failures, resp.Text)
+		}
+	}
+	p.QueueUsers(channelID, result.Unavailable, time.Now())
+	p.RecordSkippedUsers(append(append([]*model.User{}, result.Unmatched...), result.Unavailable...))
+
+	if len(failures) > 0 {
+		return result, errors.Errorf("failed to start %d of %d groups: %s", len(failures), len(result.Groups), strings.Join(failures, "; "))
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseSchedule(t *testing.T) {
+	t.Run("Valid schedule", func(t *testing.T) {
+		schedule, err := ParseSchedule("Monday", "10:30", "Europe/Berlin")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Monday, schedule.Weekday)
+		assert.Equal(t, 10, schedule.Hour)
+		assert.Equal(t, 30, schedule.Minute)
+		assert.Equal(t, "Europe/Berlin", schedule.Timezone)
+	})
+
+	t.Run("Short weekday", func(t *testing.T) {
+		schedule, err := ParseSchedule("fri", "12:00", "UTC")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Friday, schedule.Weekday)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		_, err := ParseSchedule("someday", "10:00", "UTC")
+		assert.NotNil(t, err)
+		_, err = ParseSchedule("monday", "25:00", "UTC")
+		assert.NotNil(t, err)
+		_, err = ParseSchedule("monday", "10", "UTC")
+		assert.NotNil(t, err)
+		_, err = ParseSchedule("monday", "10:00", "Nowhere/Somewhere")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestScheduleLastOccurrence(t *testing.T) {
+	schedule, _ := ParseSchedule("monday", "10:00", "UTC")
+
+	t.Run("Before the occurrence on the same day", func(t *testing.T) {
+		now := time.Date(2020, time.June, 1, 9, 0, 0, 0, time.UTC) //a monday
+		assert.Equal(t, time.Date(2020, time.May, 25, 10, 0, 0, 0, time.UTC), schedule.LastOccurrence(now))
+	})
+
+	t.Run("After the occurrence on the same day", func(t *testing.T) {
+		now := time.Date(2020, time.June, 1, 11, 0, 0, 0, time.UTC)
+		assert.Equal(t, time.Date(2020, time.June, 1, 10, 0, 0, 0, time.UTC), schedule.LastOccurrence(now))
+	})
+
+	t.Run("Later in the week", func(t *testing.T) {
+		now := time.Date(2020, time.June, 4, 8, 0, 0, 0, time.UTC)
+		assert.Equal(t, time.Date(2020, time.June, 1, 10, 0, 0, 0, time.UTC), schedule.LastOccurrence(now))
+	})
+
+	t.Run("Due only once per occurrence", func(t *testing.T) {
+		now := time.Date(2020, time.June, 1, 10, 1, 0, 0, time.UTC)
+		schedule.LastRun = time.Date(2020, time.May, 30, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+		assert.True(t, schedule.IsDue(now))
+
+		schedule.LastRun = schedule.LastOccurrence(now).UnixNano() / int64(time.Millisecond)
+		assert.False(t, schedule.IsDue(now))
+		assert.False(t, schedule.IsDue(now.Add(24*time.Hour)))
+		assert.True(t, schedule.IsDue(now.Add(7*24*time.Hour)))
+	})
+}
+
+func TestRunPairingRound_failedGroup(t *testing.T) {
+	plugin := &Plugin{}
+	//user4 has blacklisted everyone else and is left out
+	plugin.store = newMemoryStore(&LunchbotData{
+		Participations: getJoinedParticipations("user0", "user1", "user2", "user3", "user4"),
+		Blacklists: map[string]map[string]struct{}{
+			"user4": map[string]struct{}{"user0": struct{}{}, "user1": struct{}{}, "user2": struct{}{}, "user3": struct{}{}},
+		},
+	})
+	api := &plugintest.API{}
+	api.On("GetUsersInChannel", "channel", "username", mock.AnythingOfType("int"), channelMembersPerPage).Return(getChannelMembers(5), nil)
+	api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses(model.STATUS_ONLINE), nil)
+	//the group of user0 cannot be messaged
+	api.On("GetGroupChannel", mock.MatchedBy(func(userIDs []string) bool { return ContainsString(userIDs, "user0") })).Return(nil, &model.AppError{Message: "failed"})
+	api.On("GetGroupChannel", mock.AnythingOfType("[]string")).Return(&model.Channel{Id: "group"}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil)
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	plugin.SetAPI(api)
+	config := newConfiguration()
+	config.PostAnnouncement = false
+	plugin.setConfiguration(config)
+
+	result, err := plugin.RunPairingRound("channel", 2, "")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to start 1 of 2 groups")
+	assert.Len(t, result.Groups, 2)
+	//the other group has been started anyway
+	var startedGroup []*model.User
+	for _, group := range result.Groups {
+		if !ContainsString(GetUserIDList(group), "user0") {
+			startedGroup = group
+		}
+	}
+	api.AssertCalled(t, "GetGroupChannel", append(GetUserIDList(startedGroup), ""))
+	api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool { return post.ChannelId == "group" }))
+
+	//the group that has not been notified is not paired
+	data, _ := plugin.store.ReadAll()
+	for _, group := range result.Groups {
+		userIDs := GetUserIDList(group)
+		for _, userID := range userIDs {
+			if ContainsString(userIDs, "user0") {
+				assert.NotContains(t, data.ActivePairings, userID)
+				assert.Zero(t, data.Participations[userID].LastPairedAt)
+			} else {
+				assert.Contains(t, data.ActivePairings, userID)
+				assert.NotZero(t, data.Participations[userID].LastPairedAt)
+			}
+		}
+	}
+	assert.Len(t, data.Pairings, 1)
+
+	//the users that have been left out are counted nonetheless
+	assert.Equal(t, 1, GetSkippedRounds(&data, "user4"))
+	round, _ := plugin.store.GetRound(result.Round.ID)
+	assert.NotNil(t, round)
+}
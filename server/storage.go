@@ -1,37 +1,201 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
 )
 
-const (
-	//KVKEY is the key used for storing the data in the KVStorage
-	KVKEY = "LunchbotData"
+// Store persists the data of the lunchbot. The plugin uses a Store that is backed by the KVStore of the Mattermost server.
+// All updates are atomic: they are applied to the latest stored value and retried if the value has been changed concurrently,
+// so they must not have side effects.
+type Store interface {
+	// ReadAll returns a snapshot of all stored data
+	ReadAll() (LunchbotData, error)
+	// ReadUsers returns a snapshot of the data of the given users and of the pairings they are members of, the data of other users is not read
+	ReadUsers(userIDs []string) (LunchbotData, error)
+	// Migrate moves data that has been stored by older versions of the plugin into the current layout
+	Migrate() error
+	// Clear removes all stored data
+	Clear() error
+
+	// GetUserData returns the pairing state, pairing history, topics, blacklist and participation of the given user
+	GetUserData(userID string) (*UserData, error)
+	// UpdateUserData applies the given update to the data of the given user, the data is created if it does not exist yet
+	UpdateUserData(userID string, update func(userData *UserData) error) (*UserData, error)
+
+	// GetPairing returns the active pairing with the given ID, nil if there is none
+	GetPairing(pairingID string) (*Pairing, error)
+	// CreatePairing stores a new pairing, fails if a pairing with the same ID already exists
+	CreatePairing(pairing *Pairing) error
+	// UpdatePairing applies the given update to the given pairing, returns nil if the pairing does not exist
+	UpdatePairing(pairingID string, update func(pairing *Pairing) error) (*Pairing, error)
+	// DeletePairing deletes the pairing with the given ID and returns it, nil if it has already been deleted
+	DeletePairing(pairingID string) (*Pairing, error)
+
+	// GetInvitation returns the pending invitation with the given ID, nil if there is none
+	GetInvitation(invitationID string) (*Invitation, error)
+	// CreateInvitation stores a new invitation, fails if an invitation with the same ID already exists
+	CreateInvitation(invitation *Invitation) error
+	// UpdateInvitation applies the given update to the given invitation, returns nil if the invitation does not exist
+	UpdateInvitation(invitationID string, update func(invitation *Invitation) error) (*Invitation, error)
+	// DeleteInvitation deletes the invitation with the given ID and returns it, nil if it has already been deleted
+	DeleteInvitation(invitationID string) (*Invitation, error)
+
+	// GetSchedule returns the schedule of the given channel, nil if there is none
+	GetSchedule(channelID string) (*Schedule, error)
+	// SaveSchedule stores the schedule of its channel, an existing schedule gets replaced
+	SaveSchedule(schedule *Schedule) error
+	// UpdateSchedule applies the given update to the schedule of the given channel, returns nil if the channel has no schedule
+	UpdateSchedule(channelID string, update func(schedule *Schedule) error) (*Schedule, error)
+	// DeleteSchedule deletes the schedule of the given channel
+	DeleteSchedule(channelID string) error
+
+	// GetChannelConfig returns the configuration of the given channel, an empty configuration if the channel has none
+	GetChannelConfig(channelID string) (*ChannelConfig, error)
+	// SaveChannelConfig stores the configuration of the given channel
+	SaveChannelConfig(channelID string, channelConfig *ChannelConfig) error
+	// UpdateChannelConfig applies the given update to the configuration of the given channel, the configuration is created if it does not exist yet
+	UpdateChannelConfig(channelID string, update func(channelConfig *ChannelConfig) error) (*ChannelConfig, error)
+
+	// GetTopicCatalogue returns the topics of the organisation-wide topic catalogue
+	GetTopicCatalogue() (map[string]*CatalogueTopic, error)
+	// UpdateTopicCatalogue applies the given update to the topic catalogue, the catalogue is created if it does not exist yet
+	UpdateTopicCatalogue(update func(catalogue map[string]*CatalogueTopic) error) (map[string]*CatalogueTopic, error)
+
+	// GetQuestions returns the icebreaker questions that have been added by admins
+	GetQuestions() (map[string]*Question, error)
+	// UpdateQuestions applies the given update to the icebreaker questions that have been added by admins
+	UpdateQuestions(update func(questions map[string]*Question) error) (map[string]*Question, error)
+
+	// GetRound returns the recorded pairing round with the given ID, nil if there is none
+	GetRound(roundID string) (*Round, error)
+	// GetRounds returns the recorded pairing rounds of the given channel
+	GetRounds(channelID string) ([]*Round, error)
+	// SaveRound records the given pairing round, rounds are removed automatically after some time
+	SaveRound(round *Round) error
+
+	// AppendPairingLog adds the given entry to the log of ended pairings and invitations, the log is never trimmed.
+	// An entry that has already been logged is not added again.
+	AppendPairingLog(entry *HistoryEntry) error
+	// GetPairingLog returns the logged entries of every month that overlaps the given range, ordered by the time they have been logged
+	GetPairingLog(from time.Time, to time.Time) ([]*HistoryEntry, error)
+}
+
+var (
+	// errConflict is returned if an entity has been changed by someone else in the meantime
+	errConflict = errors.New("the data has been changed concurrently, please try again")
+	// errAlreadyPaired is returned if a user has been paired by someone else in the meantime
+	errAlreadyPaired = errors.New("one of the users has already been paired with someone else")
+	// errAlreadyInvited is returned if a user has been invited by someone else in the meantime
+	errAlreadyInvited = errors.New("one of the users has already been invited by someone else")
 )
 
-// ReadFromStorage reads LunchbotData from the KVStore. Makes sure that data is inited for the given team and channel
-func (p *Plugin) ReadFromStorage() LunchbotData {
-	data := LunchbotData{}
-	kvData, err := p.API.KVGet(KVKEY)
-	if err != nil {
-		//do nothing.. we'll return an empty LunchbotData then...
-	}
-	if kvData != nil {
-		json.Unmarshal(kvData, &data)
+// newLunchbotData returns empty data whose maps are initialized
+func newLunchbotData() LunchbotData {
+	return LunchbotData{
+		Version:            DataVersion,
+		Pairings:           map[string]*Pairing{},
+		ActivePairings:     map[string]string{},
+		History:            map[string][]*HistoryEntry{},
+		UserTopics:         map[string]map[string]struct{}{},
+		Blacklists:         map[string]map[string]struct{}{},
+		Schedules:          map[string]*Schedule{},
+		Participations:     map[string]*Participation{},
+		ChannelConfigs:     map[string]*ChannelConfig{},
+		TopicCatalogue:     map[string]*CatalogueTopic{},
+		Questions:          map[string]*Question{},
+		Invitations:        map[string]*Invitation{},
+		PendingInvitations: map[string]string{},
 	}
+}
 
-	return data
+// addUserData adds the data of a single user to the given snapshot
+func addUserData(data *LunchbotData, userID string, userData *UserData) {
+	if len(userData.ActivePairingID) > 0 {
+		data.ActivePairings[userID] = userData.ActivePairingID
+	}
+	if len(userData.PendingInvitationID) > 0 {
+		data.PendingInvitations[userID] = userData.PendingInvitationID
+	}
+	if len(userData.History) > 0 {
+		data.History[userID] = userData.History
+	}
+	if len(userData.Topics) > 0 {
+		data.UserTopics[userID] = userData.Topics
+	}
+	if len(userData.Blacklist) > 0 {
+		data.Blacklists[userID] = userData.Blacklist
+	}
+	if userData.Participation != nil {
+		data.Participations[userID] = userData.Participation
+	}
 }
 
-// WriteToStorage writes the given data to storage
-func (p *Plugin) WriteToStorage(data *LunchbotData) {
-	reqBodyBytes := new(bytes.Buffer)
-	json.NewEncoder(reqBodyBytes).Encode(data)
-	p.API.KVSet(KVKEY, reqBodyBytes.Bytes())
+// MigrateData converts data that has been stored by an older version of the plugin into the current layout
+func MigrateData(data *LunchbotData) {
+	if data.Version < 1 {
+		//ActivePairings used to map each user to the user he has been paired with. Groups were stored as a cycle of users.
+		oldPairings := data.ActivePairings
+		data.Pairings = map[string]*Pairing{}
+		data.ActivePairings = map[string]string{}
+		for userID := range oldPairings {
+			if _, ok := data.ActivePairings[userID]; ok {
+				continue
+			}
+			pairing := &Pairing{
+				ID:        model.NewId(),
+				CreatedAt: model.GetMillis(),
+			}
+			for currentUserID := userID; len(pairing.UserIDs) < len(oldPairings); currentUserID = oldPairings[currentUserID] {
+				if _, ok := data.ActivePairings[currentUserID]; ok {
+					break
+				}
+				if _, ok := oldPairings[currentUserID]; !ok {
+					break
+				}
+				pairing.UserIDs = append(pairing.UserIDs, currentUserID)
+				data.ActivePairings[currentUserID] = pairing.ID
+			}
+			data.Pairings[pairing.ID] = pairing
+		}
+	}
+	data.Version = DataVersion
 }
 
-// ClearStorage removes all stored data from KVStorage
-func (p *Plugin) ClearStorage() {
-	p.API.KVDelete(KVKEY)
+// SplitData splits the given data into the data of every single user
+func SplitData(data *LunchbotData) map[string]*UserData {
+	users := map[string]*UserData{}
+	getUserData := func(userID string) *UserData {
+		if _, ok := users[userID]; !ok {
+			users[userID] = &UserData{}
+		}
+		return users[userID]
+	}
+	for userID, pairingID := range data.ActivePairings {
+		getUserData(userID).ActivePairingID = pairingID
+	}
+	for userID, invitationID := range data.PendingInvitations {
+		getUserData(userID).PendingInvitationID = invitationID
+	}
+	for userID, lastPairings := range data.LastPairings {
+		getUserData(userID).LastPairings = lastPairings
+	}
+	for userID, history := range data.History {
+		getUserData(userID).History = history
+	}
+	for userID, topics := range data.UserTopics {
+		getUserData(userID).Topics = topics
+	}
+	for userID, blacklist := range data.Blacklists {
+		getUserData(userID).Blacklist = blacklist
+	}
+	for userID, participation := range data.Participations {
+		getUserData(userID).Participation = participation
+	}
+	for userID, userData := range users {
+		MigrateUserData(userID, userData)
+	}
+	return users
 }
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mroth/weightedrand"
+)
+
+const (
+	//MatchStrategyWeightedRandom picks partners randomly, users with a higher score are picked more likely
+	MatchStrategyWeightedRandom = "weighted-random"
+	//MatchStrategyNewConnections picks the partners the group has met the least, without any randomness
+	MatchStrategyNewConnections = "new-connections"
+)
+
+// matchStrategies contains every strategy that can be configured, by name
+var matchStrategies = map[string]MatchStrategy{
+	MatchStrategyWeightedRandom: WeightedRandomStrategy{},
+	MatchStrategyNewConnections: NewConnectionsStrategy{},
+}
+
+// MatchContext is everything the parts of the matching pipeline need to know about the pairing that is being made
+type MatchContext struct {
+	Config      *configuration
+	Data        *LunchbotData
+	Departments Departments
+	ChannelID   string
+	Now         time.Time
+	Rand        *rand.Rand     //Source of all random choices
+	Priorities  map[string]int //Key: UserID, Value: fairness priority of users that have been waiting for a pairing
+
+	lastPartners     map[string][]string            //Recent partners of the users that have been looked up
+	normalizedTopics map[string]map[string]struct{} //Normalized topics of the users that have been looked up
+}
+
+// GetLastPartners returns the recent partners of the given user, the most recent partner is the last one.
+// They are looked up only once per context, as scoring every pair of a large channel needs them over and over again.
+func (c *MatchContext) GetLastPartners(userID string) []string {
+	if c.lastPartners == nil {
+		c.lastPartners = map[string][]string{}
+	}
+	lastPartners, ok := c.lastPartners[userID]
+	if !ok {
+		lastPartners = GetLastPartners(c.Data.History[userID], userID)
+		c.lastPartners[userID] = lastPartners
+	}
+	return lastPartners
+}
+
+// GetNormalizedTopics returns the normalized topics of the given user, they are normalized only once per context
+func (c *MatchContext) GetNormalizedTopics(userID string) map[string]struct{} {
+	if c.normalizedTopics == nil {
+		c.normalizedTopics = map[string]map[string]struct{}{}
+	}
+	topics, ok := c.normalizedTopics[userID]
+	if !ok {
+		topics = map[string]struct{}{}
+		for topic := range c.Data.UserTopics[userID] {
+			topics[NormalizeTopic(topic)] = struct{}{}
+		}
+		c.normalizedTopics[userID] = topics
+	}
+	return topics
+}
+
+// CandidateSource provides the users that are considered as partners
+type CandidateSource interface {
+	GetCandidates(ctx *MatchContext) ([]*model.User, *model.AppError)
+}
+
+// CandidateFilter removes the users that cannot get paired from the given candidates
+type CandidateFilter interface {
+	Filter(ctx *MatchContext, candidates []*model.User) []*model.User
+}
+
+// Scorer rates how well the given user fits into the given group, a higher score is a better fit
+type Scorer interface {
+	Score(ctx *MatchContext, group []string, userID string) uint
+}
+
+// GraphScorer is a Scorer that can rate every pair of users of a compatibility graph at once, which is much faster in large channels than rating one pair after another.
+// For every pair of users i < j, the score that user j gets for a group that only contains user i is added to the weight of their edge.
+type GraphScorer interface {
+	Scorer
+	AddScores(ctx *MatchContext, graph *CompatibilityGraph)
+}
+
+// MatchStrategy decides which of the scored candidates joins the given group next
+type MatchStrategy interface {
+	// Pick returns the candidate that joins the group, the given candidates are never empty
+	Pick(ctx *MatchContext, group []string, candidates []ScoredCandidate) *model.User
+}
+
+// BatchStrategy is a MatchStrategy that matches all users of a pairing round at once, instead of filling one group after another
+type BatchStrategy interface {
+	MatchStrategy
+	// MatchGroups splits the given users into groups of the given size, the queued users go first.
+	// Returns the matched groups and the users that could not be matched with anyone.
+	MatchGroups(ctx *MatchContext, matcher *Matcher, users []*model.User, groupSize int, queued map[string]struct{}) ([][]*model.User, []*model.User)
+}
+
+// ScoredCandidate is a user that can join a group, together with the sum of the scores the user got
+type ScoredCandidate struct {
+	User  *model.User
+	Score uint
+}
+
+// GetMatchStrategy returns the strategy with the given name. Unknown names fall back to the weighted random strategy.
+func GetMatchStrategy(name string) MatchStrategy {
+	if strategy, ok := matchStrategies[name]; ok {
+		return strategy
+	}
+	return matchStrategies[MatchStrategyWeightedRandom]
+}
+
+// GetMatchStrategyNames returns the names of all strategies in alphabetical order
+func GetMatchStrategyNames() []string {
+	names := []string{}
+	for name := range matchStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CandidatePipeline takes the users of its source and removes every user that does not pass one of its filters
+type CandidatePipeline struct {
+	Source  CandidateSource
+	Filters []CandidateFilter
+}
+
+// GetCandidates returns the users of the source that pass all filters, in the order of the source
+func (c *CandidatePipeline) GetCandidates(ctx *MatchContext) ([]*model.User, *model.AppError) {
+	candidates, appErr := c.Source.GetCandidates(ctx)
+	if appErr != nil {
+		return nil, appErr
+	}
+	for _, filter := range c.Filters {
+		candidates = filter.Filter(ctx, candidates)
+	}
+	return candidates, nil
+}
+
+// ChannelMemberSource provides the members of the channel of the context. If MaxMembers is positive, only that many members are provided.
+// If a Store is given, the data of the members and of the additional UserIDs is read from it into the context. The data of other users is not read.
+type ChannelMemberSource struct {
+	Cache      *UserCache
+	MaxMembers int
+	Store      Store
+	UserIDs    []string
+}
+
+// GetCandidates returns the members of the channel
+func (s *ChannelMemberSource) GetCandidates(ctx *MatchContext) ([]*model.User, *model.AppError) {
+	members, appErr := s.Cache.GetChannelMembers(ctx.ChannelID, s.MaxMembers)
+	if appErr != nil || s.Store == nil {
+		return members, appErr
+	}
+	data, err := s.Store.ReadUsers(append(GetUserIDList(members), s.UserIDs...))
+	if err != nil {
+		return nil, &model.AppError{
+			Message:       "Cannot read the stored data...",
+			DetailedError: err.Error(),
+		}
+	}
+	ctx.Data = &data
+	return members, nil
+}
+
+// UserFilter is a CandidateFilter that keeps every candidate the function returns true for
+type UserFilter func(ctx *MatchContext, user *model.User) bool
+
+// Filter returns the candidates the function returns true for
+func (f UserFilter) Filter(ctx *MatchContext, candidates []*model.User) []*model.User {
+	filtered := []*model.User{}
+	for _, user := range candidates {
+		if f(ctx, user) {
+			filtered = append(filtered, user)
+		}
+	}
+	return filtered
+}
+
+// BotFilter removes bots
+var BotFilter = UserFilter(func(ctx *MatchContext, user *model.User) bool {
+	return !user.IsBot
+})
+
+// PairedFilter removes users that are already paired
+var PairedFilter = UserFilter(func(ctx *MatchContext, user *model.User) bool {
+	_, ok := ctx.Data.ActivePairings[user.Id]
+	return !ok
+})
+
+// InvitationFilter removes users that are waiting for an answer to an invitation
+var InvitationFilter = UserFilter(func(ctx *MatchContext, user *model.User) bool {
+	_, ok := ctx.Data.PendingInvitations[user.Id]
+	return !ok
+})
+
+// ParticipationFilter removes users that do not want to get paired in the channel right now
+var ParticipationFilter = UserFilter(func(ctx *MatchContext, user *model.User) bool {
+	return IsParticipating(ctx.Data, user.Id, ctx.ChannelID, ctx.Now)
+})
+
+// ExcludedUsersFilter returns a filter that removes the given users, e.g. the user that looks for a partner
+func ExcludedUsersFilter(userIDs []string) CandidateFilter {
+	return UserFilter(func(ctx *MatchContext, user *model.User) bool {
+		return !ContainsString(userIDs, user.Id)
+	})
+}
+
+// BlacklistFilter returns a filter that removes the users that have a blacklist conflict with the given user
+func BlacklistFilter(userID string) CandidateFilter {
+	return UserFilter(func(ctx *MatchContext, user *model.User) bool {
+		return !IsBlacklisted(ctx.Data, userID, user.Id)
+	})
+}
+
+// RoleFilter returns a filter that removes the users that do not have one of the given roles in the channel
+func (p *Plugin) RoleFilter(eligibleRoles []string) CandidateFilter {
+	return UserFilter(func(ctx *MatchContext, user *model.User) bool {
+		return p.HasEligibleRole(user, ctx.ChannelID, eligibleRoles)
+	})
+}
+
+// AvailabilityFilter removes the users that are not available right now, their statuses are fetched in bulk.
+// The removed users are remembered, so they can get queued for the next round.
+type AvailabilityFilter struct {
+	plugin      *Plugin
+	cache       *UserCache
+	Unavailable []*model.User
+}
+
+// NewAvailabilityFilter creates a filter that looks up the statuses of the users using the given cache
+func (p *Plugin) NewAvailabilityFilter(cache *UserCache) *AvailabilityFilter {
+	return &AvailabilityFilter{plugin: p, cache: cache}
+}
+
+// Filter returns the candidates that are available and remembers the others
+func (f *AvailabilityFilter) Filter(ctx *MatchContext, candidates []*model.User) []*model.User {
+	available, unavailable := f.plugin.FilterAvailableUsers(f.cache, candidates, ctx.Data, ctx.Now)
+	f.Unavailable = append(f.Unavailable, unavailable...)
+	return available
+}
+
+// RecencyScorer prefers users that have not been paired with the group members recently
+type RecencyScorer struct{}
+
+// Score returns the sum of the pairing weights between the user and every group member
+func (RecencyScorer) Score(ctx *MatchContext, group []string, userID string) uint {
+	weight := uint(0)
+	for _, memberID := range group {
+		weight += GetPairingWeight(ctx.Config, ctx.GetLastPartners(memberID), userID)
+	}
+	return weight
+}
+
+// AddScores adds the pairing weights to the edges of the graph, only the edges to recent partners differ from the weight of new users
+func (RecencyScorer) AddScores(ctx *MatchContext, graph *CompatibilityGraph) {
+	newUserWeight := int32(ctx.Config.NewUserWeight)
+	graph.AddWeightToAll(newUserWeight)
+	for i, user := range graph.Users {
+		lastPartners := ctx.GetLastPartners(user.Id)
+		seen := map[string]struct{}{}
+		for _, partnerID := range lastPartners {
+			if _, ok := seen[partnerID]; ok {
+				continue
+			}
+			seen[partnerID] = struct{}{}
+			if j, ok := graph.Index(partnerID); ok && j > i {
+				graph.AddWeight(i, j, int32(GetPairingWeight(ctx.Config, lastPartners, partnerID))-newUserWeight)
+			}
+		}
+	}
+}
+
+// SharedTopicScorer prefers users that share topics with the group members
+type SharedTopicScorer struct{}
+
+// Score returns the weight that gets added for every topic the user shares with a group member
+func (SharedTopicScorer) Score(ctx *MatchContext, group []string, userID string) uint {
+	topics := ctx.GetNormalizedTopics(userID)
+	weight := uint(0)
+	for _, memberID := range group {
+		for topic := range ctx.GetNormalizedTopics(memberID) {
+			if _, ok := topics[topic]; ok {
+				weight += uint(ctx.Config.SharedTopicWeight)
+			}
+		}
+	}
+	return weight
+}
+
+// AddScores adds the weight of every shared topic to the edges of the graph, only the users that share a topic are visited
+func (SharedTopicScorer) AddScores(ctx *MatchContext, graph *CompatibilityGraph) {
+	topicUsers := map[string][]int{}
+	for index, user := range graph.Users {
+		for topic := range ctx.GetNormalizedTopics(user.Id) {
+			topicUsers[topic] = append(topicUsers[topic], index)
+		}
+	}
+	weight := int32(ctx.Config.SharedTopicWeight)
+	for _, users := range topicUsers {
+		for index, user := range users {
+			for _, otherUser := range users[index+1:] {
+				graph.AddWeight(user, otherUser, weight)
+			}
+		}
+	}
+}
+
+// DepartmentScorer prefers users from other departments than the group members
+type DepartmentScorer struct{}
+
+// Score returns the weight of the group members that belong to another department than the user
+func (DepartmentScorer) Score(ctx *MatchContext, group []string, userID string) uint {
+	return GetDepartmentWeight(ctx.Config, ctx.Departments, group, userID)
+}
+
+// AddScores adds the weight of different departments to the edges of the graph.
+// The departments are numbered first, so their names do not have to be compared for every pair.
+func (DepartmentScorer) AddScores(ctx *MatchContext, graph *CompatibilityGraph) {
+	names := []string{}
+	userDepartments := make([][]int, len(graph.Users))
+	for index, user := range graph.Users {
+		departments, ok := ctx.Departments[user.Id]
+		if !ok {
+			continue
+		}
+		userDepartments[index] = []int{}
+		for _, department := range departments {
+			number := -1
+			for otherNumber, name := range names {
+				if strings.EqualFold(name, department) {
+					number = otherNumber
+					break
+				}
+			}
+			if number < 0 {
+				number = len(names)
+				names = append(names, department)
+			}
+			userDepartments[index] = append(userDepartments[index], number)
+		}
+	}
+
+	weight := int32(ctx.Config.CrossDepartmentWeight)
+	for i, departments := range userDepartments {
+		if departments == nil {
+			continue
+		}
+		for j := i + 1; j < len(userDepartments); j++ {
+			if userDepartments[j] == nil {
+				continue
+			}
+			shared := false
+			for _, department := range departments {
+				if ContainsInt(userDepartments[j], department) {
+					shared = true
+					break
+				}
+			}
+			if !shared {
+				graph.AddWeight(i, j, weight)
+			}
+		}
+	}
+}
+
+// Matcher fills groups by scoring the candidates and letting its strategy pick among them
+type Matcher struct {
+	Scorers  []Scorer
+	Strategy MatchStrategy
+}
+
+// NewMatcher returns a matcher with the given strategy that scores candidates by recency, shared topics and departments
+func NewMatcher(strategy MatchStrategy) *Matcher {
+	return &Matcher{
+		Scorers:  []Scorer{RecencyScorer{}, SharedTopicScorer{}, DepartmentScorer{}},
+		Strategy: strategy,
+	}
+}
+
+// Score returns the sum of the scores the given user gets from every scorer
+func (m *Matcher) Score(ctx *MatchContext, group []string, userID string) uint {
+	score := uint(0)
+	for _, scorer := range m.Scorers {
+		score += scorer.Score(ctx, group, userID)
+	}
+	return score
+}
+
+// FillGroup adds candidates to the given group until it has the given size or nobody is left that can join it.
+// Candidates that are already members or have a blacklist conflict with a member are skipped. Returns the added users.
+func (m *Matcher) FillGroup(ctx *MatchContext, group []string, candidates []*model.User, groupSize int) []*model.User {
+	members := make([]string, len(group))
+	copy(members, group)
+	picked := []*model.User{}
+	for len(members) < groupSize {
+		scored := []ScoredCandidate{}
+		for _, user := range candidates {
+			if ContainsString(members, user.Id) || !CanJoinGroup(ctx.Data, user.Id, members) {
+				continue
+			}
+			scored = append(scored, ScoredCandidate{User: user, Score: m.Score(ctx, members, user.Id)})
+		}
+		if len(scored) <= 0 {
+			break
+		}
+
+		user := m.Strategy.Pick(ctx, members, scored)
+		members = append(members, user.Id)
+		picked = append(picked, user)
+	}
+	return picked
+}
+
+// WeightedRandomStrategy picks a random candidate, candidates with a higher score are picked more likely
+type WeightedRandomStrategy struct{}
+
+// Pick returns a random candidate
+func (WeightedRandomStrategy) Pick(ctx *MatchContext, group []string, candidates []ScoredCandidate) *model.User {
+	choices := make([]weightedrand.Choice, 0, len(candidates))
+	for _, candidate := range candidates {
+		choices = append(choices, weightedrand.Choice{Weight: candidate.Score, Item: candidate.User})
+	}
+	return PickWeighted(ctx.Rand, choices).(*model.User)
+}
+
+// NewConnectionsStrategy picks the candidate that has not been paired with the most group members, so every group makes as many new connections as possible.
+// Ties are broken by the score and then by the user ID, the choice does not depend on any randomness.
+// Pairing rounds are matched as a whole, so the users that are matched last do not end up with repeat partners only.
+type NewConnectionsStrategy struct{}
+
+// MatchGroups matches the users of a pairing round, so that the total score of all groups gets close to the highest possible one
+func (NewConnectionsStrategy) MatchGroups(ctx *MatchContext, matcher *Matcher, users []*model.User, groupSize int, queued map[string]struct{}) ([][]*model.User, []*model.User) {
+	return MatchOptimally(ctx, matcher, users, groupSize, queued)
+}
+
+// Pick returns the candidate with the most new connections
+func (NewConnectionsStrategy) Pick(ctx *MatchContext, group []string, candidates []ScoredCandidate) *model.User {
+	best := candidates[0]
+	bestConnections := CountNewConnections(ctx.Data, group, best.User.Id)
+	for _, candidate := range candidates[1:] {
+		connections := CountNewConnections(ctx.Data, group, candidate.User.Id)
+		if connections != bestConnections {
+			if connections > bestConnections {
+				best, bestConnections = candidate, connections
+			}
+			continue
+		}
+		if candidate.Score > best.Score || (candidate.Score == best.Score && candidate.User.Id < best.User.Id) {
+			best = candidate
+		}
+	}
+	return best.User
+}
+
+// CountNewConnections returns the number of group members the given user has not been paired with according to the history
+func CountNewConnections(data *LunchbotData, group []string, userID string) int {
+	lastPartners := GetLastPartners(data.History[userID], userID)
+	connections := 0
+	for _, memberID := range group {
+		if !ContainsString(lastPartners, memberID) {
+			connections++
+		}
+	}
+	return connections
+}
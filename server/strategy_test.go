@@ -0,0 +1,192 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestMatchContext returns a context with the default configuration and a random source of the given seed
+func newTestMatchContext(data *LunchbotData, departments Departments, seed int64) *MatchContext {
+	return &MatchContext{
+		Config:      newConfiguration(),
+		Data:        data,
+		Departments: departments,
+		ChannelID:   "channel",
+		Now:         time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC),
+		Rand:        NewRand(seed),
+	}
+}
+
+// userListSource is a CandidateSource that provides a fixed list of users
+type userListSource []*model.User
+
+func (s userListSource) GetCandidates(ctx *MatchContext) ([]*model.User, *model.AppError) {
+	return s, nil
+}
+
+// getTestUsers returns users with the given IDs
+func getTestUsers(userIDs ...string) []*model.User {
+	users := []*model.User{}
+	for _, userID := range userIDs {
+		users = append(users, &model.User{Id: userID})
+	}
+	return users
+}
+
+func TestGetMatchStrategy(t *testing.T) {
+	assert.Equal(t, WeightedRandomStrategy{}, GetMatchStrategy(MatchStrategyWeightedRandom))
+	assert.Equal(t, NewConnectionsStrategy{}, GetMatchStrategy(MatchStrategyNewConnections))
+	assert.Equal(t, WeightedRandomStrategy{}, GetMatchStrategy(""))
+	assert.Equal(t, []string{MatchStrategyNewConnections, MatchStrategyWeightedRandom}, GetMatchStrategyNames())
+}
+
+func TestCandidatePipeline(t *testing.T) {
+	users := getTestUsers("1", "2", "3", "4")
+	users[1].IsBot = true
+	pipeline := &CandidatePipeline{
+		Source:  userListSource(users),
+		Filters: []CandidateFilter{BotFilter, ExcludedUsersFilter([]string{"4"})},
+	}
+
+	candidates, appErr := pipeline.GetCandidates(newTestMatchContext(&LunchbotData{}, nil, 1))
+	assert.Nil(t, appErr)
+	assert.Equal(t, []string{"1", "3"}, GetUserIDList(candidates))
+}
+
+func TestCandidateFilters(t *testing.T) {
+	users := getTestUsers("1", "2", "3")
+	data := &LunchbotData{
+		ActivePairings:     map[string]string{"1": "pairing"},
+		PendingInvitations: map[string]string{"2": "invitation"},
+		Participations:     getJoinedParticipations("1", "3"),
+		Blacklists:         map[string]map[string]struct{}{"3": map[string]struct{}{"other": struct{}{}}},
+	}
+	ctx := newTestMatchContext(data, nil, 1)
+
+	bot := &model.User{Id: "bot", IsBot: true}
+	assert.Equal(t, []string{"1", "2", "3"}, GetUserIDList(BotFilter.Filter(ctx, append(users, bot))))
+	assert.Equal(t, []string{"2", "3"}, GetUserIDList(PairedFilter.Filter(ctx, users)))
+	assert.Equal(t, []string{"1", "3"}, GetUserIDList(InvitationFilter.Filter(ctx, users)))
+	assert.Equal(t, []string{"1", "3"}, GetUserIDList(ParticipationFilter.Filter(ctx, users)))
+	assert.Equal(t, []string{"2"}, GetUserIDList(ExcludedUsersFilter([]string{"1", "3"}).Filter(ctx, users)))
+	assert.Equal(t, []string{"1", "2"}, GetUserIDList(BlacklistFilter("other").Filter(ctx, users)))
+}
+
+func TestRoleFilter(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetChannelMember", "channel", "2").Return(&model.ChannelMember{Roles: "channel_user channel_admin"}, nil)
+	api.On("GetChannelMember", "channel", mock.AnythingOfType("string")).Return(&model.ChannelMember{Roles: "channel_user"}, nil)
+	plugin.SetAPI(api)
+	ctx := newTestMatchContext(&LunchbotData{}, nil, 1)
+	users := getTestUsers("1", "2", "3")
+
+	assert.Equal(t, []string{"1", "2", "3"}, GetUserIDList(plugin.RoleFilter(nil).Filter(ctx, users)))
+	assert.Equal(t, []string{"2"}, GetUserIDList(plugin.RoleFilter([]string{"channel_admin"}).Filter(ctx, users)))
+}
+
+func TestAvailabilityFilter(t *testing.T) {
+	plugin := &Plugin{}
+	api := &plugintest.API{}
+	api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses(model.STATUS_AWAY), nil)
+	plugin.SetAPI(api)
+	config := newConfiguration()
+	config.EligibleStatuses = "online"
+	plugin.setConfiguration(config)
+	ctx := newTestMatchContext(&LunchbotData{Participations: getJoinedParticipations("1", "2")}, nil, 1)
+
+	filter := plugin.NewAvailabilityFilter(NewUserCache(api))
+	assert.Empty(t, filter.Filter(ctx, getTestUsers("1", "2")))
+	assert.Equal(t, []string{"1", "2"}, GetUserIDList(filter.Unavailable))
+}
+
+func TestScorers(t *testing.T) {
+	data := &LunchbotData{
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"1", "2"}, Outcome: OutcomeFinished}},
+		},
+		UserTopics: map[string]map[string]struct{}{
+			"1": map[string]struct{}{"Cooking": struct{}{}},
+			"3": map[string]struct{}{"cooking": struct{}{}},
+		},
+	}
+	departments := Departments{"1": []string{"Sales"}, "2": []string{"Sales"}, "3": []string{"Finance"}}
+	ctx := newTestMatchContext(data, departments, 1)
+
+	assert.Equal(t, uint(1), RecencyScorer{}.Score(ctx, []string{"1"}, "2"))
+	assert.Equal(t, uint(ctx.Config.NewUserWeight), RecencyScorer{}.Score(ctx, []string{"1"}, "3"))
+	assert.Equal(t, uint(0), SharedTopicScorer{}.Score(ctx, []string{"1"}, "2"))
+	assert.Equal(t, uint(ctx.Config.SharedTopicWeight), SharedTopicScorer{}.Score(ctx, []string{"1"}, "3"))
+	assert.Equal(t, uint(0), DepartmentScorer{}.Score(ctx, []string{"1"}, "2"))
+	assert.Equal(t, uint(ctx.Config.CrossDepartmentWeight), DepartmentScorer{}.Score(ctx, []string{"1"}, "3"))
+
+	matcher := NewMatcher(WeightedRandomStrategy{})
+	assert.Equal(t, uint(ctx.Config.NewUserWeight+ctx.Config.SharedTopicWeight+ctx.Config.CrossDepartmentWeight), matcher.Score(ctx, []string{"1"}, "3"))
+}
+
+func TestWeightedRandomStrategy(t *testing.T) {
+	candidates := []ScoredCandidate{
+		ScoredCandidate{User: &model.User{Id: "1"}, Score: 0},
+		ScoredCandidate{User: &model.User{Id: "2"}, Score: 10},
+		ScoredCandidate{User: &model.User{Id: "3"}, Score: 1000},
+	}
+
+	ctx, otherCtx := newTestMatchContext(&LunchbotData{}, nil, 7), newTestMatchContext(&LunchbotData{}, nil, 7)
+	picked := map[string]int{}
+	for i := 0; i < 100; i++ {
+		user := WeightedRandomStrategy{}.Pick(ctx, []string{"0"}, candidates)
+		assert.Equal(t, user, WeightedRandomStrategy{}.Pick(otherCtx, []string{"0"}, candidates))
+		picked[user.Id]++
+	}
+	assert.Zero(t, picked["1"])
+	assert.Greater(t, picked["3"], picked["2"])
+}
+
+func TestNewConnectionsStrategy(t *testing.T) {
+	data := &LunchbotData{
+		History: map[string][]*HistoryEntry{
+			"1": []*HistoryEntry{&HistoryEntry{UserIDs: []string{"0", "1"}, Outcome: OutcomeFinished}},
+		},
+	}
+	ctx := newTestMatchContext(data, nil, 1)
+	assert.Equal(t, 0, CountNewConnections(data, []string{"0"}, "1"))
+	assert.Equal(t, 1, CountNewConnections(data, []string{"0", "5"}, "1"))
+
+	t.Run("Prefers new connections over a higher score", func(t *testing.T) {
+		candidates := []ScoredCandidate{
+			ScoredCandidate{User: &model.User{Id: "1"}, Score: 5000},
+			ScoredCandidate{User: &model.User{Id: "2"}, Score: 10},
+		}
+		assert.Equal(t, "2", NewConnectionsStrategy{}.Pick(ctx, []string{"0"}, candidates).Id)
+	})
+
+	t.Run("Ties are broken by score and user ID", func(t *testing.T) {
+		candidates := []ScoredCandidate{
+			ScoredCandidate{User: &model.User{Id: "4"}, Score: 10},
+			ScoredCandidate{User: &model.User{Id: "3"}, Score: 20},
+			ScoredCandidate{User: &model.User{Id: "2"}, Score: 20},
+		}
+		assert.Equal(t, "2", NewConnectionsStrategy{}.Pick(ctx, []string{"0"}, candidates).Id)
+	})
+}
+
+func TestMatcherFillGroup(t *testing.T) {
+	data := &LunchbotData{
+		Blacklists: map[string]map[string]struct{}{"1": map[string]struct{}{"2": struct{}{}}},
+	}
+	ctx := newTestMatchContext(data, nil, 1)
+	matcher := NewMatcher(NewConnectionsStrategy{})
+
+	//the first member and users with a blacklist conflict are never picked
+	picked := matcher.FillGroup(ctx, []string{"1"}, getTestUsers("1", "2", "3", "4"), 3)
+	assert.Equal(t, []string{"3", "4"}, GetUserIDList(picked))
+
+	picked = matcher.FillGroup(ctx, []string{"1"}, getTestUsers("2", "3"), 4)
+	assert.Equal(t, []string{"3"}, GetUserIDList(picked))
+	assert.Empty(t, matcher.FillGroup(ctx, []string{"1"}, getTestUsers("2"), 2))
+}
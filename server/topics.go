@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	//numPopularTopics is the number of topics that `/lunchbot topics popular` shows
+	numPopularTopics = 10
+	//maxTopicSuggestions is the maximum number of topics that are suggested while entering a topic
+	maxTopicSuggestions = 25
+)
+
+// CatalogueTopic is a topic of the organisation-wide topic catalogue, which users pick their topics from
+type CatalogueTopic struct {
+	Name      string `json:"Name"`      //Spelling of the topic that is shown to users
+	Curated   bool   `json:"Curated"`   //True if an admin added the topic to the catalogue
+	CreatedAt int64  `json:"CreatedAt"` //Unix timestamp in milliseconds
+}
+
+// TopicCount is the number of users that are interested in a topic
+type TopicCount struct {
+	Topic string
+	Count int
+}
+
+// NormalizeTopic returns the given topic in a form that allows comparing topics regardless of their case and whitespace
+func NormalizeTopic(topic string) string {
+	return strings.ToLower(strings.Join(strings.Fields(topic), " "))
+}
+
+// FindTopic returns the spelling of the given topic within the given set of topics. Returns false if the set does not contain the topic.
+func FindTopic(topics map[string]struct{}, topic string) (string, bool) {
+	normalizedTopic := NormalizeTopic(topic)
+	for existingTopic := range topics {
+		if NormalizeTopic(existingTopic) == normalizedTopic {
+			return existingTopic, true
+		}
+	}
+	return "", false
+}
+
+// AddToCatalogue adds the given topic to the given catalogue if it does not contain the topic yet.
+// Returns the spelling of the topic in the catalogue.
+func AddToCatalogue(catalogue map[string]*CatalogueTopic, topic string, curated bool, now int64) string {
+	key := NormalizeTopic(topic)
+	catalogueTopic, ok := catalogue[key]
+	if !ok {
+		catalogueTopic = &CatalogueTopic{Name: strings.Join(strings.Fields(topic), " "), CreatedAt: now}
+		catalogue[key] = catalogueTopic
+	}
+	if curated {
+		catalogueTopic.Curated = true
+	}
+	return catalogueTopic.Name
+}
+
+// GetTopicSuggestions returns the topics of the given catalogue that contain the given input.
+// Topics that start with the input come first, followed by the curated topics.
+func GetTopicSuggestions(catalogue map[string]*CatalogueTopic, input string) []model.AutocompleteListItem {
+	input = NormalizeTopic(input)
+	topics := []*CatalogueTopic{}
+	for key, topic := range catalogue {
+		if strings.Contains(key, input) {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		iPrefix := strings.HasPrefix(NormalizeTopic(topics[i].Name), input)
+		jPrefix := strings.HasPrefix(NormalizeTopic(topics[j].Name), input)
+		if iPrefix != jPrefix {
+			return iPrefix
+		}
+		if topics[i].Curated != topics[j].Curated {
+			return topics[i].Curated
+		}
+		return NormalizeTopic(topics[i].Name) < NormalizeTopic(topics[j].Name)
+	})
+
+	suggestions := []model.AutocompleteListItem{}
+	for _, topic := range topics {
+		if len(suggestions) >= maxTopicSuggestions {
+			break
+		}
+		suggestions = append(suggestions, model.AutocompleteListItem{Item: topic.Name})
+	}
+	return suggestions
+}
+
+// GetPopularTopics returns the given number of topics that the most users are interested in.
+// Topics are named like in the catalogue, or like most users spell them if the catalogue does not contain them.
+func GetPopularTopics(data *LunchbotData, count int) []TopicCount {
+	counts := map[string]int{}
+	spellings := map[string]map[string]int{}
+	for _, topics := range data.UserTopics {
+		for topic := range topics {
+			key := NormalizeTopic(topic)
+			counts[key]++
+			if spellings[key] == nil {
+				spellings[key] = map[string]int{}
+			}
+			spellings[key][topic]++
+		}
+	}
+
+	popularTopics := []TopicCount{}
+	for key, topicCount := range counts {
+		name := ""
+		if catalogueTopic, ok := data.TopicCatalogue[key]; ok {
+			name = catalogueTopic.Name
+		} else {
+			for spelling, spellingCount := range spellings[key] {
+				if spellingCount > spellings[key][name] || (spellingCount == spellings[key][name] && spelling < name) {
+					name = spelling
+				}
+			}
+		}
+		popularTopics = append(popularTopics, TopicCount{Topic: name, Count: topicCount})
+	}
+	sort.Slice(popularTopics, func(i, j int) bool {
+		if popularTopics[i].Count != popularTopics[j].Count {
+			return popularTopics[i].Count > popularTopics[j].Count
+		}
+		return popularTopics[i].Topic < popularTopics[j].Topic
+	})
+	if len(popularTopics) > count {
+		popularTopics = popularTopics[:count]
+	}
+	return popularTopics
+}
+
+// GetPopularTopicsMsg returns a message that lists the topics the most users are interested in
+func (p *Plugin) GetPopularTopicsMsg() (string, error) {
+	data, err := p.store.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	popularTopics := GetPopularTopics(&data, numPopularTopics)
+	if len(popularTopics) <= 0 {
+		return fmt.Sprintf("Nobody has set any topics yet... Use '/%s' to set a topic.", commandLunchbotTopicsAdd), nil
+	}
+
+	message := "The most popular topics:\n"
+	for _, topicCount := range popularTopics {
+		users := "users"
+		if topicCount.Count == 1 {
+			users = "user"
+		}
+		message += fmt.Sprintf("  - %s (%d %s)\n", topicCount.Topic, topicCount.Count, users)
+	}
+	return message, nil
+}
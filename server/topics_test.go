@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTopic(t *testing.T) {
+	assert.Equal(t, "basketball", NormalizeTopic("Basketball"))
+	assert.Equal(t, "basketball", NormalizeTopic("basketball "))
+	assert.Equal(t, "playing guitar", NormalizeTopic(" Playing   Guitar"))
+
+	topic, ok := FindTopic(map[string]struct{}{"Basketball": struct{}{}}, "basketball ")
+	assert.True(t, ok)
+	assert.Equal(t, "Basketball", topic)
+	_, ok = FindTopic(map[string]struct{}{"Basketball": struct{}{}}, "Football")
+	assert.False(t, ok)
+}
+
+func TestSharedTopics(t *testing.T) {
+	data := &LunchbotData{
+		UserTopics: map[string]map[string]struct{}{
+			"1": map[string]struct{}{"Basketball": struct{}{}, "Go": struct{}{}, "Cooking": struct{}{}},
+			"2": map[string]struct{}{"basketball ": struct{}{}, "cooking": struct{}{}},
+			"3": map[string]struct{}{"Skiing": struct{}{}},
+		},
+	}
+	assert.Equal(t, []string{"Basketball", "Cooking"}, GetSharedTopics(data, "1", "2"))
+	assert.Empty(t, GetSharedTopics(data, "1", "3"))
+
+	ctx := newTestMatchContext(data, nil, 1)
+	assert.Equal(t, uint(2*ctx.Config.SharedTopicWeight), SharedTopicScorer{}.Score(ctx, []string{"1", "3"}, "2"))
+
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(data)
+	assert.Equal(t, "You share an interest in Basketball, Cooking! You could also talk about Go", plugin.GetRandomTopicsMsg([]string{"1", "2"}))
+	assert.Equal(t, "You could talk about Skiing", plugin.GetRandomTopicsMsg([]string{"3"}))
+	assert.Empty(t, plugin.GetRandomTopicsMsg([]string{"4"}))
+}
+
+func TestTopicCatalogue(t *testing.T) {
+	catalogue := map[string]*CatalogueTopic{}
+	assert.Equal(t, "Playing guitar", AddToCatalogue(catalogue, " Playing  guitar", false, 1))
+	assert.Equal(t, "Playing guitar", AddToCatalogue(catalogue, "playing guitar", true, 2))
+	assert.Equal(t, &CatalogueTopic{Name: "Playing guitar", Curated: true, CreatedAt: 1}, catalogue["playing guitar"])
+	AddToCatalogue(catalogue, "Guitars", false, 3)
+	AddToCatalogue(catalogue, "Go", false, 4)
+
+	assert.Equal(t, []model.AutocompleteListItem{{Item: "Guitars"}, {Item: "Playing guitar"}}, GetTopicSuggestions(catalogue, "GUITAR"))
+	assert.Len(t, GetTopicSuggestions(catalogue, ""), 3)
+	assert.Empty(t, GetTopicSuggestions(catalogue, "Rust"))
+
+	data := &LunchbotData{
+		UserTopics: map[string]map[string]struct{}{
+			"1": map[string]struct{}{"go": struct{}{}, "Cooking": struct{}{}},
+			"2": map[string]struct{}{"Go ": struct{}{}, "cooking": struct{}{}},
+			"3": map[string]struct{}{"GO": struct{}{}, "Skiing": struct{}{}},
+		},
+		TopicCatalogue: catalogue,
+	}
+	assert.Equal(t, []TopicCount{{Topic: "Go", Count: 3}, {Topic: "Cooking", Count: 2}}, GetPopularTopics(data, 2))
+}
+
+func TestServeHTTPAutocompleteTopics(t *testing.T) {
+	plugin := &Plugin{}
+	plugin.store = newMemoryStore(&LunchbotData{
+		TopicCatalogue: map[string]*CatalogueTopic{
+			"basketball": &CatalogueTopic{Name: "Basketball"},
+			"baking":     &CatalogueTopic{Name: "Baking"},
+		},
+	})
+
+	query := url.Values{}
+	query.Add("user_input", "lunchbot topics add bask")
+	query.Add("parsed", "lunchbot topics add ")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/"+autocompleteTopicsPath+"?"+query.Encode(), nil)
+	r.Header.Set("Mattermost-User-Id", "1")
+	plugin.ServeHTTP(nil, w, r)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, []model.AutocompleteListItem{{Item: "Basketball"}}, model.AutocompleteStaticListItemsFromJSON(w.Result().Body))
+	assert.Nil(t, getAutocompleteData().IsValid())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+const (
+	//channelMembersPerPage is the number of channel members that are fetched with a single request
+	channelMembersPerPage = 200
+	//statusesPerRequest is the number of user statuses that are fetched with a single request
+	statusesPerRequest = 1000
+)
+
+// UserCache remembers the users and statuses that have been looked up. It is meant to live for a single command or pairing round only,
+// so changes to users and their statuses do not go unnoticed.
+type UserCache struct {
+	api      plugin.API
+	users    map[string]*model.User
+	statuses map[string]string
+}
+
+// NewUserCache creates an empty cache that looks up users using the given API
+func NewUserCache(api plugin.API) *UserCache {
+	return &UserCache{
+		api:      api,
+		users:    map[string]*model.User{},
+		statuses: map[string]string{},
+	}
+}
+
+// GetUser returns the user with the given ID, it is only fetched if it has not been looked up before
+func (c *UserCache) GetUser(userID string) (*model.User, *model.AppError) {
+	if user, ok := c.users[userID]; ok {
+		return user, nil
+	}
+	user, appErr := c.api.GetUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	c.users[userID] = user
+	return user, nil
+}
+
+// LookupUser returns the user with the given ID if it has been looked up before, it is never fetched
+func (c *UserCache) LookupUser(userID string) (*model.User, bool) {
+	user, ok := c.users[userID]
+	return user, ok
+}
+
+// GetChannelMembers pages through the members of the given channel and returns them. If maxMembers is positive, only that many members are returned.
+func (c *UserCache) GetChannelMembers(channelID string, maxMembers int) ([]*model.User, *model.AppError) {
+	members := []*model.User{}
+	for page := 0; ; page++ {
+		users, appErr := c.api.GetUsersInChannel(channelID, "username", page, channelMembersPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, user := range users {
+			c.users[user.Id] = user
+		}
+		members = append(members, users...)
+		if maxMembers > 0 && len(members) >= maxMembers {
+			if len(members) > maxMembers || len(users) >= channelMembersPerPage {
+				c.api.LogWarn("Only the configured maximum of channel members is considered", "channel_id", channelID, "max_channel_members", maxMembers)
+			}
+			return members[:maxMembers], nil
+		}
+		if len(users) < channelMembersPerPage {
+			return members, nil
+		}
+	}
+}
+
+// LoadStatuses fetches the statuses of the given users in bulk. Statuses that have been looked up before are not fetched again.
+// Users whose status is not returned are considered offline.
+func (c *UserCache) LoadStatuses(userIDs []string) *model.AppError {
+	missingIDs := []string{}
+	for _, userID := range userIDs {
+		if _, ok := c.statuses[userID]; !ok {
+			missingIDs = append(missingIDs, userID)
+		}
+	}
+	for start := 0; start < len(missingIDs); start += statusesPerRequest {
+		end := start + statusesPerRequest
+		if end > len(missingIDs) {
+			end = len(missingIDs)
+		}
+		statuses, appErr := c.api.GetUserStatusesByIds(missingIDs[start:end])
+		if appErr != nil {
+			return appErr
+		}
+		for _, status := range statuses {
+			c.statuses[status.UserId] = status.Status
+		}
+		//users without a status have never been online, they must not be looked up one by one later on
+		for _, userID := range missingIDs[start:end] {
+			if _, ok := c.statuses[userID]; !ok {
+				c.statuses[userID] = model.STATUS_OFFLINE
+			}
+		}
+	}
+	return nil
+}
+
+// GetStatus returns the status of the given user, it is only fetched if it has not been looked up before.
+// Returns false if the status cannot be found.
+func (c *UserCache) GetStatus(userID string) (string, bool) {
+	if status, ok := c.statuses[userID]; ok {
+		return status, true
+	}
+	status, appErr := c.api.GetUserStatus(userID)
+	if appErr != nil {
+		return "", false
+	}
+	c.statuses[userID] = status.Status
+	return status.Status, true
+}
+
+// FilterAvailableUsers splits the given users into the users that are available at the given time and those that are not.
+// The statuses of the users are fetched in bulk.
+func (p *Plugin) FilterAvailableUsers(cache *UserCache, users []*model.User, data *LunchbotData, now time.Time) ([]*model.User, []*model.User) {
+	if len(p.getConfiguration().GetEligibleStatuses()) < len(userStatuses) {
+		userIDs := []string{}
+		for _, user := range users {
+			userIDs = append(userIDs, user.Id)
+		}
+		if appErr := cache.LoadStatuses(userIDs); appErr != nil {
+			p.API.LogError("Failed to get the statuses of the users", "err", appErr.Error())
+		}
+	}
+
+	available := []*model.User{}
+	unavailable := []*model.User{}
+	for _, user := range users {
+		if p.IsUserAvailable(cache, user, data, now) {
+			available = append(available, user)
+		} else {
+			unavailable = append(unavailable, user)
+		}
+	}
+	return available, unavailable
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// getChannelMembers returns a function that returns the requested page of the given number of channel members, as expected by GetUsersInChannel
+func getChannelMembers(count int) func(channelID string, sortBy string, page int, perPage int) []*model.User {
+	return func(channelID string, sortBy string, page int, perPage int) []*model.User {
+		users := []*model.User{}
+		for index := page * perPage; index < (page+1)*perPage && index < count; index++ {
+			users = append(users, &model.User{Id: fmt.Sprintf("user%d", index)})
+		}
+		return users
+	}
+}
+
+func TestUserCacheGetChannelMembers(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetUsersInChannel", "channel", "username", mock.AnythingOfType("int"), channelMembersPerPage).Return(getChannelMembers(2500), nil)
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	cache := NewUserCache(api)
+	members, appErr := cache.GetChannelMembers("channel", 0)
+	assert.Nil(t, appErr)
+	assert.Len(t, members, 2500)
+	assert.Equal(t, "user2499", members[2499].Id)
+	api.AssertNumberOfCalls(t, "GetUsersInChannel", 13)
+
+	members, appErr = NewUserCache(api).GetChannelMembers("channel", 300)
+	assert.Nil(t, appErr)
+	assert.Len(t, members, 300)
+	api.AssertCalled(t, "LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	//members do not have to be fetched again
+	user, appErr := cache.GetUser("user42")
+	assert.Nil(t, appErr)
+	assert.Equal(t, "user42", user.Id)
+	api.AssertNotCalled(t, "GetUser", mock.Anything)
+}
+
+func TestUserCacheStatuses(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return(getStatuses(model.STATUS_AWAY), nil)
+	api.On("GetUserStatus", "other").Return(&model.Status{UserId: "other", Status: model.STATUS_ONLINE}, nil).Once()
+
+	userIDs := []string{}
+	for index := 0; index < 2500; index++ {
+		userIDs = append(userIDs, fmt.Sprintf("user%d", index))
+	}
+	cache := NewUserCache(api)
+	assert.Nil(t, cache.LoadStatuses(userIDs))
+	api.AssertNumberOfCalls(t, "GetUserStatusesByIds", 3)
+	assert.Nil(t, cache.LoadStatuses(userIDs[:10]))
+	api.AssertNumberOfCalls(t, "GetUserStatusesByIds", 3)
+
+	status, ok := cache.GetStatus("user1")
+	assert.True(t, ok)
+	assert.Equal(t, model.STATUS_AWAY, status)
+	status, ok = cache.GetStatus("other")
+	assert.True(t, ok)
+	assert.Equal(t, model.STATUS_ONLINE, status)
+	status, _ = cache.GetStatus("other")
+	assert.Equal(t, model.STATUS_ONLINE, status)
+}
+
+func TestUserCacheStatuses_missing(t *testing.T) {
+	api := &plugintest.API{}
+	//only the first user has a status
+	api.On("GetUserStatusesByIds", mock.AnythingOfType("[]string")).Return([]*model.Status{&model.Status{UserId: "user0", Status: model.STATUS_ONLINE}}, nil)
+
+	cache := NewUserCache(api)
+	assert.Nil(t, cache.LoadStatuses([]string{"user0", "user1", "user2"}))
+	status, ok := cache.GetStatus("user0")
+	assert.True(t, ok)
+	assert.Equal(t, model.STATUS_ONLINE, status)
+	for _, userID := range []string{"user1", "user2"} {
+		status, ok = cache.GetStatus(userID)
+		assert.True(t, ok)
+		assert.Equal(t, model.STATUS_OFFLINE, status)
+	}
+	api.AssertNotCalled(t, "GetUserStatus", mock.Anything)
+	api.AssertNumberOfCalls(t, "GetUserStatusesByIds", 1)
+}